@@ -0,0 +1,84 @@
+package cfst
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Alert types.
+const (
+	AlertFleetDegradation = "fleet_degradation"
+)
+
+// Alert is a notable condition detected after a run, distinct from per-IP results.
+type Alert struct {
+	Type     string  `json:"type"`
+	Message  string  `json:"message"`
+	Current  float64 `json:"current"`
+	Baseline float64 `json:"baseline"`
+}
+
+const (
+	baselineRuns    = 10 // trailing runs that form the baseline
+	minBaselineRuns = 3  // history needed before alerting at all
+)
+
+// runMedians returns the median speed of each past run in history, oldest first.
+func runMedians(history []HistoryRecord) []float64 {
+	byRun := make(map[time.Time][]float64)
+	for _, rec := range history {
+		if rec.Speed > 0 {
+			byRun[rec.Time] = append(byRun[rec.Time], rec.Speed)
+		}
+	}
+	times := make([]time.Time, 0, len(byRun))
+	for t := range byRun {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	medians := make([]float64, len(times))
+	for i, t := range times {
+		speeds := byRun[t]
+		sort.Float64s(speeds)
+		medians[i] = median(speeds)
+	}
+	return medians
+}
+
+// detectFleetDegradation reports a fleet-wide median speed drop of at least dropRatio, or nil.
+func detectFleetDegradation(history []HistoryRecord, results []NodeResult, dropRatio float64) *Alert {
+	if dropRatio <= 0 {
+		return nil
+	}
+	past := runMedians(history)
+	if len(past) < minBaselineRuns {
+		return nil
+	}
+	if len(past) > baselineRuns {
+		past = past[len(past)-baselineRuns:]
+	}
+	sort.Float64s(past)
+	baseline := median(past)
+
+	var speeds []float64
+	for _, r := range results {
+		if r.DownloadSpeed > 0 {
+			speeds = append(speeds, r.DownloadSpeed)
+		}
+	}
+	sort.Float64s(speeds)
+	current := median(speeds)
+
+	if baseline <= 0 || current > baseline*(1-dropRatio) {
+		return nil
+	}
+	return &Alert{
+		Type: AlertFleetDegradation,
+		Message: fmt.Sprintf("Median speed across all tested IPs dropped to %.2f MB/s (baseline %.2f MB/s over last %d runs, -%.0f%%): likely ISP-level throttling, not individual bad IPs",
+			current, baseline, len(past), (1-current/baseline)*100),
+		Current:  current,
+		Baseline: baseline,
+	}
+}
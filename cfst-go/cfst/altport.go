@@ -0,0 +1,91 @@
+package cfst
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Results on a port other than 443 are output as ip:port; -check-443 finds those also usable on 443.
+
+const port443Timeout = 2 * time.Second
+
+// resultAddr is the ip:port a result was measured on.
+func resultAddr(ip string, port int) string {
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// altPort reports whether r was measured on a port other than 443.
+func altPort(r NodeResult) bool {
+	return r.Port != 0 && r.Port != 443
+}
+
+// portless reports whether clients reaching r.IP on 443 get what was measured.
+func portless(r NodeResult) bool {
+	return !altPort(r) || r.Port443
+}
+
+// usableAt returns the bare IP when r serves on 443, ip:port otherwise.
+func usableAt(r NodeResult) string {
+	if portless(r) {
+		return r.IP
+	}
+	return resultAddr(r.IP, r.Port)
+}
+
+// forPortless keeps the results port-less outputs may use: all, or with only443 the portless ones.
+func forPortless(results []NodeResult, only443 bool) []NodeResult {
+	if !only443 {
+		return results
+	}
+	var out []NodeResult
+	for _, r := range results {
+		if portless(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// check443 sets Port443 on the alt-port results that answer on 443 and returns the counts.
+func check443(ctx context.Context, cfg Config, results []NodeResult) (checked, open int) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := range results {
+		r := &results[i]
+		if r.DownloadSpeed <= 0 || !altPort(*r) {
+			continue
+		}
+		checked++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if TLSPing(ctx, r.IP, 443, cfg.SNI, port443Timeout) > 0 {
+				r.Port443 = true
+				mu.Lock()
+				open++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return checked, open
+}
+
+// check443Note describes a check443 outcome for the run log.
+func check443Note(checked, open int) string {
+	return fmt.Sprintf("Port 443 answers on %d of %d results measured on another port", open, checked)
+}
+
+// writeBest writes the best usable result to the -best-out file.
+func writeBest(cfg Config, results []NodeResult) error {
+	best := bestResult(results)
+	if best == nil {
+		return fmt.Errorf("no usable result")
+	}
+	return os.WriteFile(cfg.BestOut, []byte(usableAt(*best)+"\n"), 0644)
+}
@@ -0,0 +1,256 @@
+package cfst
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiParam is one query parameter of a web endpoint, parsed and documented from one table.
+type apiParam struct {
+	Name        string
+	Type        string // OpenAPI schema type
+	Description string
+	apply       func(cfg *Config, v string) error
+}
+
+func intParam(dst func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) (err error) {
+		*dst(c), err = strconv.Atoi(v)
+		return err
+	}
+}
+
+func floatParam(dst func(*Config) *float64) func(*Config, string) error {
+	return func(c *Config, v string) (err error) {
+		*dst(c), err = strconv.ParseFloat(v, 64)
+		return err
+	}
+}
+
+func boolParam(dst func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, v string) (err error) {
+		*dst(c), err = strconv.ParseBool(v)
+		return err
+	}
+}
+
+func durationParam(dst func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, v string) (err error) {
+		*dst(c), err = time.ParseDuration(v)
+		return err
+	}
+}
+
+func stringParam(dst func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		*dst(c) = v
+		return nil
+	}
+}
+
+var testParams = []apiParam{
+	{"max", "integer", "Max IPs to scan, up to the server's own", intParam(func(c *Config) *int { return &c.MaxScan })},
+	{"port", "integer", "Port to test", intParam(func(c *Config) *int { return &c.Port })},
+	{"dn", "integer", "Number of results to collect", intParam(func(c *Config) *int { return &c.DownloadNum })},
+	{"topn", "integer", "Candidates kept for the download test", intParam(func(c *Config) *int { return &c.TopN })},
+	{"dlc", "integer", "Parallel download tests", intParam(func(c *Config) *int { return &c.DLConc })},
+	{"dt", "integer", "Download test duration in seconds, up to the server's own", intParam(func(c *Config) *int { return &c.Duration })},
+	{"url", "string", "Download test URL on a host the server already tests against", stringParam(func(c *Config) *string { return &c.URL })},
+	{"zone", "string", "Own zone; builds the test URL like -own-zone, on a host the server already tests against", func(c *Config, v string) (err error) {
+		c.URL, err = buildOwnZoneURL(v)
+		return err
+	}},
+	{"qd", "integer", "Quick pre-filter duration in seconds", intParam(func(c *Config) *int { return &c.QuickDuration })},
+	{"streams", "integer", "Concurrent streams per IP", intParam(func(c *Config) *int { return &c.Streams })},
+	{"h2", "boolean", "Multiplex streams over one HTTP/2 connection", boolParam(func(c *Config) *bool { return &c.HTTP2 })},
+	{"ech", "boolean", "Probe Encrypted Client Hello support", boolParam(func(c *Config) *bool { return &c.ProbeECH })},
+	{"ws_url", "string", "WebSocket URL to probe through each IP, on a host the server already tests against", stringParam(func(c *Config) *string { return &c.WSURL })},
+	{"grpc_url", "string", "gRPC/HTTP2 URL to hold open through each IP, on a host the server already tests against", stringParam(func(c *Config) *string { return &c.GRPCURL })},
+	{"cache_ttl", "string", "Reuse per-IP results younger than this duration, e.g. 6h", durationParam(func(c *Config) *time.Duration { return &c.CacheTTL })},
+	{"tlsping", "boolean", "Rank by TLS handshake time instead of TCP connect time", boolParam(func(c *Config) *bool { return &c.TLSPing })},
+	{"trace_first", "boolean", "One trace request for colo and blocking before each download", boolParam(func(c *Config) *bool { return &c.TraceFirst })},
+	{"dpi", "boolean", "Probe for ISP interference", boolParam(func(c *Config) *bool { return &c.ProbeDPI })},
+	{"strategy", "string", "IP sampling: uniform or coarse-fine", stringParam(func(c *Config) *string { return &c.Strategy })},
+	{"expand", "integer", "Scan the /24 around the top N results", intParam(func(c *Config) *int { return &c.Expand })},
+	{"longevity", "string", "Slow-transfer longevity test duration, e.g. 5m, up to the server's own", durationParam(func(c *Config) *time.Duration { return &c.Longevity })},
+	{"check_443", "boolean", "With a port other than 443, also check 443 on each result and mark the ones that answer", boolParam(func(c *Config) *bool { return &c.Check443 })},
+	{"trace_fields", "boolean", "Record the egress IP, HTTP protocol, TLS version and warp status from each IP's trace", boolParam(func(c *Config) *bool { return &c.TraceFields })},
+	{"egress_change", "string", "Results measured from another public IP than most: mark, drop or off", stringParam(func(c *Config) *string { return &c.EgressChange })},
+	{"cert_check", "boolean", "Record and classify each tested IP's certificate", boolParam(func(c *Config) *bool { return &c.ProbeCert })},
+	{"resume", "boolean", "Probe TLS session resumption", boolParam(func(c *Config) *bool { return &c.ProbeResume })},
+	{"cache_prime", "boolean", "Prime the edge cache before each download", boolParam(func(c *Config) *bool { return &c.CachePrime })},
+	{"skip429", "boolean", "Drop rate-limited IPs from the results", boolParam(func(c *Config) *bool { return &c.Skip429 })},
+	{"filter", "string", "Candidate filter: speed, multi-colo or none", stringParam(func(c *Config) *string { return &c.FilterMode })},
+	{"verify", "integer", "Extra download passes over the top 5 IPs, ranked by the mean", intParam(func(c *Config) *int { return &c.Verify })},
+	{"sl", "number", "Only keep results of at least this many MB/s, testing on until dn are found", floatParam(func(c *Config) *float64 { return &c.MinSpeed })},
+	{"tl", "number", "Drop IPs slower than this many ms before colo detection and download", floatParam(func(c *Config) *float64 { return &c.MaxLatency })},
+	{"cfcolo", "string", "Comma-separated colos the results are restricted to, e.g. HKG,NRT,SJC", stringParam(func(c *Config) *string { return &c.CFColo })},
+	{"sni", "string", "TLS SNI override", stringParam(func(c *Config) *string { return &c.SNI })},
+	{"pin", "string", "Comma-separated IPs always scanned and download-tested, added to the server's -pin list", func(c *Config, v string) error {
+		ips, err := parsePinList(v)
+		if err != nil {
+			return err
+		}
+		c.PinIPs = append(append([]string(nil), c.PinIPs...), ips...)
+		return nil
+	}},
+	{"dli", "string", "Pause between downloads per worker, e.g. 2s or 2s±1s", func(c *Config, v string) (err error) {
+		c.DLInterval, c.DLJitter, err = parseInterval(v)
+		return err
+	}},
+}
+
+// applyTestParams overrides cfg with the /api/test query parameters present in q.
+func applyTestParams(cfg *Config, q url.Values) error {
+	server := *cfg
+	for _, p := range testParams {
+		if v := q.Get(p.Name); v != "" {
+			if err := p.apply(cfg, v); err != nil {
+				return fmt.Errorf("%s=%q: %v", p.Name, v, err)
+			}
+		}
+	}
+	return checkTestLimits(*cfg, server)
+}
+
+// checkTestLimits rejects a request cfg beyond what the server itself runs with.
+func checkTestLimits(cfg, server Config) error {
+	switch {
+	case cfg.MaxScan < 1 || cfg.MaxScan > server.MaxScan:
+		return fmt.Errorf("max must be between 1 and %d", server.MaxScan)
+	case cfg.Duration < 1 || cfg.Duration > server.Duration:
+		return fmt.Errorf("dt must be between 1 and %d", server.Duration)
+	case cfg.Longevity < 0 || cfg.Longevity > server.Longevity:
+		return fmt.Errorf("longevity must be at most %v", server.Longevity)
+	}
+	hosts := map[string]bool{}
+	for _, s := range []string{server.URL, server.WSURL, server.GRPCURL} {
+		if u, err := url.Parse(s); err == nil && u.Hostname() != "" {
+			hosts[strings.ToLower(u.Hostname())] = true
+		}
+	}
+	for _, p := range []struct{ name, old, v string }{
+		{"url", server.URL, cfg.URL},
+		{"ws_url", server.WSURL, cfg.WSURL},
+		{"grpc_url", server.GRPCURL, cfg.GRPCURL},
+	} {
+		if p.v == p.old {
+			continue
+		}
+		u, err := url.Parse(p.v)
+		if err != nil {
+			return fmt.Errorf("%s: %v", p.name, err)
+		}
+		if !hosts[strings.ToLower(u.Hostname())] {
+			return fmt.Errorf("%s: host %q is not one this server tests against", p.name, u.Hostname())
+		}
+	}
+	if cfg.URL != server.URL {
+		return checkTestURL(cfg.URL)
+	}
+	return nil
+}
+
+// apiEndpoint documents one GET endpoint.
+type apiEndpoint struct {
+	Path        string
+	Summary     string
+	ContentType string
+	Params      []apiParam
+}
+
+var formatParam = apiParam{Name: "format", Type: "string", Description: "ndjson for newline-delimited JSON instead of the default format"}
+
+var tokenParam = apiParam{Name: "token", Type: "string", Description: "API token when the server runs with -web-tokens (or Authorization: Bearer)"}
+
+func apiEndpoints() []apiEndpoint {
+	return []apiEndpoint{
+		{"/api/test", "Run a speed test, streamed as server-sent events (job, queued, status, phase, progress_*, leaderboard, alert, error, server_shutdown, complete)",
+			"text/event-stream", append(append([]apiParam(nil), testParams...), formatParam, tokenParam)},
+		{"/api/retest", "Re-run the colo and download test for IPs from an earlier job, streamed like /api/test (every IP gets a result)",
+			"text/event-stream", append(append([]apiParam{{Name: "ips", Type: "string", Description: "Comma-separated IPs, at most 50"}}, testParams...), formatParam, tokenParam)},
+		{"/api/report/hours", "Median speed per time-of-day bucket from -history", "application/json",
+			[]apiParam{{Name: "by", Type: "string", Description: "colo (default) or ip"}, formatParam, tokenParam}},
+		{"/api/pick", "Weighted random choice among the top results of the latest run in -history, for endpoint rotation", "application/json",
+			[]apiParam{
+				{Name: "top", Type: "integer", Description: "Choose among the N top-scored results, default 5"},
+				{Name: "power", Type: "number", Description: "Weight = score^power: 0 picks uniformly, higher favors the best; default 2"},
+				{Name: "sticky", Type: "string", Description: "Keep returning the previous pick this long while it stays in the top N, e.g. 1h"},
+				{Name: "key", Type: "string", Description: "Separate sticky state per client, e.g. a hostname"},
+				tokenParam,
+			}},
+		{"/api/audit", "Recent audit log entries from -audit-log", "application/json",
+			[]apiParam{{Name: "limit", Type: "integer", Description: "Max entries, default 200"}, formatParam, tokenParam}},
+		{"/api/jobs", "The last 50 web jobs, newest first, with how each ended", "application/json",
+			[]apiParam{formatParam, tokenParam}},
+		{"/api/jobs/{id}/log", "The events one job sent (status, phase, alert, error, ...; not the progress ticks), to diagnose a failed run", "application/json",
+			[]apiParam{{Name: "id", Type: "integer", Description: "Job id, from the job's first event (job) or /api/jobs"}, formatParam, tokenParam}},
+		{"/api/defaults", "Detected client IP, country and nearest colo, with suggested form defaults", "application/json", nil},
+		{"/metrics", "Prometheus metrics of the last run (of the token's namespace under -web-tokens): best latency and speed, valid and blocked counts, timestamp, phase durations, per-colo breakdown",
+			"text/plain", []apiParam{tokenParam}},
+		{"/api/openapi.json", "This OpenAPI document", "application/json", nil},
+		{"/api/docs", "Human-readable API documentation", "text/html", nil},
+	}
+}
+
+// openAPISpec renders apiEndpoints as an OpenAPI 3.0 document.
+func openAPISpec() map[string]interface{} {
+	paths := make(map[string]interface{})
+	for _, ep := range apiEndpoints() {
+		var params []map[string]interface{}
+		for _, p := range ep.Params {
+			param := map[string]interface{}{
+				"name":        p.Name,
+				"in":          "query",
+				"description": p.Description,
+				"schema":      map[string]string{"type": p.Type},
+			}
+			if strings.Contains(ep.Path, "{"+p.Name+"}") {
+				param["in"], param["required"] = "path", true
+			}
+			params = append(params, param)
+		}
+		op := map[string]interface{}{
+			"summary": ep.Summary,
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "OK",
+					"content":     map[string]interface{}{ep.ContentType: map[string]interface{}{}},
+				},
+			},
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		paths[ep.Path] = map[string]interface{}{"get": op}
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]string{"title": "CFST web API", "version": version},
+		"paths":   paths,
+	}
+}
+
+var apiDocsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>CFST API</title>
+<style>body{font-family:sans-serif;max-width:960px;margin:2em auto;color:#222}table{border-collapse:collapse;width:100%;margin-bottom:2em}td,th{border:1px solid #ccc;padding:4px 8px;text-align:left}code{background:#f4f4f4}</style>
+</head><body>
+<h1>CFST web API</h1>
+<p>Machine-readable: <a href="/api/openapi.json">/api/openapi.json</a></p>
+{{range .}}<h2><code>GET {{.Path}}</code></h2>
+<p>{{.Summary}} <small>({{.ContentType}})</small></p>
+{{if .Params}}<table><tr><th>Parameter</th><th>Type</th><th>Description</th></tr>
+{{range .Params}}<tr><td><code>{{.Name}}</code></td><td>{{.Type}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>{{end}}{{end}}
+</body></html>
+`))
+
+func serveAPIDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	apiDocsTemplate.Execute(w, apiEndpoints())
+}
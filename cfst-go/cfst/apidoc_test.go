@@ -0,0 +1,49 @@
+package cfst
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestApplyTestParams(t *testing.T) {
+	server := DefaultConfig()
+	server.Longevity = 5 * time.Minute
+	server.WSURL = "wss://echo.example.com/ws"
+	for _, tc := range []struct {
+		query string
+		ok    bool
+	}{
+		{"", true},
+		{"max=100&dt=5&longevity=1m", true},
+		{"max=3000&dt=20&longevity=5m", true},
+		{"max=3001", false},
+		{"max=0", false},
+		{"max=ten", false},
+		{"dt=21", false},
+		{"dt=5s", false},
+		{"longevity=6m", false},
+		{"longevity=5", false},
+		{"skip429=maybe", false},
+		{"url=https://speed.cloudflare.com/__down?bytes=1000", true},
+		{"url=https://attacker.example/", false},
+		{"url=ftp://speed.cloudflare.com/", false},
+		{"zone=echo.example.com", true},
+		{"zone=other.example", false},
+		{"ws_url=wss://echo.example.com/other", true},
+		{"ws_url=wss://other.example/ws", false},
+		{"grpc_url=https://speed.cloudflare.com/svc.S/M", true},
+		{"grpc_url=https://other.example/svc.S/M", false},
+		{"pin=not-an-ip", false},
+		{"dli=soon", false},
+	} {
+		q, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := server
+		if err := applyTestParams(&cfg, q); (err == nil) != tc.ok {
+			t.Errorf("%q: error %v, want ok %v", tc.query, err, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package cfst
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry is one line of the web-mode audit log.
+type AuditEntry struct {
+	Time         time.Time `json:"time"`
+	Job          int64     `json:"job"`
+	Event        string    `json:"event"` // "start" or "end"
+	Namespace    string    `json:"namespace,omitempty"`
+	Remote       string    `json:"remote"`
+	ForwardedFor string    `json:"forwarded_for,omitempty"`
+	Params       string    `json:"params,omitempty"`  // query string, token removed
+	Outcome      string    `json:"outcome,omitempty"` // end only: complete, cancelled, shutdown, error: ...
+	Results      int       `json:"results,omitempty"`
+	Tested       int       `json:"tested,omitempty"`
+	TotalMB      float64   `json:"total_mb,omitempty"`
+	Seconds      float64   `json:"seconds,omitempty"`
+}
+
+var auditMu sync.Mutex
+
+// newAuditEntry describes job id, the one behind r.
+func newAuditEntry(r *http.Request, ns string, id int64) AuditEntry {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	return AuditEntry{
+		Job:          id,
+		Namespace:    ns,
+		Remote:       remote,
+		ForwardedFor: r.Header.Get("X-Forwarded-For"),
+		Params:       jobParams(r),
+	}
+}
+
+// appendAudit appends e to the JSON-lines log at path; the file is only ever appended to.
+func appendAudit(path string, e AuditEntry) error {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(e)
+}
+
+// loadAudit returns the last limit entries, restricted to ns when it is set.
+func loadAudit(path, ns string, limit int) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e AuditEntry
+		if json.Unmarshal(sc.Bytes(), &e) != nil || (ns != "" && e.Namespace != ns) {
+			continue
+		}
+		entries = append(entries, e)
+		if len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	return entries, sc.Err()
+}
@@ -0,0 +1,133 @@
+package cfst
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// Benchmarks for the hot paths, on loopback; compare runs with benchstat.
+
+func BenchmarkGenerateIPs(b *testing.B) {
+	for _, unique := range []bool{false, true} {
+		b.Run("unique="+strconv.FormatBool(unique), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				GenerateIPs(3000, unique, "")
+			}
+		})
+	}
+}
+
+// startLocalListener accepts and closes TCP connections and returns the port.
+func startLocalListener(tb testing.TB) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func BenchmarkScanPing(b *testing.B) {
+	port := startLocalListener(b)
+	ips := make([]string, 256)
+	for i := range ips {
+		ips[i] = "127.0.0.1"
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		nodes, _ := ScanPingBounded(context.Background(), ips, port, 64, 32, pinger{ping: TCPPing, timeout: defaultPingTimeout}, nil, nil)
+		if len(nodes) == 0 {
+			b.Fatal("no valid nodes")
+		}
+	}
+}
+
+// syntheticResults returns n download results with plausible spreads.
+func syntheticResults(n int) []NodeResult {
+	r := rand.New(rand.NewSource(1))
+	results := make([]NodeResult, n)
+	for i := range results {
+		results[i] = NodeResult{
+			IP:            fmt.Sprintf("104.16.%d.%d", i/256, i%256),
+			Port:          443,
+			TCPLatency:    20 + r.Float64()*200,
+			Jitter:        r.Float64() * 20,
+			DownloadSpeed: r.Float64() * 30,
+			MinSpeed:      r.Float64() * 10,
+			Stability:     r.Float64() * 100,
+			Colo:          "HKG",
+		}
+	}
+	return results
+}
+
+func BenchmarkScoreAndSort(b *testing.B) {
+	base := syntheticResults(1000)
+	results := make([]NodeResult, len(base))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		copy(results, base)
+		for j := range results {
+			results[j].CalcScore()
+		}
+		sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	}
+}
+
+func BenchmarkTopNodes(b *testing.B) {
+	nodes := syntheticResults(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		best := topNodes{k: 200}
+		for _, n := range nodes {
+			best.offer(n)
+		}
+		best.sorted()
+	}
+}
+
+// startLocalTarget serves the serve-target endpoints over TLS on loopback.
+func startLocalTarget(tb testing.TB) int {
+	srv := httptest.NewUnstartedServer(newTargetMux(8<<20, 1<<40))
+	srv.StartTLS()
+	tb.Cleanup(srv.Close)
+	return srv.Listener.Addr().(*net.TCPAddr).Port
+}
+
+// BenchmarkDownloadPipeline runs the download phase against a local TLS server.
+func BenchmarkDownloadPipeline(b *testing.B) {
+	port := startLocalTarget(b)
+	cfg := DefaultConfig()
+	cfg.Port = port
+	cfg.URL = fmt.Sprintf("https://localhost:%d/__down?bytes=%d", port, int64(1)<<40) // outlasts Duration
+	cfg.Duration = 1
+	cfg.DownloadNum = 2
+	cfg.DLInterval = 0
+	cfg.SkipLoadLatency = true
+	candidates := []NodeResult{{IP: "127.0.0.1", Port: port}, {IP: "127.0.0.1", Port: port}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var stats DownloadStats
+		results := runParallelDownloadTest(context.Background(), candidates, cfg, &stats, nil, nil, nil, nil)
+		if len(results) == 0 {
+			b.Fatal("no results")
+		}
+		b.SetBytes(stats.Bytes.Load())
+	}
+}
@@ -0,0 +1,89 @@
+package cfst
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A byteMeter on the context counts the bytes a run's download tests read.
+
+const byteMeterInterval = time.Second
+
+// ByteProgress is a progress_bytes event: total bytes and the rate over the last interval.
+type ByteProgress struct {
+	Bytes   int64   `json:"bytes"`
+	Rate    float64 `json:"rate"` // MB/s
+	Elapsed float64 `json:"elapsed"`
+}
+
+type byteMeter struct {
+	total atomic.Int64
+}
+
+type byteMeterKey struct{}
+
+// withByteMeter returns ctx carrying a new byteMeter.
+func withByteMeter(ctx context.Context) (context.Context, *byteMeter) {
+	m := &byteMeter{}
+	return context.WithValue(ctx, byteMeterKey{}, m), m
+}
+
+// byteMeterFrom returns ctx's byteMeter, nil if it has none.
+func byteMeterFrom(ctx context.Context) *byteMeter {
+	m, _ := ctx.Value(byteMeterKey{}).(*byteMeter)
+	return m
+}
+
+// add counts n bytes. A nil *byteMeter ignores it.
+func (m *byteMeter) add(n int) {
+	if m != nil && n > 0 {
+		m.total.Add(int64(n))
+	}
+}
+
+// report calls send every interval in which bytes were read until stop is called.
+func (m *byteMeter) report(interval time.Duration, send func(ByteProgress)) (stop func()) {
+	start := time.Now()
+	var mu sync.Mutex
+	last, lastAt := int64(0), start
+	emit := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		b, now := m.total.Load(), time.Now()
+		rate := float64(b-last) / 1024 / 1024 / now.Sub(lastAt).Seconds()
+		quiet := b == last
+		last, lastAt = b, now
+		if quiet {
+			return
+		}
+		send(ByteProgress{Bytes: b, Rate: rate, Elapsed: now.Sub(start).Seconds()})
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				emit()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			emit()
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package cfst
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// -cert-check records the leaf certificate each tested IP presents.
+
+// Certificate verdicts.
+const (
+	CertOK          = "ok"
+	CertSNIMismatch = "sni-mismatch"      // the leaf doesn't cover the SNI
+	CertBadIssuer   = "unexpected-issuer" // issued by a CA not in -cert-issuers
+	CertExpired     = "expired"
+	CertFailed      = "fail" // no handshake
+)
+
+// defaultCertIssuers are the CAs Cloudflare's edge certificates come from.
+const defaultCertIssuers = "Google Trust Services,Let's Encrypt,DigiCert,Sectigo,SSL Corporation,Cloudflare"
+
+// certSNI is the server name the download test presents.
+func certSNI(cfg Config) string {
+	if cfg.SNI != "" {
+		return cfg.SNI
+	}
+	if u, err := url.Parse(cfg.URL); err == nil && u.Hostname() != "" && net.ParseIP(u.Hostname()) == nil {
+		return u.Hostname()
+	}
+	return "speed.cloudflare.com"
+}
+
+// certSuspicious reports whether a verdict deserves a warning.
+func certSuspicious(status string) bool {
+	return status != "" && status != CertOK
+}
+
+// CertProbe handshakes with ip and classifies the leaf certificate against issuers.
+func CertProbe(ctx context.Context, ip string, port int, sni, issuers string, timeout time.Duration) (status, subject, issuer string, sans []string) {
+	rs := settingsOf(ctx)
+	d := &tls.Dialer{NetDialer: rs.dialer(timeout), Config: &tls.Config{InsecureSkipVerify: true, ServerName: sni}}
+	conn, err := d.DialContext(ctx, "tcp", rs.dialAddr(ip, port))
+	if err != nil {
+		return CertFailed, "", "", nil
+	}
+	defer conn.Close()
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return CertFailed, "", "", nil
+	}
+	leaf := certs[0]
+	subject, issuer, sans = leaf.Subject.CommonName, leaf.Issuer.String(), leaf.DNSNames
+
+	switch {
+	case leaf.VerifyHostname(sni) != nil:
+		status = CertSNIMismatch
+	case !issuerExpected(strings.Join(leaf.Issuer.Organization, " ")+" "+leaf.Issuer.CommonName, issuers):
+		status = CertBadIssuer
+	case time.Now().After(leaf.NotAfter):
+		status = CertExpired
+	default:
+		status = CertOK
+	}
+	return status, subject, issuer, sans
+}
+
+func issuerExpected(name, issuers string) bool {
+	name = strings.ToLower(name)
+	for _, want := range strings.Split(issuers, ",") {
+		if want = strings.ToLower(strings.TrimSpace(want)); want != "" && strings.Contains(name, want) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package cfst
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// -discord-webhook and -slack-webhook post a run report on the events -chat-events lists.
+
+// chatEvents are the events -chat-events may list.
+var chatEvents = []string{"complete", "change", "blocked"}
+
+const chatTimeout = 15 * time.Second
+
+// checkChatEvents validates a -chat-events list.
+func checkChatEvents(spec string) error {
+	for _, e := range strings.Split(spec, ",") {
+		if e = strings.TrimSpace(e); e != "" && !slices.Contains(chatEvents, e) {
+			return fmt.Errorf("unknown -chat-events event %q (have %s)", e, strings.Join(chatEvents, ", "))
+		}
+	}
+	return nil
+}
+
+// notifyChat posts headline and body to the configured webhooks if event is enabled.
+func notifyChat(cfg Config, event, headline, body string) []error {
+	if cfg.DiscordWebhook == "" && cfg.SlackWebhook == "" || !grafanaEventEnabled(cfg.ChatEvents, event) {
+		return nil
+	}
+	var errs []error
+	if cfg.DiscordWebhook != "" {
+		msg := "**" + headline + "**"
+		if body != "" {
+			msg += "\n```\n" + body + "\n```"
+		}
+		if err := postChatWebhook(cfg.DiscordWebhook, map[string]string{"content": msg}); err != nil {
+			errs = append(errs, fmt.Errorf("Discord: %v", err))
+		}
+	}
+	if cfg.SlackWebhook != "" {
+		msg := "*" + headline + "*"
+		if body != "" {
+			msg += "\n```" + body + "```"
+		}
+		if err := postChatWebhook(cfg.SlackWebhook, map[string]string{"text": msg}); err != nil {
+			errs = append(errs, fmt.Errorf("Slack: %v", err))
+		}
+	}
+	return errs
+}
+
+// postChatWebhook posts payload as JSON to an incoming webhook.
+func postChatWebhook(hook string, payload interface{}) error {
+	if processSettings.offline {
+		return errOffline
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), chatTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", hook, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("invalid webhook URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err // its URL holds the webhook's secret
+		}
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package cfst
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -format clash renders each usable result through -clash-template into a Clash proxy list.
+
+// FormatClash is the Clash proxy-provider result format.
+const FormatClash = "clash"
+
+// loadClashTemplate reads and checks a -clash-template file.
+func loadClashTemplate(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	tmpl := strings.TrimRight(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n")
+	if !strings.Contains(tmpl, "{ip}") {
+		return "", fmt.Errorf("%s: the template must use {ip}", path)
+	}
+	if strings.Contains(tmpl, "\t") {
+		return "", fmt.Errorf("%s: YAML can't be indented with tabs", path)
+	}
+	hasName := false
+	for _, line := range strings.Split(tmpl, "\n") {
+		if strings.HasPrefix(line, "name:") {
+			hasName = true
+		}
+	}
+	if !hasName {
+		tmpl = `name: "CF {colo} {ip}"` + "\n" + tmpl
+	}
+	return tmpl, nil
+}
+
+// formatClash renders the usable results through tmpl as a provider file.
+func formatClash(results []NodeResult, tmpl string, at time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by cfst %s at %s\n", version, at.Format(time.RFC3339))
+	usable := topUsable(results, 0)
+	if len(usable) == 0 {
+		b.WriteString("proxies: []\n")
+		return b.String()
+	}
+	b.WriteString("proxies:\n")
+	for i, r := range usable {
+		entry := strings.NewReplacer(
+			"{ip}", r.IP,
+			"{port}", strconv.Itoa(r.Port),
+			"{colo}", r.Colo,
+			"{speed}", strconv.FormatFloat(r.DownloadSpeed, 'f', 2, 64),
+			"{latency}", strconv.FormatFloat(r.TCPLatency, 'f', 1, 64),
+			"{n}", strconv.Itoa(i+1),
+		).Replace(tmpl)
+		for j, line := range strings.Split(entry, "\n") {
+			switch {
+			case j == 0:
+				b.WriteString("  - " + line + "\n")
+			case line == "":
+				b.WriteString("\n")
+			default:
+				b.WriteString("    " + line + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+func saveClash(cfg Config, results []NodeResult) {
+	tmpl, err := loadClashTemplate(cfg.ClashTemplate)
+	if err == nil {
+		err = os.WriteFile(cfg.Output, []byte(formatClash(results, tmpl, time.Now())), 0644)
+	}
+	if err != nil {
+		fmt.Println("Error saving Clash proxies:", err)
+	}
+}
@@ -0,0 +1,478 @@
+package cfst
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Main is the cfst command: the CLI, the web server or a subcommand.
+func Main() {
+	if len(os.Args) > 1 && os.Args[1] == "serve-target" {
+		if err := runServeTarget(os.Args[2:]); err != nil {
+			fmt.Println("serve-target:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "pick" {
+		if err := runPick(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "pick:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && presets[os.Args[1]] != nil {
+		// "cfst quick ..." is "cfst -preset quick ..."
+		os.Args = append([]string{os.Args[0], "-preset", os.Args[1]}, os.Args[2:]...)
+	}
+
+	cfg := DefaultConfig()
+
+	flag.IntVar(&cfg.Port, "p", cfg.Port, "Target port")
+	flag.IntVar(&cfg.MaxScan, "max", cfg.MaxScan, "Max IPs to scan")
+	flag.IntVar(&cfg.TopN, "topn", cfg.TopN, "Top N candidates by latency for speed test")
+	flag.IntVar(&cfg.DLConc, "dlc", cfg.DLConc, "Parallel download test concurrency")
+	flag.IntVar(&cfg.DownloadNum, "dn", cfg.DownloadNum, "Download test count")
+	flag.IntVar(&cfg.Duration, "dt", cfg.Duration, "Download duration (seconds)")
+	flag.Float64Var(&cfg.StopThreshold, "st", cfg.StopThreshold, "Stop threshold MB/s (CF URL mode only)")
+	flag.BoolVar(&cfg.Unique, "u", cfg.Unique, "Unique C-subnet")
+	flag.StringVar(&cfg.IPFile, "f", cfg.IPFile, "Custom IP file")
+	flag.StringVar(&cfg.IPURL, "ip-url", cfg.IPURL, "Download the IP/CIDR list from this URL")
+	flag.StringVar(&cfg.Strategy, "strategy", cfg.Strategy, "IP sampling: uniform, coarse-fine (sparse pass first, then focus on the best /16s)")
+	flag.BoolVar(&cfg.AllIP, "allip", cfg.AllIP, "Scan every IP of the ranges instead of sampling -max of them")
+	flag.BoolVar(&cfg.TLSPing, "tlsping", cfg.TLSPing, "Measure latency as TCP connect + TLS handshake (for networks that intercept SYNs)")
+	flag.BoolVar(&cfg.TraceFirst, "trace-first", cfg.TraceFirst, "Check colo and blocking with one trace request before each download, skipping blocked IPs")
+	flag.BoolVar(&cfg.ProbeDPI, "dpi", cfg.ProbeDPI, "Probe each tested IP for ISP interference (TCP vs TLS vs first-byte failures)")
+	flag.DurationVar(&cfg.CacheTTL, "cache-ttl", cfg.CacheTTL, "Reuse per-IP download results younger than this instead of re-measuring (e.g. 6h, 0 = off)")
+	flag.StringVar(&cfg.CacheFile, "cache-file", cfg.CacheFile, "Result cache file for -cache-ttl")
+	flag.IntVar(&cfg.Expand, "expand", cfg.Expand, "After the download test, scan the /24 around the top N IPs and test the best neighbors (0 = off)")
+	flag.IntVar(&cfg.ExpandTest, "expand-test", cfg.ExpandTest, "Neighbors to download-test during -expand")
+	flag.StringVar(&cfg.FeedURL, "feed", cfg.FeedURL, "Subscribe to a signed community range feed (HTTPS JSON); half of -max is sampled from its ranges")
+	flag.StringVar(&cfg.FeedKey, "feed-key", cfg.FeedKey, "Base64 ed25519 public key the -feed document must be signed with")
+	flag.StringVar(&cfg.FeedRegion, "feed-region", cfg.FeedRegion, "Comma-separated -feed regions to use (default: all)")
+	flag.StringVar(&cfg.FeedISP, "feed-isp", cfg.FeedISP, "Comma-separated -feed ISPs to use (default: all)")
+	flag.DurationVar(&cfg.FeedTTL, "feed-ttl", cfg.FeedTTL, "Re-fetch -feed once the cached copy is older than this")
+	flag.StringVar(&cfg.FeedCache, "feed-cache", cfg.FeedCache, "File the verified -feed document is cached in (empty = no cache)")
+	flag.IntVar(&cfg.HistorySeed, "history-seed", cfg.HistorySeed, "Also re-test the top N IPs recorded in -history")
+	flag.StringVar(&cfg.Output, "o", cfg.Output, "Output file")
+	flag.BoolVar(&cfg.JSONL, "jsonl", cfg.JSONL, "Stream each completed test to stdout as one JSON object per line; progress and status go to stderr")
+	flag.BoolVar(&cfg.LiveTop, "live-top", cfg.LiveTop, "Show the download test as a live leaderboard of the top -dn results, redrawn in score order after each result (needs an ANSI terminal)")
+	flag.StringVar(&cfg.DBFile, "db", cfg.DBFile, "Append every run (results, config, summary) to this SQLite database; needs the sqlite3 command")
+	flag.StringVar(&cfg.BindOut, "bind-out", cfg.BindOut, "Also write the top results as BIND zone records (A/AAAA) to this file")
+	flag.StringVar(&cfg.BestOut, "best-out", cfg.BestOut, "Write the best result to this file: its IP, or ip:port when it was measured on a port other than 443")
+	flag.BoolVar(&cfg.Check443, "check-443", cfg.Check443, "With -p other than 443, also check port 443 on each result; -bind-out A records and DNS rewrites then only use IPs that answer there")
+	flag.StringVar(&cfg.BindName, "bind-name", cfg.BindName, "Owner name of the -bind-out records, e.g. cf or cf.example.com.")
+	flag.IntVar(&cfg.BindTTL, "bind-ttl", cfg.BindTTL, "TTL of the -bind-out records in seconds")
+	flag.IntVar(&cfg.BindTop, "bind-top", cfg.BindTop, "Number of results written to -bind-out (0 = all)")
+	flag.StringVar(&cfg.DnsmasqOut, "dnsmasq-out", cfg.DnsmasqOut, "Also write dnsmasq address=/domain/IP lines for -rewrite-domains to this file")
+	flag.StringVar(&cfg.AdGuardOut, "adguard-out", cfg.AdGuardOut, "Also write AdGuard Home rewrites (JSON) for -rewrite-domains to this file")
+	flag.StringVar(&cfg.RewriteDomains, "rewrite-domains", cfg.RewriteDomains, "Comma-separated domains -dnsmasq-out/-adguard-out point at the best IPs")
+	flag.IntVar(&cfg.RewriteTop, "rewrite-top", cfg.RewriteTop, "Number of best IPs each rewrite domain gets")
+	flag.StringVar(&cfg.HostsDomains, "hosts-domains", cfg.HostsDomains, "Comma-separated domains pointed at the best IP in a marked block of -hosts-file")
+	flag.StringVar(&cfg.HostsFile, "hosts-file", cfg.HostsFile, "Hosts file -hosts-domains and -hosts-clean edit")
+	hostsClean := flag.Bool("hosts-clean", false, "Remove the cfst block from -hosts-file and exit")
+	flag.StringVar(&cfg.DDNSZone, "ddns-zone", cfg.DDNSZone, "Point -ddns-record in this Cloudflare zone (name or ID) at the best IP after each run (token from CFST_DDNS_TOKEN)")
+	flag.StringVar(&cfg.DDNSRecord, "ddns-record", cfg.DDNSRecord, "Comma-separated record names for -ddns-zone, full or relative to the zone; A for an IPv4 result, AAAA for IPv6")
+	flag.StringVar(&cfg.SingBoxTemplate, "singbox-template", cfg.SingBoxTemplate, "sing-box config whose outbounds get the best IPs as their server after each run; needs -singbox-out")
+	flag.StringVar(&cfg.SingBoxOut, "singbox-out", cfg.SingBoxOut, "File the patched sing-box config is written to (atomically)")
+	flag.StringVar(&cfg.SingBoxTags, "singbox-tags", cfg.SingBoxTags, "Comma-separated tags of the outbounds to patch, best IP first (default: every outbound with a server)")
+	flag.StringVar(&cfg.SingBoxReload, "singbox-reload", cfg.SingBoxReload, "Reload sing-box after writing: hup:<pid or pid file>, or its Clash API URL, e.g. http://127.0.0.1:9090 (secret from CFST_SINGBOX_SECRET)")
+	flag.StringVar(&cfg.XrayConfig, "xray-config", cfg.XrayConfig, "Xray/V2Ray config file whose -xray-tag outbounds get the best IP as their address after each run (replaced atomically)")
+	flag.StringVar(&cfg.XrayTag, "xray-tag", cfg.XrayTag, "Comma-separated tags of the -xray-config outbounds to patch")
+	flag.StringVar(&cfg.XrayRestart, "xray-restart", cfg.XrayRestart, "systemd unit to restart after -xray-config is rewritten, e.g. xray")
+	flag.StringVar(&cfg.TGToken, "tg-token", cfg.TGToken, "Telegram bot token; with -tg-chat, the top results are sent after each run (-daemon: when the best IP changes). Prefer CFST_TG_TOKEN")
+	flag.StringVar(&cfg.TGChat, "tg-chat", cfg.TGChat, "Telegram chat ID (or @channel) -tg-token sends to")
+	flag.StringVar(&cfg.DiscordWebhook, "discord-webhook", cfg.DiscordWebhook, "Post run reports to this Discord incoming-webhook URL, on the -chat-events")
+	flag.StringVar(&cfg.SlackWebhook, "slack-webhook", cfg.SlackWebhook, "Post run reports to this Slack incoming-webhook URL, on the -chat-events")
+	flag.StringVar(&cfg.ChatEvents, "chat-events", cfg.ChatEvents, "Events posted to -discord-webhook/-slack-webhook: complete, change (needs -history), blocked (comma separated)")
+	flag.StringVar(&cfg.Webhook, "webhook", cfg.Webhook, "POST each run's results as the JSON result document to this URL; CFST_WEBHOOK_SECRET signs it (X-CFST-Signature-256: sha256=<HMAC>)")
+	flag.BoolVar(&cfg.WebhookEveryRun, "webhook-every-run", cfg.WebhookEveryRun, "With -daemon, post to -webhook after every run instead of only when the best IP changes")
+	flag.DurationVar(&cfg.Deadline, "timeout", cfg.Deadline, "Stop the run after this long and keep what has been measured so far, e.g. 10m (0 = no limit)")
+	flag.BoolVar(&cfg.OfflineSources, "offline-sources", cfg.OfflineSources, "Forbid every network fetch besides the probes themselves: range lists, feeds, ECH DoH lookups, the own-location trace, telemetry, Grafana")
+	flag.BoolVar(&cfg.Silent, "silent", cfg.Silent, "Web mode: print only errors to stdout (no startup, job or idle lines), e.g. under journald")
+	flag.BoolVar(&cfg.Daemon, "daemon", cfg.Daemon, "Keep running and repeat the test every -interval; publishing and notifications run only when the best IP changes")
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "Time between -daemon runs, e.g. 6h")
+	flag.StringVar(&cfg.DaemonState, "daemon-state", cfg.DaemonState, "File the -daemon keeps the current best IP in, so a restart doesn't republish it (empty = memory only)")
+	flag.StringVar(&cfg.MetricsListen, "metrics-listen", cfg.MetricsListen, "With -daemon, serve Prometheus metrics of the last run at /metrics on this address, e.g. :9101 (web mode serves them on its own port)")
+	flag.StringVar(&cfg.TelemetryURL, "telemetry-url", cfg.TelemetryURL, "Opt in to POSTing an anonymized, differentially private summary of each run (range reachability, per-colo means; no IPs) to this URL")
+	flag.Float64Var(&cfg.TelemetryEps, "telemetry-epsilon", cfg.TelemetryEps, "Privacy budget ε per tested IP of -telemetry-url reports, split over the five values one IP affects; smaller adds more noise")
+	flag.StringVar(&cfg.Format, "format", cfg.Format, "Output format: csv, json or clash (default: json when -o ends in .json, clash when it ends in .yaml with -clash-template, else csv)")
+	flag.StringVar(&cfg.ClashTemplate, "clash-template", cfg.ClashTemplate, "YAML of one Clash proxy with {ip}, {port}, {colo}, {speed}, {latency} and {n} placeholders, for -format clash")
+	flag.BoolVar(&cfg.Raw, "raw", cfg.Raw, "CSV results at full precision, plus the download test's raw byte count and µs duration and the latency in µs")
+	flag.IntVar(&cfg.ScanConcurrent, "sc", cfg.ScanConcurrent, "Scan concurrency")
+	flag.BoolVar(&cfg.Skip429, "skip429", cfg.Skip429, "Discard 429 rate-limited IPs silently")
+	flag.StringVar(&cfg.URL, "url", cfg.URL, "Custom download test URL")
+	flag.IntVar(&cfg.QuickDuration, "qd", cfg.QuickDuration, "Quick pre-filter duration in seconds (custom URL mode)")
+	flag.StringVar(&cfg.FilterMode, "filter", cfg.FilterMode, "Candidate filter mode (speed, multi-colo, none)")
+	flag.StringVar(&cfg.SNI, "sni", cfg.SNI, "Custom TLS SNI (ServerName)")
+	flag.DurationVar(&cfg.DialKeepAlive, "keepalive", cfg.DialKeepAlive, "TCP keep-alive interval of connections to tested IPs")
+	flag.IntVar(&cfg.MaxIdlePerHost, "idle-conns", cfg.MaxIdlePerHost, "Idle connections kept per tested IP for reuse between phases")
+	flag.DurationVar(&cfg.IdleConnTTL, "idle-conn-timeout", cfg.IdleConnTTL, "How long an idle connection to a tested IP is kept")
+	flag.IntVar(&cfg.TLSSessions, "tls-session-cache", cfg.TLSSessions, "Shared TLS session cache size so later handshakes can resume (0 = off)")
+	flag.StringVar(&cfg.TargetOverride, "target-override", cfg.TargetOverride, "Connect to this host:port instead of the tested IPs, e.g. a local test server (testing only)")
+	flag.StringVar(&cfg.NAT64, "nat64", cfg.NAT64, "On an IPv6-only network, dial IPv4 addresses through NAT64: auto (prefix from ipv4only.arpa) or a /96 prefix such as 64:ff9b::/96")
+	flag.BoolVar(&cfg.NoDelay, "nodelay", cfg.NoDelay, "Set TCP_NODELAY on connections to tested IPs (-nodelay=false enables Nagle)")
+	flag.DurationVar(&cfg.TCPUserTimeout, "tcp-user-timeout", cfg.TCPUserTimeout, "Drop a connection whose sent data stays unacknowledged this long, e.g. 5s (Linux, macOS, Windows; 0 = OS default)")
+	flag.BoolVar(&cfg.FastOpen, "tfo", cfg.FastOpen, "Use TCP Fast Open for connections to tested IPs (Linux)")
+	flag.StringVar(&cfg.Redirect, "redirect", cfg.Redirect, "Redirects on tested IPs: follow (same IP and SNI) or error (count as failed)")
+	flag.IntVar(&cfg.MaxRedirects, "max-redirects", cfg.MaxRedirects, "Hop limit for -redirect follow")
+	flag.StringVar(&cfg.Resolve, "resolve", cfg.Resolve, "Comma-separated host:ip or host:port:ip (like curl --resolve): requests to those hosts, e.g. a redirect target the tested IPs don't front, go to that address with the host as SNI")
+	flag.StringVar(&cfg.UserAgent, "ua", cfg.UserAgent, "Custom User-Agent (disables rotation)")
+	flag.StringVar(&cfg.UAFile, "ua-file", cfg.UAFile, "File of User-Agents (one per line) rotated per request")
+	flag.BoolVar(&cfg.UARotate, "ua-rotate", cfg.UARotate, "Rotate through the built-in User-Agent pool per request")
+	flag.StringVar(&cfg.OwnZone, "own-zone", cfg.OwnZone, "Test against a file on your own CF zone (host[/path]), overrides -url")
+	flag.BoolVar(&cfg.CachePrime, "cache-prime", cfg.CachePrime, "Prime the edge cache per IP before timing (custom URL mode)")
+	flag.IntVar(&cfg.Streams, "streams", cfg.Streams, "Concurrent download streams per IP")
+	flag.BoolVar(&cfg.HTTP2, "h2", cfg.HTTP2, "Multiplex -streams over one HTTP/2 connection")
+	flag.BoolVar(&cfg.ProbeResume, "resume", cfg.ProbeResume, "Measure TLS session resumption (resumed vs full handshake) per IP")
+	flag.StringVar(&cfg.Proxy, "proxy", cfg.Proxy, "Download-test through this local proxy (socks5://, http://; bare host:port is SOCKS5), e.g. a V2Ray/Xray inbound")
+	flag.StringVar(&cfg.ProxySwitch, "proxy-switch", cfg.ProxySwitch, "URL (GET) or command that points the proxy's outbound at {ip}:{port} before each test")
+	flag.BoolVar(&cfg.TraceFields, "trace-fields", cfg.TraceFields, "Record the egress IP, HTTP protocol, TLS version and warp status Cloudflare's trace reports for each tested IP")
+	flag.StringVar(&cfg.EgressChange, "egress-change", cfg.EgressChange, "Results measured from another public IP than most of the run (CGNAT rotation, reconnect): mark, drop or off")
+	flag.BoolVar(&cfg.ProbeCert, "cert-check", cfg.ProbeCert, "Record each tested IP's certificate subject/SAN/issuer and flag SNI mismatches and unexpected issuers")
+	flag.StringVar(&cfg.CertIssuers, "cert-issuers", cfg.CertIssuers, "Issuer organizations -cert-check accepts (comma separated)")
+	flag.BoolVar(&cfg.ProbeECH, "ech", cfg.ProbeECH, "Probe Encrypted ClientHello support per IP")
+	flag.StringVar(&cfg.ECHDomain, "ech-domain", cfg.ECHDomain, "Domain whose HTTPS record provides the ECH config (also the inner SNI)")
+	flag.StringVar(&cfg.ECHConfig, "ech-config", cfg.ECHConfig, "Base64 ECHConfigList to use instead of the DNS lookup")
+	flag.StringVar(&cfg.WSURL, "ws-url", cfg.WSURL, "WebSocket echo endpoint (wss://host/path) probed through each tested IP")
+	flag.StringVar(&cfg.GRPCURL, "grpc-url", cfg.GRPCURL, "gRPC endpoint (https://host/Service/Method) probed with a long-lived HTTP/2 stream")
+	flag.DurationVar(&cfg.GRPCHold, "grpc-hold", cfg.GRPCHold, "How long the gRPC probe keeps its stream open")
+	flag.IntVar(&cfg.Verify, "verify", cfg.Verify, "Re-run the download test of the top 5 IPs this many more times and rank them by the mean (0 = off)")
+	flag.DurationVar(&cfg.Longevity, "longevity", cfg.Longevity, "Hold a slow transfer to the top IPs this long and record stalls/resets (e.g. 3m)")
+	flag.IntVar(&cfg.LongevityN, "longevity-n", cfg.LongevityN, "Number of top results given the longevity test")
+	flag.StringVar(&cfg.HistoryFile, "history", cfg.HistoryFile, "Append every run's measurements to this JSON-lines history file")
+	flag.Float64Var(&cfg.AlertDrop, "alert-drop", cfg.AlertDrop, "Alert when the fleet median speed drops by this fraction vs the -history baseline (0 = off)")
+	flag.StringVar(&cfg.GrafanaURL, "grafana-url", cfg.GrafanaURL, "Post Grafana annotations to this base URL (token from CFST_GRAFANA_TOKEN)")
+	flag.StringVar(&cfg.GrafanaEvents, "grafana-events", cfg.GrafanaEvents, "Annotate on: complete, change (comma separated)")
+	flag.StringVar(&cfg.WebTokensFile, "web-tokens", cfg.WebTokensFile, "Web mode: file of '<token> <namespace>' lines; API calls need a token and get separate history/cache")
+	flag.IntVar(&cfg.MemTopK, "mem-topk", cfg.MemTopK, "Keep only the N lowest-latency scan results in memory (0 = 2x -topn, all the filters use)")
+	flag.BoolVar(&cfg.Spill, "spill", cfg.Spill, "Write every valid scan result to a JSON-lines temp file")
+	flag.IntVar(&cfg.WebJobs, "web-jobs", cfg.WebJobs, "Web mode: tests allowed to run at once; further requests queue and get position/ETA events")
+	flag.DurationVar(&cfg.IdleTimeout, "idle", cfg.IdleTimeout, "Web mode: release caches after this long without jobs, e.g. 10m (0 = off)")
+	flag.BoolVar(&cfg.IdleExit, "idle-exit", cfg.IdleExit, "Web mode: exit once -idle passes (for systemd socket activation)")
+	flag.StringVar(&cfg.AuditLog, "audit-log", cfg.AuditLog, "Web mode: append job start/end, requester and outcome to this JSON-lines file (served at /api/audit)")
+	flag.Float64Var(&cfg.MinSpeed, "sl", cfg.MinSpeed, "Only keep results of at least this many MB/s; testing continues until -dn of them are found (0 = off)")
+	flag.Float64Var(&cfg.JitterWeight, "jitter-weight", cfg.JitterWeight, "Rank scan results by latency + this × jitter, e.g. 2 to favor steady IPs for interactive traffic (0 = latency only)")
+	flag.IntVar(&cfg.Pings, "n", cfg.Pings, "TCP pings per IP during the scan; more pings give a finer loss rate, which lowers the score")
+	flag.Float64Var(&cfg.MaxLatency, "tl", cfg.MaxLatency, "Drop IPs whose scan latency exceeds this many ms before colo detection and download (0 = off)")
+	flag.StringVar(&cfg.CFColo, "cfcolo", cfg.CFColo, "Only keep IPs in these colos, e.g. HKG,NRT,SJC; scans more IPs until -topn are found")
+	pinList := flag.String("pin", "", "Comma-separated IPs always scanned and download-tested, e.g. the IP in production")
+	flag.StringVar(&cfg.PinFile, "pin-file", cfg.PinFile, "File of IPs (one per line, # comments) always scanned and download-tested")
+	neverSelect := flag.String("never-select", "", "Comma-separated IPs/CIDRs that may be measured but are never recommended (withheld from the results, history and integrations)")
+	flag.StringVar(&cfg.NeverSelectFile, "never-select-file", cfg.NeverSelectFile, "File of IPs/CIDRs (one per line, # comments) added to -never-select")
+	flag.StringVar(&cfg.RulesFile, "rules", cfg.RulesFile, "Post-processing rules file (drop/keep/rank/keep-previous) applied to the final results")
+	flag.StringVar(&cfg.PluginSource, "plugin-source", cfg.PluginSource, "ip-source exec plugin: command that rewrites the IP list (JSON on stdin/stdout)")
+	flag.StringVar(&cfg.PluginFilter, "plugin-filter", cfg.PluginFilter, "result-filter exec plugin: command that rewrites the final results (JSON on stdin/stdout)")
+	flag.StringVar(&cfg.PluginExporter, "plugin-exporter", cfg.PluginExporter, "exporter exec plugin: command that receives the final results and summary as JSON")
+	reportTOD := flag.Bool("report-tod", false, "Print a time-of-day speed report from -history and exit")
+	reportBy := flag.String("report-by", "colo", "Group the time-of-day report by colo or ip")
+	flag.Func("dl-interval", "Pause between download tests, with optional jitter (e.g. 2s or 2s±1s)", func(v string) error {
+		var err error
+		cfg.DLInterval, cfg.DLJitter, err = parseInterval(v)
+		return err
+	})
+
+	flag.StringVar(&cfg.Geo, "geo", cfg.Geo, "Your location for the colo detour check: lat,lon or a country code (default: from the trace; off to disable)")
+	flag.Func("lat-buckets", "Latency histogram bucket bounds in ms (default 50,100,150,200,300,500)", func(v string) error {
+		var err error
+		cfg.LatBuckets, err = parseLatencyBuckets(v)
+		return err
+	})
+
+	webMode := false
+	webPort := "9876"
+	if len(os.Args) > 0 {
+		var newArgs []string
+		newArgs = append(newArgs, os.Args[0])
+		for i := 1; i < len(os.Args); i++ {
+			if os.Args[i] == "-web" {
+				webMode = true
+				if i+1 < len(os.Args) && !strings.HasPrefix(os.Args[i+1], "-") {
+					webPort = os.Args[i+1]
+					i++
+				}
+			} else {
+				newArgs = append(newArgs, os.Args[i])
+			}
+		}
+		os.Args = newArgs
+	}
+
+	flag.StringVar(&cfg.Preset, "preset", cfg.Preset, "Settings bundle: "+presetNames()+" (also a subcommand, e.g. cfst quick)")
+	flag.BoolVar(&cfg.LowMem, "low-mem", cfg.LowMem, "Low-resource profile for 128 MB routers and Termux (explicit flags still win)")
+	flag.StringVar(&cfg.CPULimit, "cpu", cfg.CPULimit, "Use at most this share of the CPUs, e.g. 50% or 2, so the router keeps forwarding smoothly")
+	flag.Bool("web", false, "Start Web UI server (-web <port>)")
+	configFile := flag.String("config", "", "Load options from this YAML or TOML file (keys are flag names); command-line flags win")
+	flag.Parse()
+
+	set := map[string]bool{} // flags given on the command line, then those from CFST_* and -config
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	unknownEnv, err := applyEnv(set)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	for _, env := range unknownEnv {
+		fmt.Printf("[!] Ignoring %s: no such option\n", env)
+	}
+	if *configFile != "" {
+		if err := applyConfigFile(*configFile, set); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.JSONL && !webMode {
+		startJSONL()
+	}
+	if cfg.Preset != "" {
+		if err := applyPreset(cfg.Preset, &cfg, set); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.LowMem {
+		applyLowMem(&cfg, set)
+	}
+	if cfg.Pings < 1 {
+		fmt.Println("Error: -n must be at least 1")
+		os.Exit(1)
+	}
+	if cfg.CPULimit != "" {
+		if err := applyCPULimit(&cfg, set); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	if cfg.OwnZone != "" {
+		u, err := buildOwnZoneURL(cfg.OwnZone)
+		if err != nil {
+			fmt.Println("Error building -own-zone URL:", err)
+			os.Exit(1)
+		}
+		cfg.URL = u
+	}
+	if err := checkTestURL(cfg.URL); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if err := processSettings.configureUserAgents(cfg); err != nil {
+		fmt.Println("Error loading User-Agents:", err)
+		os.Exit(1)
+	}
+	processSettings.configureTransports(cfg)
+	if err := processSettings.configureResolve(cfg); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	for _, note := range processSettings.configureSockets(cfg) {
+		fmt.Println("[!] " + note)
+	}
+	jobs := 1
+	if webMode {
+		jobs = cfg.WebJobs
+	}
+	if note := fitConcurrency(&cfg, jobs); note != "" {
+		fmt.Println("[!] " + note)
+	}
+	if err := processSettings.configureRedirects(cfg); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if cfg.Proxy != "" {
+		if _, err := parseProxyURL(cfg.Proxy); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if cfg.ProxySwitch == "" {
+			fmt.Println("[!] -proxy without -proxy-switch: every IP is measured through the proxy's current outbound")
+		}
+		cfg.DLConc = 1 // one outbound to switch
+	}
+	if err := validResultFormat(cfg.Format); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if resultFormat(cfg) == FormatClash {
+		if cfg.ClashTemplate == "" {
+			fmt.Println("Error: -format clash needs -clash-template")
+			os.Exit(1)
+		}
+		if _, err := loadClashTemplate(cfg.ClashTemplate); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	if err := validEgressMode(cfg.EgressChange); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if cfg.OfflineSources {
+		if bad := offlineConflicts(cfg); len(bad) > 0 {
+			fmt.Printf("Error: -offline-sources forbids %s\n", strings.Join(bad, ", "))
+			os.Exit(1)
+		}
+		processSettings.offline = true
+	}
+	if err := processSettings.configureNAT64(cfg); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if cfg.FeedURL != "" {
+		if _, err := parseFeedKey(cfg.FeedKey); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.DDNSZone != "" {
+		if cfg.DDNSRecord == "" {
+			fmt.Println("Error: -ddns-zone needs -ddns-record")
+			os.Exit(1)
+		}
+		if cfg.DDNSToken == "" {
+			fmt.Println("Error: -ddns-zone needs a Cloudflare API token in CFST_DDNS_TOKEN")
+			os.Exit(1)
+		}
+	}
+	if cfg.SingBoxTemplate != "" {
+		if cfg.SingBoxOut == "" {
+			fmt.Println("Error: -singbox-template needs -singbox-out")
+			os.Exit(1)
+		}
+		if _, err := loadSingBoxTemplate(cfg.SingBoxTemplate, cfg.SingBoxTags); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if cfg.SingBoxReload != "" {
+			if err := checkSingBoxReload(cfg.SingBoxReload); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		}
+	}
+	if cfg.XrayConfig != "" {
+		if cfg.XrayTag == "" {
+			fmt.Println("Error: -xray-config needs -xray-tag")
+			os.Exit(1)
+		}
+		if _, err := loadXrayConfig(cfg.XrayConfig, cfg.XrayTag); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	if err := checkChatEvents(cfg.ChatEvents); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if (cfg.TGToken == "") != (cfg.TGChat == "") {
+		fmt.Println("Error: -tg-token and -tg-chat go together")
+		os.Exit(1)
+	}
+	if cfg.Silent && !webMode {
+		fmt.Println("Error: -silent is a -web option")
+		os.Exit(1)
+	}
+	if cfg.Daemon && webMode {
+		fmt.Println("Error: -daemon is a CLI mode and cannot be combined with -web")
+		os.Exit(1)
+	}
+	if cfg.Daemon && cfg.Interval <= 0 {
+		fmt.Println("Error: -interval must be greater than 0")
+		os.Exit(1)
+	}
+	if cfg.MetricsListen != "" && !cfg.Daemon {
+		fmt.Println("Error: -metrics-listen needs -daemon; -web serves /metrics on its own port")
+		os.Exit(1)
+	}
+	if cfg.WebhookEveryRun && (!cfg.Daemon || cfg.Webhook == "") {
+		fmt.Println("Error: -webhook-every-run needs -daemon and -webhook")
+		os.Exit(1)
+	}
+	if cfg.TelemetryURL != "" && cfg.TelemetryEps <= 0 {
+		fmt.Println("Error: -telemetry-epsilon must be greater than 0")
+		os.Exit(1)
+	}
+	if *pinList != "" {
+		ips, err := parsePinList(*pinList)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		cfg.PinIPs = append(cfg.PinIPs, ips...)
+	}
+	if cfg.PinFile != "" {
+		ips, err := loadPinFile(cfg.PinFile)
+		if err != nil {
+			fmt.Println("Error loading pin file:", err)
+			os.Exit(1)
+		}
+		cfg.PinIPs = append(cfg.PinIPs, ips...)
+	}
+	if *neverSelect != "" {
+		m, err := parseIPMatcher(*neverSelect)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		cfg.NeverSelect = append(cfg.NeverSelect, m...)
+	}
+	if cfg.NeverSelectFile != "" {
+		m, err := loadIPMatcherFile(cfg.NeverSelectFile)
+		if err != nil {
+			fmt.Println("Error loading never-select file:", err)
+			os.Exit(1)
+		}
+		cfg.NeverSelect = append(cfg.NeverSelect, m...)
+	}
+	if cfg.RulesFile != "" {
+		rules, err := loadRules(cfg.RulesFile)
+		if err != nil {
+			fmt.Println("Error loading rules:", err)
+			os.Exit(1)
+		}
+		cfg.Rules = rules
+	}
+
+	if *hostsClean {
+		removed, err := cleanHosts(cfg.HostsFile)
+		switch {
+		case err != nil:
+			fmt.Println("Error cleaning hosts file:", err)
+			os.Exit(1)
+		case removed:
+			fmt.Printf("Removed the cfst block from %s\n", cfg.HostsFile)
+		default:
+			fmt.Printf("No cfst block in %s\n", cfg.HostsFile)
+		}
+		return
+	}
+
+	if *reportTOD {
+		if cfg.HistoryFile == "" {
+			fmt.Println("Error: -report-tod requires -history <file>")
+			os.Exit(1)
+		}
+		records, err := loadHistory(cfg.HistoryFile)
+		if err != nil {
+			fmt.Println("Error reading history:", err)
+			os.Exit(1)
+		}
+		printTimeOfDayReport(timeOfDayReport(records, *reportBy == "ip"), *reportBy == "ip")
+		return
+	}
+
+	if webMode {
+		cfg.WebMode = true
+		cfg.WebPort = webPort
+		if !strings.Contains(cfg.WebPort, ":") {
+			cfg.WebPort = ":" + cfg.WebPort
+		}
+		RunWeb(cfg)
+	} else {
+		RunCLI(cfg)
+	}
+}
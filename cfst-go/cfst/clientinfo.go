@@ -0,0 +1,130 @@
+package cfst
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Web clients get the server's own trace unless they connect from a public address.
+
+const traceCacheTTL = 10 * time.Minute
+
+// ClientDefaults is the /api/defaults response.
+type ClientDefaults struct {
+	ClientIP  string            `json:"client_ip"`
+	PublicIP  string            `json:"public_ip"`
+	Loc       string            `json:"loc"`
+	Colo      string            `json:"colo"`
+	Suggested SuggestedDefaults `json:"suggested"`
+}
+
+// SuggestedDefaults are region-appropriate starting points for the form.
+type SuggestedDefaults struct {
+	Filter   string   `json:"filter"`
+	Strategy string   `json:"strategy"`
+	DLI      string   `json:"dli,omitempty"`
+	Colos    []string `json:"colos,omitempty"` // colos that usually serve this region best
+	Note     string   `json:"note,omitempty"`
+}
+
+var (
+	traceMu      sync.Mutex
+	traceCached  map[string]string
+	traceFetched time.Time
+)
+
+// localTrace returns this host's cdn-cgi/trace pairs, cached for traceCacheTTL.
+func localTrace(ctx context.Context) (map[string]string, error) {
+	if settingsOf(ctx).offline {
+		return nil, errOffline
+	}
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	if traceCached != nil && time.Since(traceFetched) < traceCacheTTL {
+		return traceCached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := newCFRequestWithContext(ctx, "GET", "https://speed.cloudflare.com/cdn-cgi/trace")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	trace, err := parseTrace(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	traceCached, traceFetched = trace, time.Now()
+	return trace, nil
+}
+
+// regionColos lists colos that commonly serve a country better than the nearest one.
+var regionColos = map[string][]string{
+	"CN": {"HKG", "SJC", "LAX", "NRT", "SIN"},
+	"HK": {"HKG", "NRT", "SIN"},
+	"TW": {"TPE", "HKG", "NRT"},
+	"JP": {"NRT", "KIX", "HKG"},
+	"KR": {"ICN", "NRT", "HKG"},
+	"SG": {"SIN", "HKG"},
+	"IR": {"FRA", "AMS", "IST"},
+	"RU": {"FRA", "AMS", "HEL", "ARN"},
+}
+
+// suggestDefaults picks form defaults for a country code and nearest colo.
+func suggestDefaults(loc, colo string) SuggestedDefaults {
+	s := SuggestedDefaults{Filter: "multi-colo", Strategy: "uniform"}
+	if colos, ok := regionColos[loc]; ok {
+		s.Colos = colos
+	} else if colo != "" {
+		s.Colos = []string{colo}
+	}
+	switch loc {
+	case "CN":
+		s.Filter = "speed"
+		s.Strategy = "coarse-fine"
+		s.DLI = "2s±1s"
+		s.Note = "Cloudflare traffic from mainland China is heavily rate-limited and often routed far away; pace downloads and prefer a custom URL."
+	case "IR", "RU":
+		s.Filter = "speed"
+		s.Note = "Interference is common on this network; consider enabling the DPI probe."
+	}
+	return s
+}
+
+// isPrivateAddr reports whether ip is a loopback, private or link-local address.
+func isPrivateAddr(ip string) bool {
+	addr := net.ParseIP(ip)
+	return addr == nil || addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast()
+}
+
+// clientDefaults describes the client behind r.
+func clientDefaults(r *http.Request) ClientDefaults {
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" && isPrivateAddr(client) {
+		// Behind a local reverse proxy the first hop is the real client.
+		client = strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	d := ClientDefaults{ClientIP: client}
+	if trace, err := localTrace(r.Context()); err == nil {
+		d.PublicIP, d.Loc, d.Colo = trace["ip"], trace["loc"], trace["colo"]
+	}
+	if !isPrivateAddr(client) {
+		// A remote client's region can't be read from our trace.
+		d.PublicIP, d.Loc = client, ""
+	}
+	d.Suggested = suggestDefaults(d.Loc, d.Colo)
+	return d
+}
@@ -0,0 +1,156 @@
+package cfst
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// defaultCoarseRatio is the share of -max spent on the sparse first pass.
+const defaultCoarseRatio = 0.2
+
+// CoarseFineSource samples all ranges sparsely, then spends the rest on the best /16s.
+type CoarseFineSource struct {
+	Ranges      []string // nil means the embedded list
+	Port        int
+	Concurrency int
+	Unique      bool
+	CoarseRatio float64 // 0 means defaultCoarseRatio
+}
+
+// rangeBlock is a range, or a /16-sized slice of a larger one.
+type rangeBlock struct {
+	cidr string
+	key  string // enclosing /16, e.g. "104.16"
+}
+
+// splitRangeBlocks splits ranges into blocks that each lie within one /16.
+func splitRangeBlocks(ranges []string) []rangeBlock {
+	var blocks []rangeBlock
+	for _, r := range ranges {
+		_, ipNet, err := net.ParseCIDR(r)
+		if err != nil {
+			if ip := net.ParseIP(r).To4(); ip != nil {
+				blocks = append(blocks, rangeBlock{cidr: r, key: fmt.Sprintf("%d.%d", ip[0], ip[1])})
+			}
+			continue
+		}
+		ones, bits := ipNet.Mask.Size()
+		base := ipNet.IP.To4()
+		if base == nil || bits != 32 {
+			continue
+		}
+		if ones >= 16 {
+			blocks = append(blocks, rangeBlock{cidr: r, key: fmt.Sprintf("%d.%d", base[0], base[1])})
+			continue
+		}
+		start := binary.BigEndian.Uint32(base)
+		for i := uint32(0); i < 1<<uint(16-ones); i++ {
+			var b [4]byte
+			binary.BigEndian.PutUint32(b[:], start+i<<16)
+			blocks = append(blocks, rangeBlock{cidr: fmt.Sprintf("%d.%d.0.0/16", b[0], b[1]), key: fmt.Sprintf("%d.%d", b[0], b[1])})
+		}
+	}
+	return blocks
+}
+
+func (s CoarseFineSource) IPs(ctx context.Context, budget int) ([]string, error) {
+	ranges := s.Ranges
+	if ranges == nil {
+		ranges = CloudflareIPv4Ranges
+	}
+	ratio := s.CoarseRatio
+	if ratio <= 0 || ratio >= 1 {
+		ratio = defaultCoarseRatio
+	}
+	blocks := splitRangeBlocks(ranges)
+	cidrs := make([]string, len(blocks))
+	keyOf := make(map[string]string, len(blocks))
+	for i, b := range blocks {
+		cidrs[i] = b.cidr
+		keyOf[b.cidr] = b.key
+	}
+
+	coarseN := max(int(float64(budget)*ratio), 1)
+	coarse := sampleIPs(cidrs, coarseN, s.Unique)
+	alive := ScanPing(ctx, coarse, s.Port, max(s.Concurrency, 1), nil)
+	if err := ctx.Err(); err != nil {
+		return coarse, err
+	}
+
+	type regionStat struct {
+		probes, hits int
+		latSum       float64
+	}
+	stats := make(map[string]*regionStat)
+	regionOf := func(ip string) string {
+		v4 := net.ParseIP(ip).To4()
+		if v4 == nil {
+			return ""
+		}
+		return fmt.Sprintf("%d.%d", v4[0], v4[1])
+	}
+	for _, ip := range coarse {
+		k := regionOf(ip)
+		if stats[k] == nil {
+			stats[k] = &regionStat{}
+		}
+		stats[k].probes++
+	}
+	for _, n := range alive {
+		st := stats[regionOf(n.IP)]
+		st.hits++
+		st.latSum += n.TCPLatency
+	}
+
+	type region struct {
+		key    string
+		weight float64
+	}
+	var regions []region
+	for k, st := range stats {
+		if st.hits == 0 {
+			continue
+		}
+		hitRate := float64(st.hits) / float64(st.probes)
+		avgLat := st.latSum / float64(st.hits)
+		regions = append(regions, region{k, hitRate / (avgLat + 1)})
+	}
+	// Fall back to uniform sampling when the coarse pass found nothing.
+	if len(regions) == 0 {
+		return sampleIPs(ranges, budget, s.Unique), nil
+	}
+	sort.Slice(regions, func(i, j int) bool { return regions[i].weight > regions[j].weight })
+	regions = regions[:max(len(regions)/2, 1)] // keep the better half
+
+	var total float64
+	for _, r := range regions {
+		total += r.weight
+	}
+
+	ips := make([]string, 0, budget)
+	seen := make(map[string]bool)
+	for _, n := range alive {
+		seen[n.IP] = true
+		ips = append(ips, n.IP)
+	}
+	remaining := budget - len(ips)
+	for _, r := range regions {
+		var regionCIDRs []string
+		for _, c := range cidrs {
+			if keyOf[c] == r.key {
+				regionCIDRs = append(regionCIDRs, c)
+			}
+		}
+		share := int(float64(remaining) * r.weight / total)
+		for _, ip := range sampleIPs(regionCIDRs, share, s.Unique) {
+			if !seen[ip] {
+				seen[ip] = true
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips, nil
+}
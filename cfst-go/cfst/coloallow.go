@@ -0,0 +1,92 @@
+package cfst
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// -cfcolo keeps only the IPs in allowed colos, scanning more until -topn of them turn up.
+
+const maxColoScanRounds = 5
+
+// parseColoList parses a comma-separated colo list; nil means no restriction.
+func parseColoList(s string) map[string]bool {
+	var allow map[string]bool
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.ToUpper(strings.TrimSpace(f)); f != "" {
+			if allow == nil {
+				allow = make(map[string]bool)
+			}
+			allow[f] = true
+		}
+	}
+	return allow
+}
+
+// detectAllowedColos returns the nodes in allow, lowest latency first, stopping at need.
+func detectAllowedColos(ctx context.Context, nodes []NodeResult, allow map[string]bool, need, port, concurrency int) []NodeResult {
+	var allowed []NodeResult
+	batch := max(need*2, 20)
+	for start := 0; start < len(nodes) && len(allowed) < need && ctx.Err() == nil; start += batch {
+		chunk := append([]NodeResult(nil), nodes[start:min(start+batch, len(nodes))]...)
+		_, groups := detectColoBatch(ctx, chunk, port, concurrency, nil)
+		for colo, g := range groups {
+			if allow[colo] {
+				allowed = append(allowed, g...)
+			}
+		}
+	}
+	return allowed
+}
+
+// scanForColos returns up to cfg.TopN allowed candidates; scan pings further generated IPs.
+func scanForColos(ctx context.Context, cfg Config, first []NodeResult, scan func(ips []string) []NodeResult, status func(msg string)) []NodeResult {
+	allow := parseColoList(cfg.CFColo)
+	need := max(cfg.TopN, 1)
+	seen := make(map[string]bool)
+	unseen := func(nodes []NodeResult) []NodeResult {
+		var out []NodeResult
+		for _, n := range nodes {
+			if !seen[n.IP] {
+				seen[n.IP] = true
+				out = append(out, n)
+			}
+		}
+		return out
+	}
+
+	allowed := detectAllowedColos(ctx, unseen(first), allow, need, cfg.Port, cfg.ScanConcurrent)
+	for round := 2; round <= maxColoScanRounds && len(allowed) < need && ctx.Err() == nil; round++ {
+		status(fmt.Sprintf("%d IP(s) in %s so far; scanning more (round %d/%d)...",
+			len(allowed), cfg.CFColo, round, maxColoScanRounds))
+		ips, _ := generateCandidates(ctx, cfg)
+		more := unseen(scan(ips))
+		if len(more) == 0 {
+			break
+		}
+		allowed = append(allowed, detectAllowedColos(ctx, more, allow, need-len(allowed), cfg.Port, cfg.ScanConcurrent)...)
+	}
+	w := cfg.JitterWeight
+	sort.Slice(allowed, func(i, j int) bool { return scanRank(allowed[i], w) < scanRank(allowed[j], w) })
+	if len(allowed) > need {
+		allowed = allowed[:need]
+	}
+	return allowed
+}
+
+// dropDisallowedColos removes results that landed outside the allowlist, keeping rate-limited ones.
+func dropDisallowedColos(cfg Config, results []NodeResult) []NodeResult {
+	allow := parseColoList(cfg.CFColo)
+	if allow == nil {
+		return results
+	}
+	kept := results[:0]
+	for _, r := range results {
+		if allow[r.Colo] || !knownColo(r.Colo) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,69 @@
+package cfst
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ColoCount is one row of the colo distribution.
+type ColoCount struct {
+	Colo          string  `json:"colo"`
+	Count         int     `json:"count"`
+	MedianLatency float64 `json:"median_latency"`
+}
+
+// knownColo reports whether colo is a datacenter code rather than a failure marker.
+func knownColo(colo string) bool {
+	return colo != "" && colo != "ERR" && colo != "UNK" && colo != "429"
+}
+
+// coloDistribution counts nodes per colo, most populated first.
+func coloDistribution(lists ...[]NodeResult) []ColoCount {
+	byIP := make(map[string]NodeResult)
+	for _, nodes := range lists {
+		for _, n := range nodes {
+			if knownColo(n.Colo) {
+				byIP[n.IP] = n
+			}
+		}
+	}
+	lats := make(map[string][]float64)
+	for _, n := range byIP {
+		lats[n.Colo] = append(lats[n.Colo], n.TCPLatency)
+	}
+	var out []ColoCount
+	for colo, l := range lats {
+		sort.Float64s(l)
+		out = append(out, ColoCount{Colo: colo, Count: len(l), MedianLatency: median(l)})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].MedianLatency < out[j].MedianLatency
+	})
+	return out
+}
+
+// flattenColoGroups returns every node of detectColoBatch's groups.
+func flattenColoGroups(groups map[string][]NodeResult) []NodeResult {
+	var nodes []NodeResult
+	for _, g := range groups {
+		nodes = append(nodes, g...)
+	}
+	return nodes
+}
+
+func printColoDistribution(colos []ColoCount) {
+	if len(colos) == 0 {
+		return
+	}
+	total := 0
+	for _, c := range colos {
+		total += c.Count
+	}
+	fmt.Println("  Colo distribution:")
+	for _, c := range colos {
+		fmt.Printf("    %-6s %5d (%4.1f%%)  median %.1fms\n", c.Colo, c.Count, float64(c.Count)*100/float64(total), c.MedianLatency)
+	}
+}
@@ -0,0 +1,71 @@
+package cfst
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// compressWriter compresses a response body; Flush keeps SSE events separate.
+type compressWriter struct {
+	http.ResponseWriter
+	zw interface {
+		io.WriteCloser
+		Flush() error
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) { return c.zw.Write(p) }
+
+func (c *compressWriter) Flush() {
+	c.zw.Flush()
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// withCompression negotiates gzip or deflate from Accept-Encoding.
+func withCompression(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		accept := r.Header.Get("Accept-Encoding")
+		var cw *compressWriter
+		switch {
+		case strings.Contains(accept, "gzip"):
+			w.Header().Set("Content-Encoding", "gzip")
+			cw = &compressWriter{ResponseWriter: w, zw: gzip.NewWriter(w)}
+		case strings.Contains(accept, "deflate"):
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			w.Header().Set("Content-Encoding", "deflate")
+			cw = &compressWriter{ResponseWriter: w, zw: fw}
+		default:
+			h(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		w.Header().Del("Content-Length")
+		defer cw.zw.Close()
+		h(cw, r)
+	}
+}
+
+// wantsNDJSON reports whether the client asked for newline-delimited JSON.
+func wantsNDJSON(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "ndjson"
+}
+
+// writeJSONList writes items as one JSON array, or one per line with format=ndjson.
+func writeJSONList[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	if !wantsNDJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, item := range items {
+		enc.Encode(item)
+	}
+}
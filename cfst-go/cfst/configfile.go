@@ -0,0 +1,149 @@
+package cfst
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// -config loads flat YAML or TOML options keyed by flag name; command-line flags win.
+
+// configEntry is one key/value line of a config file.
+type configEntry struct {
+	line       int
+	key, value string
+}
+
+// parseConfigFile reads the flat YAML/TOML subset described above.
+func parseConfigFile(data []byte) ([]configEntry, error) {
+	var entries []configEntry
+	sc := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line == "---" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: sections are not supported, keep every option at the top level", n)
+		}
+		sep := strings.IndexAny(line, ":=")
+		if sep <= 0 {
+			return nil, fmt.Errorf("line %d: expected key: value or key = value", n)
+		}
+		key := strings.ReplaceAll(strings.TrimLeft(strings.TrimSpace(line[:sep]), "-"), "_", "-")
+		value, err := configValue(strings.TrimSpace(line[sep+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		entries = append(entries, configEntry{line: n, key: key, value: value})
+	}
+	return entries, sc.Err()
+}
+
+// configValue unquotes a scalar, joins a [list] with commas and drops a trailing # comment.
+func configValue(v string) (string, error) {
+	if !strings.HasPrefix(v, "[") {
+		value, rest, err := configScalar(v, "")
+		if err == nil {
+			err = configTrailer(rest)
+		}
+		if err != nil {
+			return "", err
+		}
+		return value, nil
+	}
+	var items []string
+	rest := v[1:]
+	for {
+		rest = strings.TrimSpace(rest)
+		switch {
+		case rest == "":
+			return "", fmt.Errorf("unterminated list")
+		case rest[0] == ']':
+			if err := configTrailer(rest[1:]); err != nil {
+				return "", err
+			}
+			return strings.Join(items, ","), nil
+		case rest[0] == ',':
+			rest = rest[1:]
+			continue
+		}
+		item, after, err := configScalar(rest, ",]")
+		if err != nil {
+			return "", err
+		}
+		if item != "" {
+			items = append(items, item)
+		}
+		rest = after
+	}
+}
+
+// configScalar reads the quoted or bare scalar v starts with and returns what follows it.
+func configScalar(v, stop string) (value, rest string, err error) {
+	if v == "" || (v[0] != '"' && v[0] != '\'') {
+		end := len(v)
+		if i := strings.IndexAny(v, stop); stop != "" && i >= 0 {
+			end = i
+		}
+		if i := strings.Index(" "+v[:end], " #"); i >= 0 {
+			end = i
+		}
+		return strings.TrimSpace(v[:end]), v[end:], nil
+	}
+	q := v[0]
+	for i := 1; i < len(v); i++ {
+		switch {
+		case q == '"' && v[i] == '\\':
+			i++ // escaped character
+		case v[i] == q && q == '\'' && i+1 < len(v) && v[i+1] == '\'':
+			i++ // '' is a quote in a single-quoted string
+		case v[i] == q:
+			if q == '\'' {
+				return strings.ReplaceAll(v[1:i], "''", "'"), v[i+1:], nil
+			}
+			value, err = strconv.Unquote(v[:i+1])
+			return value, v[i+1:], err
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+// configTrailer checks that only a comment follows a value.
+func configTrailer(rest string) error {
+	if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+		return fmt.Errorf("unexpected %q after the value", rest)
+	}
+	return nil
+}
+
+// applyConfigFile sets the flags in path not given on the command line and adds them to set.
+func applyConfigFile(path string, set map[string]bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	entries, err := parseConfigFile(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for _, e := range entries {
+		switch {
+		case e.key == "config" || e.key == "web":
+			return fmt.Errorf("%s:%d: %s can only be given on the command line", path, e.line, e.key)
+		case flag.Lookup(e.key) == nil:
+			return fmt.Errorf("%s:%d: unknown option %q", path, e.line, e.key)
+		case set[e.key]:
+			continue
+		}
+		if err := flag.Set(e.key, e.value); err != nil {
+			return fmt.Errorf("%s:%d: invalid value %q for %s: %v", path, e.line, e.value, e.key, err)
+		}
+		set[e.key] = true
+	}
+	return nil
+}
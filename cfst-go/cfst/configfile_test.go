@@ -0,0 +1,58 @@
+package cfst
+
+import "testing"
+
+func TestConfigValue(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		err      bool
+	}{
+		{`2053`, "2053", false},
+		{`https://cf.example.com/100m # test file`, "https://cf.example.com/100m", false},
+		{`a#b`, "a#b", false},
+		{`# only a comment`, "", false},
+		{`"a#b" # it's`, "a#b", false},
+		{`"a#b" # say "hi"`, "a#b", false},
+		{`"say \"hi\"" # quoted`, `say "hi"`, false},
+		{`'a#b' # it's`, "a#b", false},
+		{`'it''s'`, "it's", false},
+		{`"C:\\cfst"`, `C:\cfst`, false},
+		{`[a.com, b.com]`, "a.com,b.com", false},
+		{`["a.com", 'b,c.com'] # two ]`, "a.com,b,c.com", false},
+		{`["a]", b] # x`, "a],b", false},
+		{`[]`, "", false},
+		{`"unterminated`, "", true},
+		{`"a" b`, "", true},
+		{`[a, b`, "", true},
+	} {
+		got, err := configValue(tc.in)
+		if (err != nil) != tc.err || got != tc.want {
+			t.Errorf("configValue(%s) = %q, %v; want %q, error %v", tc.in, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestParseConfigFile(t *testing.T) {
+	yaml := "\xef\xbb\xbf---\n# cfst.yaml\np: 2053\nbind_out: /etc/bind/cf.zone\nsni: \"a#b\" # it's\n"
+	toml := "p = 2053\nbind-out = \"/etc/bind/cf.zone\"\nsni = 'a#b'\n"
+	for name, data := range map[string]string{"YAML": yaml, "TOML": toml} {
+		entries, err := parseConfigFile([]byte(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want := []configEntry{{key: "p", value: "2053"}, {key: "bind-out", value: "/etc/bind/cf.zone"}, {key: "sni", value: "a#b"}}
+		if len(entries) != len(want) {
+			t.Fatalf("%s: got %d entries, want %d: %+v", name, len(entries), len(want), entries)
+		}
+		for i, e := range entries {
+			if e.key != want[i].key || e.value != want[i].value {
+				t.Errorf("%s: entry %d = %s=%q, want %s=%q", name, i, e.key, e.value, want[i].key, want[i].value)
+			}
+		}
+	}
+	for _, bad := range []string{"[section]\np = 1\n", "just text\n"} {
+		if _, err := parseConfigFile([]byte(bad)); err == nil {
+			t.Errorf("%q parsed without an error", bad)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package cfst
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// -cpu caps the CPUs the tool uses.
+
+// parseCPULimit parses "50%" or "2" into a GOMAXPROCS value and its share of ncpu.
+func parseCPULimit(spec string, ncpu int) (procs int, frac float64, err error) {
+	spec = strings.TrimSpace(spec)
+	if pct, ok := strings.CutSuffix(spec, "%"); ok {
+		p, err := strconv.ParseFloat(pct, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return 0, 0, fmt.Errorf("invalid -cpu %q: want a percentage in (0, 100]", spec)
+		}
+		frac = p / 100
+		procs = max(int(float64(ncpu)*frac), 1)
+		return procs, frac, nil
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid -cpu %q: want a percentage such as 50%% or a CPU count", spec)
+	}
+	procs = min(n, ncpu)
+	return procs, float64(procs) / float64(ncpu), nil
+}
+
+// applyCPULimit sets GOMAXPROCS and scales scan concurrency unless -sc was given.
+func applyCPULimit(cfg *Config, set map[string]bool) error {
+	ncpu := runtime.NumCPU()
+	procs, frac, err := parseCPULimit(cfg.CPULimit, ncpu)
+	if err != nil {
+		return err
+	}
+	runtime.GOMAXPROCS(procs)
+	if !set["sc"] {
+		cfg.ScanConcurrent = max(int(float64(cfg.ScanConcurrent)*frac), 8)
+	}
+	fmt.Printf("⚙ CPU limit: %d of %d CPU(s), scan concurrency %d\n", procs, ncpu, cfg.ScanConcurrent)
+	return nil
+}
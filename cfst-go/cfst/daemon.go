@@ -0,0 +1,155 @@
+package cfst
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// -daemon repeats the test every -interval and publishes only when the best IP changes.
+
+const defaultDaemonStateFile = "cfst-best.json"
+
+// DaemonBest is the daemon's current best IP, as saved in -daemon-state.
+type DaemonBest struct {
+	IP      string    `json:"ip"`
+	Addr    string    `json:"addr"` // what the actions publish: the IP, or ip:port off 443
+	Colo    string    `json:"colo"`
+	Speed   float64   `json:"download_speed"`
+	Latency float64   `json:"tcp_latency"`
+	Since   time.Time `json:"since"`   // when it became the best
+	Checked time.Time `json:"checked"` // last run that found it best
+}
+
+// readDaemonState loads the current best saved by a previous daemon, nil if none.
+func readDaemonState(path string) *DaemonBest {
+	if path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var best DaemonBest
+	if json.Unmarshal(b, &best) != nil || best.Addr == "" {
+		return nil
+	}
+	return &best
+}
+
+func writeDaemonState(path string, best *DaemonBest) error {
+	if path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(best, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// withoutPublishers returns cfg with the actions that publish the best IP turned off.
+func withoutPublishers(cfg Config) Config {
+	cfg.BestOut = ""
+	cfg.BindOut = ""
+	cfg.DnsmasqOut = ""
+	cfg.AdGuardOut = ""
+	cfg.PluginExporter = ""
+	cfg.DDNSZone = ""
+	cfg.HostsDomains = ""
+	cfg.SingBoxTemplate = ""
+	cfg.XrayConfig = ""
+	cfg.TGChat = ""
+	cfg.DiscordWebhook = ""
+	cfg.SlackWebhook = ""
+	cfg.GrafanaURL = ""
+	if !cfg.WebhookEveryRun {
+		cfg.Webhook = ""
+	}
+	return cfg
+}
+
+// nextBest returns the current best after a run, and whether it changed.
+func nextBest(current *DaemonBest, results []NodeResult, at time.Time) (*DaemonBest, bool) {
+	r := bestResult(results)
+	if r == nil {
+		return current, false
+	}
+	addr := usableAt(*r)
+	if current != nil && current.Addr == addr {
+		next := *current
+		next.Colo, next.Speed, next.Latency, next.Checked = r.Colo, r.DownloadSpeed, r.TCPLatency, at
+		return &next, false
+	}
+	return &DaemonBest{IP: r.IP, Addr: addr, Colo: r.Colo, Speed: r.DownloadSpeed, Latency: r.TCPLatency, Since: at, Checked: at}, true
+}
+
+// runDaemon repeats runCLIOnce every cfg.Interval until ctx is cancelled.
+func runDaemon(ctx context.Context, cfg Config) {
+	if cfg.MetricsListen != "" {
+		if err := serveDaemonMetrics(cfg.MetricsListen); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+	}
+	current := readDaemonState(cfg.DaemonState)
+	if current != nil {
+		fmt.Printf("🔁 Daemon: current best %s (%s) since %s\n", current.Addr, current.Colo, current.Since.Local().Format(time.DateTime))
+	}
+	for run := 1; ; run++ {
+		fmt.Printf("\n🔁 Daemon run %d at %s\n", run, time.Now().Format(time.DateTime))
+		results, summary, ok := runCLIOnce(ctx, cfg)
+		switch {
+		case !ok:
+			if current != nil {
+				fmt.Printf("\n🔁 No usable results; keeping %s.\n", current.Addr)
+			}
+		case ctx.Err() != nil:
+			finishRun(withoutPublishers(cfg), results, summary, printNotice)
+		default:
+			next, changed := nextBest(current, results, time.Now())
+			runCfg := cfg
+			runCfg.TGChat = "" // sent below, saying what changed
+			switch {
+			case changed && current != nil:
+				fmt.Printf("\n🔁 Best IP changed: %s → %s (%s, %.2f MB/s)\n", current.Addr, next.Addr, next.Colo, next.Speed)
+			case changed:
+				fmt.Printf("\n🔁 Best IP: %s (%s, %.2f MB/s)\n", next.Addr, next.Colo, next.Speed)
+			default:
+				runCfg = withoutPublishers(cfg)
+				if next != nil {
+					fmt.Printf("\n🔁 Best IP unchanged: %s (%s, %.2f MB/s)\n", next.Addr, next.Colo, next.Speed)
+				}
+			}
+			finishRun(runCfg, results, summary, printNotice)
+			if changed && cfg.TGChat != "" {
+				headline := "cfst: best IP " + next.Addr
+				if current != nil {
+					headline = fmt.Sprintf("cfst: best IP changed %s → %s", current.Addr, next.Addr)
+				}
+				if err := sendTelegram(cfg, runReport(headline, results, summary)); err != nil {
+					printNotice("status", "Telegram notification failed: "+err.Error())
+				}
+			}
+			if current = next; current != nil {
+				if err := writeDaemonState(cfg.DaemonState, current); err != nil {
+					fmt.Println("[!] Error writing daemon state:", err)
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			fmt.Println("⏹ Daemon stopped.")
+			return
+		}
+
+		fmt.Printf("💤 Next run at %s\n", time.Now().Add(cfg.Interval).Format(time.DateTime))
+		select {
+		case <-ctx.Done():
+			fmt.Println("⏹ Daemon stopped.")
+			return
+		case <-time.After(cfg.Interval):
+		}
+	}
+}
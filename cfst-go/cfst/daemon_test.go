@@ -0,0 +1,40 @@
+package cfst
+
+import "testing"
+
+func TestWithoutPublishers(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.BestOut, cfg.BindOut, cfg.DnsmasqOut, cfg.AdGuardOut = "best.txt", "zone", "dnsmasq.conf", "adguard.json"
+	cfg.PluginExporter, cfg.DDNSZone, cfg.HostsDomains = "exporter", "example.com", "a.example"
+	cfg.SingBoxTemplate, cfg.XrayConfig, cfg.TGChat = "sb.json", "xray.json", "@chan"
+	cfg.DiscordWebhook, cfg.SlackWebhook, cfg.GrafanaURL = "https://discord", "https://slack", "https://grafana"
+	cfg.Webhook = "https://hook"
+	cfg.Output = "result.csv"
+
+	for _, tc := range []struct {
+		everyRun    bool
+		wantWebhook string
+	}{
+		{false, ""},
+		{true, "https://hook"},
+	} {
+		cfg.WebhookEveryRun = tc.everyRun
+		got := withoutPublishers(cfg)
+		for name, v := range map[string]string{
+			"BestOut": got.BestOut, "BindOut": got.BindOut, "DnsmasqOut": got.DnsmasqOut, "AdGuardOut": got.AdGuardOut,
+			"PluginExporter": got.PluginExporter, "DDNSZone": got.DDNSZone, "HostsDomains": got.HostsDomains,
+			"SingBoxTemplate": got.SingBoxTemplate, "XrayConfig": got.XrayConfig, "TGChat": got.TGChat,
+			"DiscordWebhook": got.DiscordWebhook, "SlackWebhook": got.SlackWebhook, "GrafanaURL": got.GrafanaURL,
+		} {
+			if v != "" {
+				t.Errorf("every run %v: %s = %q, want it off", tc.everyRun, name, v)
+			}
+		}
+		if got.Webhook != tc.wantWebhook {
+			t.Errorf("every run %v: Webhook = %q, want %q", tc.everyRun, got.Webhook, tc.wantWebhook)
+		}
+		if got.Output != cfg.Output {
+			t.Errorf("every run %v: Output = %q; the result file is not a publisher", tc.everyRun, got.Output)
+		}
+	}
+}
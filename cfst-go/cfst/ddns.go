@@ -0,0 +1,170 @@
+package cfst
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// -ddns-zone points the -ddns-record names at the best result through the Cloudflare API.
+
+// cloudflareAPI is the base URL of the Cloudflare v4 API.
+var cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+const ddnsTimeout = 15 * time.Second
+
+var zoneIDRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// cfEnvelope is the wrapper of every Cloudflare API response.
+type cfEnvelope struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+// cfRecord is a Cloudflare DNS record.
+type cfRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl,omitempty"`
+	Proxied *bool  `json:"proxied,omitempty"`
+}
+
+// cfClient calls the Cloudflare API with a bearer token.
+type cfClient struct {
+	token string
+	http  *http.Client
+}
+
+// do sends one API request and decodes its result into out (if not nil).
+func (c cfClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, cloudflareAPI+path, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var env cfEnvelope
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&env); err != nil {
+		return fmt.Errorf("cloudflare API %s %s: %s", method, path, resp.Status)
+	}
+	if !env.Success {
+		if len(env.Errors) > 0 {
+			return fmt.Errorf("cloudflare API: %s (code %d)", env.Errors[0].Message, env.Errors[0].Code)
+		}
+		return fmt.Errorf("cloudflare API %s %s: %s", method, path, resp.Status)
+	}
+	if out != nil {
+		return json.Unmarshal(env.Result, out)
+	}
+	return nil
+}
+
+// zoneID returns the ID of zone, which may already be one.
+func (c cfClient) zoneID(ctx context.Context, zone string) (string, error) {
+	if zoneIDRe.MatchString(zone) {
+		return zone, nil
+	}
+	var zones []struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, "GET", "/zones?name="+url.QueryEscape(zone), nil, &zones); err != nil {
+		return "", err
+	}
+	if len(zones) == 0 {
+		return "", fmt.Errorf("zone %s not found (or the token can't read it)", zone)
+	}
+	return zones[0].ID, nil
+}
+
+// point sets name's record of typ to ip, creating it if needed, and reports any change.
+func (c cfClient) point(ctx context.Context, zoneID, typ, name, ip string) (bool, error) {
+	var recs []cfRecord
+	q := url.Values{"type": {typ}, "name": {name}}
+	if err := c.do(ctx, "GET", "/zones/"+zoneID+"/dns_records?"+q.Encode(), nil, &recs); err != nil {
+		return false, err
+	}
+	if len(recs) == 0 {
+		proxied := false
+		return true, c.do(ctx, "POST", "/zones/"+zoneID+"/dns_records", cfRecord{Type: typ, Name: name, Content: ip, TTL: 1, Proxied: &proxied}, nil)
+	}
+	if recs[0].Content == ip {
+		return false, nil
+	}
+	return true, c.do(ctx, "PATCH", "/zones/"+zoneID+"/dns_records/"+recs[0].ID, map[string]string{"content": ip}, nil)
+}
+
+// updateDDNS points every -ddns-record at the best result and describes what it did.
+func updateDDNS(cfg Config, results []NodeResult) (string, error) {
+	if cfg.OfflineSources {
+		return "", errOffline
+	}
+	best := bestResult(forPortless(results, cfg.Check443))
+	if best == nil {
+		return "", fmt.Errorf("no usable result to point the records at")
+	}
+	typ := "A"
+	if ip := net.ParseIP(best.IP); ip != nil && ip.To4() == nil {
+		typ = "AAAA"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ddnsTimeout)
+	defer cancel()
+	c := cfClient{token: cfg.DDNSToken, http: http.DefaultClient}
+	zoneID, err := c.zoneID(ctx, cfg.DDNSZone)
+	if err != nil {
+		return "", err
+	}
+	var updated, current []string
+	for _, name := range parseDomainList(cfg.DDNSRecord) {
+		if zone := cfg.DDNSZone; !zoneIDRe.MatchString(zone) && name != zone && !strings.HasSuffix(name, "."+zone) {
+			name += "." + zone // relative to the zone
+		}
+		changed, err := c.point(ctx, zoneID, typ, name, best.IP)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", name, err)
+		}
+		if changed {
+			updated = append(updated, name)
+		} else {
+			current = append(current, name)
+		}
+	}
+
+	msg := fmt.Sprintf("DDNS: %s → %s", strings.Join(updated, ", "), best.IP)
+	if len(updated) == 0 {
+		msg = fmt.Sprintf("DDNS: %s already point at %s", strings.Join(current, ", "), best.IP)
+	}
+	if altPort(*best) {
+		msg += fmt.Sprintf(" (measured on %s)", resultAddr(best.IP, best.Port))
+	}
+	return msg, nil
+}
@@ -0,0 +1,2 @@
+// Package cfst finds the Cloudflare IPs that are fastest from this network.
+package cfst
@@ -0,0 +1,137 @@
+package cfst
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultECHDomain publishes Cloudflare's ECH config in its HTTPS DNS record.
+const defaultECHDomain = "crypto.cloudflare.com"
+
+const dohEndpoint = "https://cloudflare-dns.com/dns-query"
+
+// loadECHConfig returns the -ech-config ECHConfigList, or the one published for domain.
+func loadECHConfig(configB64, domain string) ([]byte, error) {
+	if configB64 != "" {
+		return base64.StdEncoding.DecodeString(configB64)
+	}
+	return fetchECHConfig(domain)
+}
+
+// fetchECHConfig looks up the "ech" SvcParam of domain's HTTPS record via DoH.
+func fetchECHConfig(domain string) ([]byte, error) {
+	if processSettings.offline {
+		return nil, errOffline
+	}
+	query := buildDNSQuery(domain, 65) // HTTPS
+	req, err := http.NewRequest("GET", dohEndpoint+"?dns="+base64.RawURLEncoding.EncodeToString(query), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-message")
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH query failed: %s", resp.Status)
+	}
+	msg, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	return parseECHFromHTTPSRecord(msg)
+}
+
+func buildDNSQuery(name string, qtype uint16) []byte {
+	msg := []byte{0, 0, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0} // id 0, RD, QDCOUNT 1
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, 1) // IN
+	return msg
+}
+
+var errMalformedDNS = errors.New("malformed DNS response")
+
+// skipDNSName returns the offset just past the (possibly compressed) name at off.
+func skipDNSName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errMalformedDNS
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1, nil
+		case l&0xC0 == 0xC0:
+			return off + 2, nil
+		default:
+			off += 1 + l
+		}
+	}
+}
+
+func parseECHFromHTTPSRecord(msg []byte) ([]byte, error) {
+	if len(msg) < 12 {
+		return nil, errMalformedDNS
+	}
+	qd := int(binary.BigEndian.Uint16(msg[4:]))
+	an := int(binary.BigEndian.Uint16(msg[6:]))
+	off := 12
+	var err error
+	for i := 0; i < qd; i++ {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, err
+		}
+		off += 4
+	}
+	for i := 0; i < an; i++ {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, err
+		}
+		if off+10 > len(msg) {
+			return nil, errMalformedDNS
+		}
+		rtype := binary.BigEndian.Uint16(msg[off:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, errMalformedDNS
+		}
+		rdata := msg[off : off+rdlen]
+		off += rdlen
+		if rtype != 65 {
+			continue
+		}
+		// SvcPriority, uncompressed TargetName, then key/length/value params.
+		p, err := skipDNSName(rdata, 2)
+		if err != nil {
+			return nil, err
+		}
+		for p+4 <= len(rdata) {
+			key := binary.BigEndian.Uint16(rdata[p:])
+			vlen := int(binary.BigEndian.Uint16(rdata[p+2:]))
+			p += 4
+			if p+vlen > len(rdata) {
+				return nil, errMalformedDNS
+			}
+			if key == 5 { // ech
+				return rdata[p : p+vlen], nil
+			}
+			p += vlen
+		}
+	}
+	return nil, errors.New("no ECH config published")
+}
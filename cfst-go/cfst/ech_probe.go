@@ -0,0 +1,42 @@
+//go:build go1.23
+
+package cfst
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+)
+
+// ECHProbe attempts a TLS handshake with Encrypted ClientHello through ip.
+func ECHProbe(ctx context.Context, ip string, port int, serverName string, configList []byte, timeout time.Duration) string {
+	conf := &tls.Config{
+		ServerName:                     serverName,
+		InsecureSkipVerify:             true,
+		MinVersion:                     tls.VersionTLS13,
+		EncryptedClientHelloConfigList: configList,
+		// We only want the accept/reject signal, not the outer certificate check.
+		EncryptedClientHelloRejectionVerify: func(tls.ConnectionState) error { return nil },
+	}
+	raw, err := (&net.Dialer{Timeout: timeout}).DialContext(ctx, "tcp", settingsOf(ctx).dialAddr(ip, port))
+	if err != nil {
+		return "fail"
+	}
+	defer raw.Close()
+	raw.SetDeadline(time.Now().Add(timeout))
+
+	conn := tls.Client(raw, conf)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		var rejected *tls.ECHRejectionError
+		if errors.As(err, &rejected) {
+			return "rejected"
+		}
+		return "fail"
+	}
+	if conn.ConnectionState().ECHAccepted {
+		return "ok"
+	}
+	return "rejected"
+}
@@ -0,0 +1,13 @@
+//go:build !go1.23
+
+package cfst
+
+import (
+	"context"
+	"time"
+)
+
+// ECHProbe needs the crypto/tls ECH client added in Go 1.23.
+func ECHProbe(ctx context.Context, ip string, port int, serverName string, configList []byte, timeout time.Duration) string {
+	return "unsupported"
+}
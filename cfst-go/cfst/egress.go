@@ -0,0 +1,74 @@
+package cfst
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Results measured from another egress IP than most are marked, or dropped with -egress-change drop.
+
+// -egress-change modes.
+const (
+	EgressMark = "mark"
+	EgressDrop = "drop"
+	EgressOff  = "off"
+)
+
+func validEgressMode(mode string) error {
+	switch mode {
+	case EgressMark, EgressDrop, EgressOff:
+		return nil
+	}
+	return fmt.Errorf("unknown -egress-change %q (have mark, drop, off)", mode)
+}
+
+// prevailingEgress returns the egress most results were measured from and every one seen.
+func prevailingEgress(results []NodeResult) (prevailing string, seen []string) {
+	tested := append([]NodeResult(nil), results...)
+	sort.SliceStable(tested, func(i, j int) bool { return tested[i].TestedAt.Before(tested[j].TestedAt) })
+	counts := make(map[string]int)
+	for _, r := range tested {
+		if r.egress == "" {
+			continue
+		}
+		if counts[r.egress] == 0 {
+			seen = append(seen, r.egress)
+		}
+		counts[r.egress]++
+		if counts[r.egress] >= counts[prevailing] {
+			prevailing = r.egress
+		}
+	}
+	return prevailing, seen
+}
+
+// checkEgress marks or drops the results from another egress, with the count and a note.
+func checkEgress(mode string, results []NodeResult) ([]NodeResult, int, string) {
+	if mode == EgressOff {
+		return results, 0, ""
+	}
+	prevailing, seen := prevailingEgress(results)
+	if len(seen) < 2 {
+		return results, 0, ""
+	}
+	kept := results[:0]
+	changed := 0
+	for _, r := range results {
+		if r.egress != "" && r.egress != prevailing {
+			changed++
+			if mode == EgressDrop {
+				continue
+			}
+			r.EgressChanged = true
+		}
+		kept = append(kept, r)
+	}
+	action := "marked EgressChanged"
+	if mode == EgressDrop {
+		action = "dropped"
+	}
+	note := fmt.Sprintf("Public IP changed during the run (%s); %d result(s) not measured from %s were %s",
+		strings.Join(seen, " → "), changed, prevailing, action)
+	return kept, changed, note
+}
@@ -0,0 +1,35 @@
+package cfst
+
+import "testing"
+
+func TestCheckEgress(t *testing.T) {
+	results := func() []NodeResult {
+		return []NodeResult{{IP: "a", egress: "198.51.100.1"}, {IP: "b", egress: "198.51.100.1"}, {IP: "c", egress: "203.0.113.9"}, {IP: "d"}}
+	}
+	for _, tc := range []struct {
+		mode    string
+		kept    int
+		changed int
+		marked  int
+	}{
+		{EgressMark, 4, 1, 1},
+		{EgressDrop, 3, 1, 0},
+		{EgressOff, 4, 0, 0},
+	} {
+		kept, changed, note := checkEgress(tc.mode, results())
+		marked := 0
+		for _, r := range kept {
+			if r.EgressChanged {
+				marked++
+			}
+		}
+		if len(kept) != tc.kept || changed != tc.changed || marked != tc.marked || (changed > 0) != (note != "") {
+			t.Errorf("%s: kept %d, changed %d, marked %d, note %q", tc.mode, len(kept), changed, marked, note)
+		}
+	}
+
+	same := []NodeResult{{IP: "a", egress: "198.51.100.1"}, {IP: "b", egress: "198.51.100.1"}}
+	if _, changed, note := checkEgress(EgressDrop, same); changed != 0 || note != "" {
+		t.Errorf("one egress: changed %d, note %q", changed, note)
+	}
+}
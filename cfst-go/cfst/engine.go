@@ -0,0 +1,956 @@
+package cfst
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var CloudflareIPv4Ranges = []string{
+	"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22",
+	"141.101.64.0/18", "108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20",
+	"197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+	"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+	// High-performance Cloudflare subnets (DNS, Pages, Workers, WARP)
+	"162.159.36.0/22", "162.159.44.0/24", "162.159.192.0/24", "162.159.193.0/24",
+}
+
+type cidrInfo struct {
+	baseIP   uint32
+	maxHost  int
+	hostBits int
+}
+
+var cidrCache sync.Map
+
+func parseCIDRCached(cidr string) *cidrInfo {
+	if v, ok := cidrCache.Load(cidr); ok {
+		return v.(*cidrInfo)
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil
+	}
+	ones, bits := ipNet.Mask.Size()
+	hostBits := bits - ones
+	if hostBits <= 2 {
+		cidrCache.Store(cidr, &cidrInfo{baseIP: binary.BigEndian.Uint32(ipNet.IP.To4()), maxHost: 0, hostBits: hostBits})
+	} else {
+		cidrCache.Store(cidr, &cidrInfo{baseIP: binary.BigEndian.Uint32(ipNet.IP.To4()), maxHost: (1 << hostBits) - 2, hostBits: hostBits})
+	}
+	v, _ := cidrCache.Load(cidr)
+	return v.(*cidrInfo)
+}
+
+type NodeResult struct {
+	IP              string    `json:"ip"`
+	Port            int       `json:"port"`
+	Addr            string    `json:"addr,omitempty"` // ip:port, ready to use when Port isn't 443
+	TCPLatency      float64   `json:"tcp_latency"`
+	DownloadSpeed   float64   `json:"download_speed"`
+	SingleSpeed     float64   `json:"single_speed"`
+	LoadLatency     float64   `json:"load_latency"`
+	Colo            string    `json:"colo"`
+	Score           float64   `json:"score"`
+	Jitter          float64   `json:"jitter"`
+	Stability       float64   `json:"stability"`
+	MinSpeed        float64   `json:"min_speed"`
+	PacketLoss      float64   `json:"packet_loss"`
+	Bytes           int64     `json:"bytes,omitempty"`       // bytes the download test received
+	DownloadMicros  int64     `json:"download_us,omitempty"` // and the µs they took
+	CacheStatus     string    `json:"cache_status,omitempty"`
+	TLSHandshake    float64   `json:"tls_handshake,omitempty"`
+	ResumeLatency   float64   `json:"resume_latency,omitempty"`
+	Resumed         bool      `json:"resumed,omitempty"`
+	ECH             string    `json:"ech,omitempty"`
+	WSStatus        string    `json:"ws_status,omitempty"`
+	WSRTT           float64   `json:"ws_rtt,omitempty"`
+	GRPCStatus      string    `json:"grpc_status,omitempty"`
+	GRPCHeld        float64   `json:"grpc_held,omitempty"`
+	LongevityStatus string    `json:"longevity_status,omitempty"`
+	LongevitySec    float64   `json:"longevity_sec,omitempty"`
+	Interference    string    `json:"interference,omitempty"`
+	CertStatus      string    `json:"cert_status,omitempty"` // -cert-check verdict
+	CertSubject     string    `json:"cert_subject,omitempty"`
+	CertIssuer      string    `json:"cert_issuer,omitempty"`
+	CertSANs        []string  `json:"cert_sans,omitempty"`
+	EgressIP        string    `json:"egress_ip,omitempty"` // -trace-fields: our address as this edge saw it
+	TraceHTTP       string    `json:"trace_http,omitempty"`
+	TraceTLS        string    `json:"trace_tls,omitempty"`
+	Warp            string    `json:"warp,omitempty"`
+	EgressChanged   bool      `json:"egress_changed,omitempty"`
+	Port443         bool      `json:"port_443,omitempty"` // -check-443: 443 answers too, though Port is another
+	Pinned          bool      `json:"pinned,omitempty"`   // from -pin: tested whatever its rank
+	TestedAt        time.Time `json:"tested_at"`          // when the download test ran (RFC 3339); omitted if never
+
+	egress string // the trace's egress IP, kept for checkEgress even without -trace-fields
+}
+
+// MarshalJSON leaves tested_at out of results that were never tested.
+func (n NodeResult) MarshalJSON() ([]byte, error) {
+	type plain NodeResult
+	return json.Marshal(struct {
+		plain
+		TestedAt *time.Time `json:"tested_at,omitempty"`
+	}{plain(n), optionalTime(n.TestedAt)})
+}
+
+// optionalTime is t for an omitempty field, nil when zero.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (n *NodeResult) CalcScore() {
+	// Speed score (35%): single-stream speed, cap 15 MB/s
+	effectiveSpeed := n.DownloadSpeed
+	if n.SingleSpeed > 0 {
+		effectiveSpeed = n.SingleSpeed
+	}
+	scoreSpeed := math.Min(effectiveSpeed/15.0*100.0, 100.0)
+
+	// MinSpeed score (20%): floor speed, cap 10 MB/s
+	scoreMinSpeed := math.Min(n.MinSpeed/10.0*100.0, 100.0)
+
+	// Latency score (10%): lower is better
+	scoreLatency := 100.0 - (n.TCPLatency-30.0)*0.5
+	if scoreLatency < 0 {
+		scoreLatency = 0
+	}
+
+	// Jitter score (10%): >10ms starts penalizing
+	scoreJitter := 100.0 - n.Jitter*2.0
+	if scoreJitter < 0 {
+		scoreJitter = 0
+	}
+
+	// Stability score (25%)
+	scoreStability := n.Stability
+
+	n.Score = scoreSpeed*0.35 + scoreMinSpeed*0.20 + scoreLatency*0.10 +
+		scoreJitter*0.10 + scoreStability*0.25
+
+	// Packet loss in the scan: 3 points per 10% lost
+	n.Score = math.Max(n.Score-n.PacketLoss*30, 0)
+
+	if n.Colo != "UNK" && n.Colo != "ERR" && n.Colo != "" {
+		n.Score += 5.0
+	}
+}
+
+func randIPFromCIDR(cidr string) string {
+	info := parseCIDRCached(cidr)
+	if info == nil {
+		return ""
+	}
+	if info.hostBits <= 2 {
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], info.baseIP)
+		return net.IP(buf[:]).String()
+	}
+	offset := rand.Intn(info.maxHost) + 1
+	ip := info.baseIP + uint32(offset)
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], ip)
+	return net.IP(buf[:]).String()
+}
+
+// StreamResult is the outcome of a single-connection download test.
+type StreamResult struct {
+	Speed       float64       // average MB/s
+	MinSpeed    float64       // slowest 2s interval, MB/s
+	Stability   float64       // 0-100
+	Bytes       int64         // raw bytes received
+	Elapsed     time.Duration // wall time the bytes took
+	CacheStatus string        // cf-cache-status response header, if any
+	Streams     int           // concurrent streams actually opened
+	Proto       string        // negotiated protocol, e.g. "HTTP/2.0"
+}
+
+// Failed reports whether the test produced no usable measurement (error, 429, ...).
+func (r StreamResult) Failed() bool {
+	return r.Speed == 0 && r.MinSpeed == 0 && r.Stability == 0
+}
+
+// downloadTemplate is the request for one test URL and SNI, minus the per-test parts.
+type downloadTemplate struct {
+	req *http.Request
+	sni string
+}
+
+// downloadTemplates caches a downloadTemplate per test URL and SNI, up to maxDownloadTemplates.
+var (
+	downloadTemplatesMu sync.Mutex
+	downloadTemplates   = map[string]*downloadTemplate{} // testURL + "|" + customSNI
+)
+
+const maxDownloadTemplates = 64
+
+func loadDownloadTemplate(testURL string, customSNI string) (*downloadTemplate, error) {
+	key := testURL + "|" + customSNI
+	downloadTemplatesMu.Lock()
+	defer downloadTemplatesMu.Unlock()
+	if t, ok := downloadTemplates[key]; ok {
+		return t, nil
+	}
+	parsedURL, err := url.Parse(testURL)
+	if err != nil {
+		return nil, err
+	}
+	host := parsedURL.Hostname()
+
+	// Set SNI to the actual domain so CF routes correctly
+	sni := host
+	if customSNI != "" {
+		sni = customSNI
+	} else if strings.Contains(testURL, "speed.cloudflare.com") {
+		sni = "speed.cloudflare.com"
+	}
+
+	req, err := newCFRequest("GET", testURL)
+	if err != nil {
+		return nil, err
+	}
+	req.Host = host
+	req.Header.Set("Connection", "keep-alive")
+
+	if !strings.Contains(testURL, "speed.cloudflare.com") {
+		scheme := parsedURL.Scheme
+		if scheme == "" {
+			scheme = "https"
+		}
+		baseURL := scheme + "://" + host
+		if parsedURL.Port() != "" {
+			baseURL += ":" + parsedURL.Port()
+		}
+		setCFHeadersForURL(req, baseURL)
+	}
+	if len(downloadTemplates) >= maxDownloadTemplates {
+		clear(downloadTemplates)
+	}
+	t := &downloadTemplate{req: req, sni: sni}
+	downloadTemplates[key] = t
+	return t, nil
+}
+
+// newDownloadRequest builds a client pinned to ip and a GET for testURL with the headers CF expects.
+func newDownloadRequest(ctx context.Context, ip string, port int, testURL string, customSNI string) (*http.Client, *http.Request, error) {
+	t, err := loadDownloadTemplate(testURL, customSNI)
+	if err != nil {
+		return nil, nil, err
+	}
+	rs := settingsOf(ctx)
+	req := t.req.Clone(ctx)
+	setUserAgent(req.Header, rs.userAgents.pick()) // rotated per request
+	return rs.client(ip, port, t.sni), req, nil
+}
+
+// PrimeCache fetches testURL through ip once and returns the primer's cf-cache-status.
+func PrimeCache(ctx context.Context, ip string, port int, testURL string, customSNI string, timeout time.Duration) string {
+	primeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client, req, err := newDownloadRequest(primeCtx, ip, port, testURL, customSNI)
+	if err != nil {
+		return ""
+	}
+	resp, stop, err := doWithSetupTimeout(client, req, requestSetupTimeout)
+	if err != nil {
+		return ""
+	}
+	defer stop()
+	defer resp.Body.Close()
+
+	body := newStallReader(resp.Body, readStallTimeout, stop)
+	bufPtr := downloadBufPool.Get().(*[]byte)
+	buf := *bufPtr
+	meter := byteMeterFrom(ctx)
+	for {
+		n, err := body.Read(buf)
+		meter.add(n)
+		if err != nil {
+			break
+		}
+	}
+	downloadBufPool.Put(bufPtr)
+	return resp.Header.Get("Cf-Cache-Status")
+}
+
+// cacheStatusReliable reports whether a cf-cache-status means the edge served the bytes.
+func cacheStatusReliable(status string) bool {
+	switch strings.ToUpper(status) {
+	case "HIT", "STALE", "REVALIDATED", "UPDATING":
+		return true
+	}
+	return false
+}
+
+const (
+	requestSetupTimeout = 5 * time.Second // connect, TLS handshake and response headers
+	readStallTimeout    = 5 * time.Second // body silence after which a stream is reaped
+)
+
+// doWithSetupTimeout sends req, cancelling it if the headers take longer than setup; call cancel when done.
+func doWithSetupTimeout(client *http.Client, req *http.Request, setup time.Duration) (*http.Response, context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(setup, cancel)
+	resp, err := client.Do(req.WithContext(ctx))
+	timer.Stop()
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return resp, cancel, nil
+}
+
+// stallReader cancels its request when no bytes arrive for timeout.
+type stallReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func newStallReader(r io.Reader, timeout time.Duration, cancel context.CancelFunc) *stallReader {
+	return &stallReader{r: r, timer: time.AfterFunc(timeout, cancel), timeout: timeout}
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil {
+		s.timer.Stop()
+	} else if n > 0 {
+		s.timer.Reset(s.timeout)
+	}
+	return n, err
+}
+
+// SingleStreamTest measures single-connection download speed.
+func SingleStreamTest(ctx context.Context, ip string, port int, duration int, testURL string, customSNI string,
+	progressCallback func(LiveProgress)) StreamResult {
+	return MultiStreamTest(ctx, ip, port, duration, testURL, customSNI, 1, false, progressCallback)
+}
+
+// MultiStreamTest downloads testURL over streams concurrent requests, multiplexed with useHTTP2.
+func MultiStreamTest(ctx context.Context, ip string, port int, duration int, testURL string, customSNI string,
+	streams int, useHTTP2 bool, progressCallback func(LiveProgress)) StreamResult {
+
+	if streams < 1 {
+		streams = 1
+	}
+	dur := time.Duration(duration) * time.Second
+	downloadCtx, cancel := context.WithTimeout(ctx, dur)
+	defer cancel()
+
+	client, req, err := newDownloadRequest(downloadCtx, ip, port, testURL, customSNI)
+	if err != nil {
+		return StreamResult{}
+	}
+	if tr, ok := pinnedOf(client.Transport); ok && (useHTTP2 || streams > 1) {
+		// Reconfiguring: use a private copy of the shared transport.
+		tr = tr.Clone()
+		client.Transport = settingsOf(ctx).withResolve(tr)
+		if useHTTP2 {
+			enableHTTP2(tr)
+		}
+		tr.MaxIdleConnsPerHost = streams
+		defer tr.CloseIdleConnections()
+	}
+	return streamTest(downloadCtx, client, req, ip, duration, streams, progressCallback)
+}
+
+// streamTest runs the timed download of MultiStreamTest over client.
+func streamTest(downloadCtx context.Context, client *http.Client, req *http.Request, ip string, duration int,
+	streams int, progressCallback func(LiveProgress)) StreamResult {
+
+	// Open the first stream alone so an h2 connection exists for the rest to share.
+	resp, stop, err := doWithSetupTimeout(client, req, requestSetupTimeout)
+	if err != nil {
+		return StreamResult{}
+	}
+	bodies := []io.ReadCloser{resp.Body}
+	cancels := []context.CancelFunc{stop}
+	defer func() {
+		for i, b := range bodies {
+			b.Close()
+			cancels[i]()
+		}
+	}()
+
+	if resp.StatusCode >= 400 {
+		return StreamResult{}
+	}
+	cacheStatus := resp.Header.Get("Cf-Cache-Status")
+	proto := resp.Proto
+
+	for i := 1; i < streams; i++ {
+		extra, stop, err := doWithSetupTimeout(client, req.Clone(downloadCtx), requestSetupTimeout)
+		if err != nil {
+			break
+		}
+		if extra.StatusCode >= 400 {
+			extra.Body.Close()
+			stop()
+			break
+		}
+		bodies = append(bodies, extra.Body)
+		cancels = append(cancels, stop)
+	}
+
+	startGlobal := time.Now()
+	var totalBytes int64
+	sampleInterval := 2 * time.Second
+	var samples []float64
+	var sampleMu sync.Mutex
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(sampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				b := atomic.LoadInt64(&totalBytes)
+				mb := float64(b) / 1024.0 / 1024.0
+				sampleMu.Lock()
+				samples = append(samples, mb)
+				sampleMu.Unlock()
+				elapsed := time.Since(startGlobal).Seconds()
+				if progressCallback != nil {
+					progressCallback(LiveProgress{
+						IP:       ip,
+						Bytes:    b,
+						Speed:    mb / elapsed,
+						Elapsed:  elapsed,
+						Duration: float64(duration),
+					})
+				}
+			case <-downloadCtx.Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	meter := byteMeterFrom(downloadCtx)
+	var readers sync.WaitGroup
+	for i, body := range bodies {
+		readers.Add(1)
+		go func(body io.Reader) {
+			defer readers.Done()
+			bufPtr := downloadBufPool.Get().(*[]byte)
+			buf := *bufPtr
+			for {
+				n, err := body.Read(buf)
+				if n > 0 {
+					atomic.AddInt64(&totalBytes, int64(n))
+					meter.add(n)
+				}
+				if err != nil {
+					break
+				}
+			}
+			downloadBufPool.Put(bufPtr)
+		}(newStallReader(body, readStallTimeout, cancels[i]))
+	}
+	readers.Wait()
+	close(done)
+
+	bytes := atomic.LoadInt64(&totalBytes)
+	finalMB := float64(bytes) / 1024.0 / 1024.0
+	sampleMu.Lock()
+	samples = append(samples, finalMB)
+	sampleMu.Unlock()
+
+	wall := time.Since(startGlobal)
+	realTime := wall.Seconds()
+	if realTime < 0.1 {
+		return StreamResult{Bytes: bytes, Elapsed: wall, CacheStatus: cacheStatus, Streams: len(bodies), Proto: proto}
+	}
+
+	avgSpeed := finalMB / realTime
+
+	if len(samples) < 2 {
+		return StreamResult{Speed: avgSpeed, MinSpeed: avgSpeed, Stability: 100.0, Bytes: bytes, Elapsed: wall, CacheStatus: cacheStatus, Streams: len(bodies), Proto: proto}
+	}
+
+	var intervalSpeeds []float64
+	for i := 1; i < len(samples); i++ {
+		dt := sampleInterval.Seconds()
+		if i == len(samples)-1 {
+			elapsed := realTime - float64(i-1)*sampleInterval.Seconds()
+			if elapsed > 0.1 {
+				dt = elapsed
+			}
+		}
+		speed := (samples[i] - samples[i-1]) / dt
+		if speed > 0 {
+			intervalSpeeds = append(intervalSpeeds, speed)
+		}
+	}
+
+	if len(intervalSpeeds) == 0 {
+		return StreamResult{Speed: avgSpeed, MinSpeed: avgSpeed, Stability: 100.0, Bytes: bytes, Elapsed: wall, CacheStatus: cacheStatus, Streams: len(bodies), Proto: proto}
+	}
+
+	minSpeed := intervalSpeeds[0]
+	var sum float64
+	for _, s := range intervalSpeeds {
+		if s < minSpeed {
+			minSpeed = s
+		}
+		sum += s
+	}
+
+	mean := sum / float64(len(intervalSpeeds))
+	if mean < 0.01 {
+		return StreamResult{Speed: avgSpeed, MinSpeed: minSpeed, Stability: 0.0, Bytes: bytes, Elapsed: wall, CacheStatus: cacheStatus, Streams: len(bodies), Proto: proto}
+	}
+	var variance float64
+	for _, s := range intervalSpeeds {
+		diff := s - mean
+		variance += diff * diff
+	}
+	variance /= float64(len(intervalSpeeds))
+	stddev := math.Sqrt(variance)
+	cv := stddev / mean
+	stability := 100.0 - cv*100.0
+	if stability < 0 {
+		stability = 0
+	}
+	if stability > 100 {
+		stability = 100
+	}
+
+	return StreamResult{Speed: avgSpeed, MinSpeed: minSpeed, Stability: stability, Bytes: bytes, Elapsed: wall, CacheStatus: cacheStatus, Streams: len(bodies), Proto: proto}
+}
+
+// MeasureLoadLatency measures TCP latency while a download is saturating the connection.
+// Uses speed.cloudflare.com as the load source (only relevant for CF URL mode).
+func MeasureLoadLatency(ctx context.Context, ip string, port int) float64 {
+	testURL := "https://speed.cloudflare.com/__down?bytes=10000000"
+	parsedURL, _ := url.Parse(testURL)
+	host := parsedURL.Hostname()
+
+	ctx, cancel := context.WithTimeout(ctx, 6*time.Second)
+	defer cancel()
+
+	client := settingsOf(ctx).client(ip, port, "")
+
+	req, err := newCFRequestWithContext(ctx, "GET", testURL)
+	if err != nil {
+		return 0
+	}
+	req.Host = host
+
+	go func() {
+		resp, err := client.Do(req)
+		if err == nil {
+			bufPtr := downloadBufPool.Get().(*[]byte)
+			buf := *bufPtr
+			for {
+				if _, err := resp.Body.Read(buf); err != nil {
+					break
+				}
+			}
+			resp.Body.Close()
+			downloadBufPool.Put(bufPtr)
+		}
+	}()
+
+	var lats []float64
+	for i := 0; i < 3; i++ {
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-ctx.Done():
+			return 0
+		}
+		if lat := TCPPing(ctx, ip, port, 2*time.Second); lat > 0 {
+			lats = append(lats, lat)
+		}
+	}
+
+	if len(lats) == 0 {
+		return 0
+	}
+	var s float64
+	for _, l := range lats {
+		s += l
+	}
+	return s / float64(len(lats))
+}
+
+func getRangeHostCount(r string) int64 {
+	if !strings.Contains(r, "/") {
+		return 1
+	}
+	_, ipNet, err := net.ParseCIDR(r)
+	if err != nil {
+		return 1
+	}
+	ones, bits := ipNet.Mask.Size()
+	hostBits := bits - ones
+	if hostBits < 0 || hostBits > 32 {
+		return 1
+	}
+	return int64(1) << uint(hostBits)
+}
+
+// GenerateIPs samples maxScan IPs from the embedded ranges, or those in ipFile.
+func GenerateIPs(maxScan int, unique bool, ipFile string) []string {
+	ranges := CloudflareIPv4Ranges
+	if ipFile != "" {
+		if content, err := os.ReadFile(ipFile); err == nil {
+			if fileRanges := parseRangeLines(string(content)); len(fileRanges) > 0 {
+				ranges = fileRanges
+			}
+		}
+	}
+	return sampleIPs(ranges, maxScan, unique)
+}
+
+// parseRangeLines returns the non-empty, non-comment lines of an IP/CIDR list.
+func parseRangeLines(content string) []string {
+	var ranges []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			ranges = append(ranges, line)
+		}
+	}
+	return ranges
+}
+
+// sampleIPs picks up to maxScan random IPs spread over ranges by size; unique keeps one per /24.
+func sampleIPs(ranges []string, maxScan int, unique bool) []string {
+	if maxScan <= 0 || len(ranges) == 0 {
+		return nil
+	}
+
+	var totalHosts int64
+	rangeHosts := make([]int64, len(ranges))
+	for i, r := range ranges {
+		h := getRangeHostCount(r)
+		rangeHosts[i] = h
+		totalHosts += h
+	}
+
+	var ips []string
+	if unique {
+		seen := make(map[string]bool)
+		attempts := 0
+		maxAttempts := maxScan * 5
+		for len(ips) < maxScan && attempts < maxAttempts {
+			attempts++
+			var r string
+			if totalHosts <= 0 {
+				r = ranges[rand.Intn(len(ranges))]
+			} else {
+				val := int64(rand.Float64() * float64(totalHosts))
+				var runningSum int64
+				for idx, h := range rangeHosts {
+					runningSum += h
+					if val < runningSum {
+						r = ranges[idx]
+						break
+					}
+				}
+				if r == "" {
+					r = ranges[len(ranges)-1]
+				}
+			}
+
+			if !strings.Contains(r, "/") {
+				if !seen[r] {
+					seen[r] = true
+					ips = append(ips, r)
+				}
+				continue
+			}
+			ip := randIPFromCIDR(r)
+			if ip == "" {
+				continue
+			}
+			parts := strings.Split(ip, ".")
+			if len(parts) == 4 {
+				subnet := parts[0] + "." + parts[1] + "." + parts[2]
+				if !seen[subnet] {
+					seen[subnet] = true
+					ips = append(ips, ip)
+				}
+			}
+		}
+		return ips
+	}
+
+	for i, r := range ranges {
+		hosts := rangeHosts[i]
+		count := int(float64(hosts) / float64(totalHosts) * float64(maxScan))
+		if count < 1 {
+			count = 1
+		}
+		if !strings.Contains(r, "/") {
+			ips = append(ips, r)
+			continue
+		}
+		for j := 0; j < count; j++ {
+			ip := randIPFromCIDR(r)
+			if ip != "" {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	rand.Shuffle(len(ips), func(i, j int) { ips[i], ips[j] = ips[j], ips[i] })
+	if len(ips) > maxScan {
+		ips = ips[:maxScan]
+	}
+	return ips
+}
+
+func TCPPing(ctx context.Context, ip string, port int, timeout time.Duration) float64 {
+	rs := settingsOf(ctx)
+	start := time.Now()
+	conn, err := rs.dialer(timeout).DialContext(ctx, "tcp", rs.dialAddr(ip, port))
+	if err != nil {
+		noteDialError(err)
+		return 0
+	}
+	conn.Close()
+	return float64(time.Since(start).Microseconds()) / 1000.0
+}
+
+// TLSPing returns the time (ms) to connect and complete a TLS handshake, or 0 on failure.
+func TLSPing(ctx context.Context, ip string, port int, sni string, timeout time.Duration) float64 {
+	rs := settingsOf(ctx)
+	start := time.Now()
+	d := &tls.Dialer{NetDialer: rs.dialer(timeout), Config: rs.tlsConfig(defaultSNI(sni))}
+	conn, err := d.DialContext(ctx, "tcp", rs.dialAddr(ip, port))
+	if err != nil {
+		noteDialError(err)
+		return 0
+	}
+	conn.Close()
+	return float64(time.Since(start).Microseconds()) / 1000.0
+}
+
+// defaultSNI is the SNI used for probes when none is configured.
+func defaultSNI(sni string) string {
+	if sni == "" {
+		return "speed.cloudflare.com"
+	}
+	return sni
+}
+
+// TLSResumeProbe returns the full and resumed handshake times (ms) and whether the edge resumed.
+func TLSResumeProbe(ctx context.Context, ip string, port int, sni string, timeout time.Duration) (fullMs, resumeMs float64, resumed bool) {
+	if sni == "" {
+		sni = "speed.cloudflare.com"
+	}
+	conf := &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         sni,
+		NextProtos:         []string{"http/1.1"},
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+	}
+	rs := settingsOf(ctx)
+	addr := rs.dialAddr(ip, port)
+
+	handshake := func(readResponse bool) (float64, bool, error) {
+		raw, err := rs.dialer(timeout).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return 0, false, err
+		}
+		defer raw.Close()
+		defer closeOnCancel(ctx, raw)()
+		raw.SetDeadline(time.Now().Add(timeout))
+		conn := tls.Client(raw, conf)
+		start := time.Now()
+		if err := conn.Handshake(); err != nil {
+			return 0, false, err
+		}
+		ms := float64(time.Since(start).Microseconds()) / 1000.0
+		if readResponse {
+			fmt.Fprintf(conn, "GET /cdn-cgi/trace HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", sni)
+			io.Copy(io.Discard, conn)
+		}
+		return ms, conn.ConnectionState().DidResume, nil
+	}
+
+	fullMs, _, err := handshake(true)
+	if err != nil {
+		return 0, 0, false
+	}
+	resumeMs, resumed, err = handshake(false)
+	if err != nil {
+		return fullMs, 0, false
+	}
+	return fullMs, resumeMs, resumed
+}
+
+var coloRe = regexp.MustCompile(`^[A-Z]+$`)
+
+// tlsConfig returns the TLS config for sni, sharing the run's session cache.
+func (rs *runSettings) tlsConfig(sni string) *tls.Config {
+	if sni == "" {
+		return rs.tls
+	}
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         sni,
+		ClientSessionCache: rs.tls.ClientSessionCache,
+	}
+}
+
+// downloadBufSize is the read buffer of download tests (see applyLowMem).
+var downloadBufSize = 256 << 10
+
+var downloadBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, downloadBufSize)
+		return &b
+	},
+}
+
+func init() {
+	for _, cidr := range CloudflareIPv4Ranges {
+		parseCIDRCached(cidr)
+	}
+}
+
+// enableHTTP2 lets tr negotiate h2 despite its custom dialer and TLS config.
+func enableHTTP2(tr *http.Transport) {
+	// Clone: enabling h2 rewrites NextProtos on the (possibly shared) config.
+	tr.TLSClientConfig = tr.TLSClientConfig.Clone()
+	tr.ForceAttemptHTTP2 = true
+}
+
+func setCFHeaders(req *http.Request) {
+	setCFHeadersForURL(req, "https://speed.cloudflare.com")
+}
+
+func setCFHeadersForURL(req *http.Request, baseURL string) {
+	setUserAgent(req.Header, settingsOf(req.Context()).userAgents.pick())
+	req.Header.Set("Accept", "*/*")
+	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
+	req.Header.Set("Referer", baseURL+"/")
+	req.Header.Set("Origin", baseURL)
+	req.Header.Set("Sec-Fetch-Dest", "empty")
+	req.Header.Set("Sec-Fetch-Mode", "cors")
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+}
+
+// setUserAgent sets ua and the client hints matching it.
+func setUserAgent(h http.Header, ua string) {
+	h.Set("User-Agent", ua)
+	h.Del("Sec-Ch-Ua")
+	h.Del("Sec-Ch-Ua-Mobile")
+	h.Del("Sec-Ch-Ua-Platform")
+	setClientHints(h.Set, ua)
+}
+
+func newCFRequest(method, urlStr string) (*http.Request, error) {
+	req, err := http.NewRequest(method, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	setCFHeaders(req)
+	return req, nil
+}
+
+func newCFRequestWithContext(ctx context.Context, method, urlStr string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	setCFHeaders(req)
+	return req, nil
+}
+
+func GetColo(ctx context.Context, ip string, port int) string {
+	colo, _ := TraceProbe(ctx, ip, port)
+	return colo
+}
+
+// TraceProbe fetches /cdn-cgi/trace once and returns the colo and whether the edge refused it.
+func TraceProbe(ctx context.Context, ip string, port int) (colo string, blocked bool) {
+	t := TraceDetails(ctx, ip, port)
+	return t.Colo, t.Blocked
+}
+
+// TraceInfo is what one /cdn-cgi/trace request through an IP reported.
+type TraceInfo struct {
+	Colo     string // "ERR", "UNK" or "429" when unavailable
+	Blocked  bool   // the edge answered 403/429
+	EgressIP string // our address as Cloudflare sees it (ip=)
+	HTTP     string // protocol of the request, e.g. "http/2" (http=)
+	TLS      string // e.g. "TLSv1.3" (tls=)
+	Warp     string // "off", "on" or "plus" (warp=)
+}
+
+// TraceDetails is TraceProbe keeping the rest of the trace.
+func TraceDetails(ctx context.Context, ip string, port int) TraceInfo {
+	client := settingsOf(ctx).client(ip, port, "")
+	client.Timeout = 4 * time.Second
+
+	req, err := newCFRequestWithContext(ctx, "GET", "https://speed.cloudflare.com/cdn-cgi/trace")
+	if err != nil {
+		return TraceInfo{Colo: "ERR"}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return TraceInfo{Colo: "ERR"}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden {
+		return TraceInfo{Colo: "429", Blocked: true}
+	}
+
+	trace, err := parseTrace(resp.Body)
+	if err != nil {
+		return TraceInfo{Colo: "UNK"}
+	}
+	t := TraceInfo{Colo: "UNK", EgressIP: trace["ip"], HTTP: trace["http"], TLS: trace["tls"], Warp: trace["warp"]}
+	if coloRe.MatchString(trace["colo"]) {
+		t.Colo = trace["colo"]
+	}
+	return t
+}
+
+// parseTrace reads the key=value lines of a trace response.
+func parseTrace(r io.Reader) (map[string]string, error) {
+	trace := make(map[string]string)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if k, v, ok := strings.Cut(sc.Text(), "="); ok {
+			trace[k] = v
+		}
+	}
+	return trace, sc.Err()
+}
+
+// LiveProgress holds real-time download progress for a single IP.
+type LiveProgress struct {
+	IP       string  `json:"ip"`
+	Bytes    int64   `json:"bytes"`
+	Speed    float64 `json:"speed"` // MB/s
+	Elapsed  float64 `json:"elapsed"`
+	Duration float64 `json:"duration"`
+}
@@ -0,0 +1,198 @@
+package cfst
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Flags can also come from CFST_<FLAG> or CFST_<CONFIG FIELD> environment variables.
+
+// envOnly are the CFST_ variables read elsewhere, not through a flag.
+var envOnly = map[string]bool{"CFST_GRAFANA_TOKEN": true, "CFST_DDNS_TOKEN": true, "CFST_SINGBOX_SECRET": true, "CFST_WEBHOOK_SECRET": true}
+
+// flagFields maps each flag bound to a Config field to the field's name.
+var flagFields = map[string]string{
+	"p":                 "Port",
+	"max":               "MaxScan",
+	"topn":              "TopN",
+	"dlc":               "DLConc",
+	"dn":                "DownloadNum",
+	"dt":                "Duration",
+	"st":                "StopThreshold",
+	"u":                 "Unique",
+	"f":                 "IPFile",
+	"ip-url":            "IPURL",
+	"strategy":          "Strategy",
+	"allip":             "AllIP",
+	"tlsping":           "TLSPing",
+	"trace-first":       "TraceFirst",
+	"dpi":               "ProbeDPI",
+	"cache-ttl":         "CacheTTL",
+	"cache-file":        "CacheFile",
+	"expand":            "Expand",
+	"expand-test":       "ExpandTest",
+	"feed":              "FeedURL",
+	"feed-key":          "FeedKey",
+	"feed-region":       "FeedRegion",
+	"feed-isp":          "FeedISP",
+	"feed-ttl":          "FeedTTL",
+	"feed-cache":        "FeedCache",
+	"history-seed":      "HistorySeed",
+	"o":                 "Output",
+	"jsonl":             "JSONL",
+	"live-top":          "LiveTop",
+	"db":                "DBFile",
+	"bind-out":          "BindOut",
+	"best-out":          "BestOut",
+	"check-443":         "Check443",
+	"bind-name":         "BindName",
+	"bind-ttl":          "BindTTL",
+	"bind-top":          "BindTop",
+	"dnsmasq-out":       "DnsmasqOut",
+	"adguard-out":       "AdGuardOut",
+	"rewrite-domains":   "RewriteDomains",
+	"rewrite-top":       "RewriteTop",
+	"hosts-domains":     "HostsDomains",
+	"hosts-file":        "HostsFile",
+	"ddns-zone":         "DDNSZone",
+	"ddns-record":       "DDNSRecord",
+	"singbox-template":  "SingBoxTemplate",
+	"singbox-out":       "SingBoxOut",
+	"singbox-tags":      "SingBoxTags",
+	"singbox-reload":    "SingBoxReload",
+	"xray-config":       "XrayConfig",
+	"xray-tag":          "XrayTag",
+	"xray-restart":      "XrayRestart",
+	"tg-token":          "TGToken",
+	"tg-chat":           "TGChat",
+	"discord-webhook":   "DiscordWebhook",
+	"slack-webhook":     "SlackWebhook",
+	"chat-events":       "ChatEvents",
+	"webhook":           "Webhook",
+	"webhook-every-run": "WebhookEveryRun",
+	"timeout":           "Deadline",
+	"offline-sources":   "OfflineSources",
+	"silent":            "Silent",
+	"daemon":            "Daemon",
+	"interval":          "Interval",
+	"daemon-state":      "DaemonState",
+	"metrics-listen":    "MetricsListen",
+	"telemetry-url":     "TelemetryURL",
+	"telemetry-epsilon": "TelemetryEps",
+	"format":            "Format",
+	"clash-template":    "ClashTemplate",
+	"raw":               "Raw",
+	"sc":                "ScanConcurrent",
+	"skip429":           "Skip429",
+	"url":               "URL",
+	"qd":                "QuickDuration",
+	"filter":            "FilterMode",
+	"sni":               "SNI",
+	"keepalive":         "DialKeepAlive",
+	"idle-conns":        "MaxIdlePerHost",
+	"idle-conn-timeout": "IdleConnTTL",
+	"tls-session-cache": "TLSSessions",
+	"target-override":   "TargetOverride",
+	"nat64":             "NAT64",
+	"nodelay":           "NoDelay",
+	"tcp-user-timeout":  "TCPUserTimeout",
+	"tfo":               "FastOpen",
+	"redirect":          "Redirect",
+	"max-redirects":     "MaxRedirects",
+	"resolve":           "Resolve",
+	"ua":                "UserAgent",
+	"ua-file":           "UAFile",
+	"ua-rotate":         "UARotate",
+	"own-zone":          "OwnZone",
+	"cache-prime":       "CachePrime",
+	"streams":           "Streams",
+	"h2":                "HTTP2",
+	"resume":            "ProbeResume",
+	"proxy":             "Proxy",
+	"proxy-switch":      "ProxySwitch",
+	"trace-fields":      "TraceFields",
+	"egress-change":     "EgressChange",
+	"cert-check":        "ProbeCert",
+	"cert-issuers":      "CertIssuers",
+	"ech":               "ProbeECH",
+	"ech-domain":        "ECHDomain",
+	"ech-config":        "ECHConfig",
+	"ws-url":            "WSURL",
+	"grpc-url":          "GRPCURL",
+	"grpc-hold":         "GRPCHold",
+	"verify":            "Verify",
+	"longevity":         "Longevity",
+	"longevity-n":       "LongevityN",
+	"history":           "HistoryFile",
+	"alert-drop":        "AlertDrop",
+	"grafana-url":       "GrafanaURL",
+	"grafana-events":    "GrafanaEvents",
+	"web-tokens":        "WebTokensFile",
+	"mem-topk":          "MemTopK",
+	"spill":             "Spill",
+	"web-jobs":          "WebJobs",
+	"idle":              "IdleTimeout",
+	"idle-exit":         "IdleExit",
+	"audit-log":         "AuditLog",
+	"sl":                "MinSpeed",
+	"jitter-weight":     "JitterWeight",
+	"n":                 "Pings",
+	"tl":                "MaxLatency",
+	"cfcolo":            "CFColo",
+	"pin-file":          "PinFile",
+	"never-select-file": "NeverSelectFile",
+	"rules":             "RulesFile",
+	"plugin-source":     "PluginSource",
+	"plugin-filter":     "PluginFilter",
+	"plugin-exporter":   "PluginExporter",
+	"geo":               "Geo",
+	"preset":            "Preset",
+	"low-mem":           "LowMem",
+	"cpu":               "CPULimit",
+}
+
+// envNames maps each flag to the variables it is read from, in lookup order.
+func envNames() map[string][]string {
+	names := make(map[string][]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name == "web" {
+			return // detected before parsing; see Main
+		}
+		names[f.Name] = []string{"CFST_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))}
+		if field, ok := flagFields[f.Name]; ok {
+			if alt := "CFST_" + strings.ToUpper(field); alt != names[f.Name][0] {
+				names[f.Name] = append(names[f.Name], alt)
+			}
+		}
+	})
+	return names
+}
+
+// applyEnv sets the flags not in set from the environment and returns unknown CFST_ names.
+func applyEnv(set map[string]bool) (unknown []string, err error) {
+	known := make(map[string]bool)
+	for name, vars := range envNames() {
+		for _, env := range vars {
+			known[env] = true
+			val, ok := os.LookupEnv(env)
+			if !ok || set[name] {
+				continue
+			}
+			if err := flag.Set(name, val); err != nil {
+				return nil, fmt.Errorf("invalid value %q for %s: %v", val, env, err)
+			}
+			set[name] = true
+		}
+	}
+	for _, kv := range os.Environ() {
+		env, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(env, "CFST_") && !known[env] && !envOnly[env] {
+			unknown = append(unknown, env)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
@@ -0,0 +1,72 @@
+package cfst
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// TestFlagFieldsMatchMain checks flagFields against the flags Main binds.
+func TestFlagFieldsMatchMain(t *testing.T) {
+	src, err := os.ReadFile("cli.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound := regexp.MustCompile(`flag\.\w*Var\(&cfg\.(\w+), "([^"]+)"`).FindAllStringSubmatch(string(src), -1)
+	if len(bound) != len(flagFields) {
+		t.Errorf("Main binds %d flags to Config fields, flagFields has %d", len(bound), len(flagFields))
+	}
+	for _, m := range bound {
+		if got := flagFields[m[2]]; got != m[1] {
+			t.Errorf("-%s: flagFields says %q, Main binds it to %s", m[2], got, m[1])
+		}
+	}
+	cfgType := reflect.TypeOf(Config{})
+	for name, field := range flagFields {
+		if _, ok := cfgType.FieldByName(field); !ok {
+			t.Errorf("-%s: Config has no field %s", name, field)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	saved := flag.CommandLine
+	defer func() { flag.CommandLine = saved }()
+
+	for _, tc := range []struct {
+		name string
+		env  map[string]string
+		set  bool // given on the command line
+		want int
+	}{
+		{"flag name", map[string]string{"CFST_DN": "7"}, false, 7},
+		{"field name", map[string]string{"CFST_DOWNLOADNUM": "8"}, false, 8},
+		{"command line wins", map[string]string{"CFST_DN": "7"}, true, 10},
+	} {
+		flag.CommandLine = flag.NewFlagSet("cfst", flag.ContinueOnError)
+		cfg := DefaultConfig()
+		flag.IntVar(&cfg.DownloadNum, "dn", 10, "")
+		for k, v := range tc.env {
+			t.Setenv(k, v)
+		}
+		if _, err := applyEnv(map[string]bool{"dn": tc.set}); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if cfg.DownloadNum != tc.want {
+			t.Errorf("%s: DownloadNum = %d, want %d", tc.name, cfg.DownloadNum, tc.want)
+		}
+		for k := range tc.env {
+			os.Unsetenv(k)
+		}
+	}
+
+	t.Setenv("CFST_DOWNLOAD_NUMBER", "3")
+	flag.CommandLine = flag.NewFlagSet("cfst", flag.ContinueOnError)
+	flag.Int("dn", 10, "")
+	if unknown, _ := applyEnv(map[string]bool{}); !slices.Contains(unknown, "CFST_DOWNLOAD_NUMBER") {
+		t.Errorf("unknown = %v, want the misspelt CFST_DOWNLOAD_NUMBER", unknown)
+	}
+}
@@ -0,0 +1,42 @@
+package cfst
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// The failures of a Runner or Scan, to branch on with errors.Is.
+var (
+	// ErrNoValidIPs: no IP answered the ping scan or survived the filters.
+	ErrNoValidIPs = errors.New("no valid IPs found")
+	// ErrAllRateLimited: every download test failed or was rate-limited.
+	ErrAllRateLimited = errors.New("all tested IPs failed or were rate-limited")
+	// ErrURLInvalid: Config.URL isn't an http(s) URL with a host.
+	ErrURLInvalid = errors.New("invalid test URL")
+	// ErrCancelled: ctx ended before any download test completed.
+	ErrCancelled = errors.New("cancelled")
+)
+
+// checkTestURL returns an ErrURLInvalid error if s can't be a download test URL.
+func checkTestURL(s string) error {
+	u, err := url.Parse(s)
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w: %v", ErrURLInvalid, err)
+	case u.Scheme != "http" && u.Scheme != "https":
+		return fmt.Errorf("%w %q: needs http:// or https://", ErrURLInvalid, s)
+	case u.Hostname() == "":
+		return fmt.Errorf("%w %q: no host", ErrURLInvalid, s)
+	}
+	return nil
+}
+
+// runError is err, or ErrCancelled when ctx ended first.
+func runError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %w", ErrCancelled, context.Cause(ctx))
+	}
+	return err
+}
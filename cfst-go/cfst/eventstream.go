@@ -0,0 +1,118 @@
+package cfst
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventStream writes a job's events as server-sent events or NDJSON.
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	ndjson  bool
+	job     *jobLog
+
+	mu        sync.Mutex
+	closed    bool
+	completed bool   // a "complete" event was sent
+	lastError string // data of the last "error" event
+}
+
+// startStream opens the event stream for a job request; the caller must call done.
+func startStream(w http.ResponseWriter, r *http.Request, serverCtx context.Context, job *jobLog) (s *eventStream, ctx context.Context, done func(), ok bool) {
+	s = &eventStream{w: w, ndjson: wantsNDJSON(r), job: job}
+	if s.ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	if s.flusher, ok = w.(http.Flusher); !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return nil, nil, nil, false
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	stopWatch := context.AfterFunc(serverCtx, func() {
+		s.send("server_shutdown", "Server is shutting down; the test was stopped.")
+		s.close()
+		cancel()
+	})
+	done = func() {
+		stopWatch()
+		cancel()
+		s.close() // w must not be touched once the handler returns
+		job.end(s.outcome(serverCtx.Err() != nil))
+	}
+	s.send("job", map[string]int64{"id": job.info.ID})
+	return s, ctx, done, true
+}
+
+func (s *eventStream) send(evtType string, data interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch evtType {
+	case "complete":
+		s.completed = true
+	case "error":
+		s.lastError = fmt.Sprint(data)
+	}
+	s.job.add(evtType, data)
+	if s.closed {
+		return
+	}
+	if s.ndjson {
+		json.NewEncoder(s.w).Encode(map[string]interface{}{"event": evtType, "data": data})
+	} else {
+		b, _ := json.Marshal(data)
+		fmt.Fprintf(s.w, "event: %s\ndata: ", evtType)
+		s.w.Write(b)
+		fmt.Fprint(s.w, "\n\n")
+	}
+	s.flusher.Flush()
+}
+
+// close drops every later event.
+func (s *eventStream) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+}
+
+// outcome describes for the audit and job logs how the job ended.
+func (s *eventStream) outcome(shutdown bool) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.completed:
+		return "complete"
+	case shutdown:
+		return "shutdown"
+	case s.lastError != "":
+		return "error: " + s.lastError
+	default:
+		return "cancelled"
+	}
+}
+
+// startAudit logs the start of the job behind r and returns the func that logs its end.
+func startAudit(cfg Config, r *http.Request, s *eventStream, serverCtx context.Context, stats *DownloadStats, timer *phaseTimer) func(results int) {
+	entry := newAuditEntry(r, cfg.Namespace, s.job.info.ID)
+	entry.Time, entry.Event = time.Now(), "start"
+	appendAudit(cfg.AuditLog, entry)
+	return func(results int) {
+		entry.Time, entry.Event = time.Now(), "end"
+		entry.Outcome = s.outcome(serverCtx.Err() != nil)
+		entry.Results = results
+		entry.Tested = int(stats.Tested.Load())
+		entry.TotalMB = float64(stats.Bytes.Load()) / 1024 / 1024
+		entry.Seconds = time.Since(timer.start).Seconds()
+		appendAudit(cfg.AuditLog, entry)
+	}
+}
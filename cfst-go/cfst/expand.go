@@ -0,0 +1,72 @@
+package cfst
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// -expand scans the /24 around each winner and download-tests its best hosts.
+
+// neighborIPs returns every host of each winner's /24 that is not in seen.
+func neighborIPs(winners []NodeResult, seen map[string]bool) []string {
+	var ips []string
+	subnets := make(map[string]bool)
+	for _, w := range winners {
+		ip := net.ParseIP(w.IP).To4()
+		if ip == nil {
+			continue
+		}
+		prefix := fmt.Sprintf("%d.%d.%d.", ip[0], ip[1], ip[2])
+		if subnets[prefix] {
+			continue
+		}
+		subnets[prefix] = true
+		for host := 1; host < 255; host++ {
+			candidate := fmt.Sprintf("%s%d", prefix, host)
+			if !seen[candidate] {
+				ips = append(ips, candidate)
+			}
+		}
+	}
+	return ips
+}
+
+// expandNeighbors merges the best neighbors of the top results into results.
+func expandNeighbors(ctx context.Context, results []NodeResult, cfg Config, stats *DownloadStats,
+	progressRow func(res NodeResult),
+	progressStatus func(msg string)) ([]NodeResult, int) {
+
+	var winners []NodeResult
+	seen := make(map[string]bool)
+	for _, r := range results {
+		seen[r.IP] = true
+		if r.DownloadSpeed > 0 && len(winners) < cfg.Expand {
+			winners = append(winners, r)
+		}
+	}
+	ips := neighborIPs(winners, seen)
+	if len(ips) == 0 {
+		return results, 0
+	}
+
+	if progressStatus != nil {
+		progressStatus(fmt.Sprintf("Neighbor expansion: scanning %d IPs around %d winner(s)...", len(ips), len(winners)))
+	}
+	found, _ := ScanPingBounded(ctx, ips, cfg.Port, cfg.ScanConcurrent, cfg.ExpandTest, pingerFor(cfg), nil, nil)
+	if len(found) == 0 {
+		return results, len(ips)
+	}
+
+	if progressStatus != nil {
+		progressStatus(fmt.Sprintf("Neighbor expansion: testing %d best neighbors...", len(found)))
+	}
+	testCfg := cfg
+	testCfg.DownloadNum = len(found)
+	extra := runParallelDownloadTest(ctx, found, testCfg, stats, progressRow, nil, nil, nil)
+
+	merged := append(append([]NodeResult(nil), results...), extra...)
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Score > merged[j].Score })
+	return merged, len(ips)
+}
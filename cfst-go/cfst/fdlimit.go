@@ -0,0 +1,30 @@
+package cfst
+
+import "fmt"
+
+// Scan concurrency is capped to what the raised descriptor limit allows.
+
+// fdOverhead is what a job needs besides its scan probes.
+func fdOverhead(cfg Config) int {
+	return 64 + cfg.DLConc*max(cfg.Streams, 1)
+}
+
+// fitConcurrency caps cfg.ScanConcurrent to the descriptors of one of jobs jobs, noting any change.
+func fitConcurrency(cfg *Config, jobs int) string {
+	limit, err := raiseFDLimit()
+	if limit == 0 {
+		return ""
+	}
+	budget := (int(min(limit, 1<<20)) - fdOverhead(*cfg)) / max(jobs, 1)
+	if cfg.ScanConcurrent <= budget {
+		return ""
+	}
+	budget = max(budget, 16)
+	note := fmt.Sprintf("Open-file limit is %d, so scan concurrency is capped from %d to %d", limit, cfg.ScanConcurrent, budget)
+	if err != nil {
+		note += fmt.Sprintf(" (raising it failed: %v)", err)
+	}
+	note += "; raise it with `ulimit -n` to scan faster."
+	cfg.ScanConcurrent = budget
+	return note
+}
@@ -0,0 +1,180 @@
+package cfst
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// -feed samples half of -max from a signed community list of working ranges.
+
+const defaultFeedCacheFile = "cfst-feed.json"
+
+// signedFeed is the document served at the feed URL.
+type signedFeed struct {
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// FeedEntry is the ranges the feed recommends for one region and ISP.
+type FeedEntry struct {
+	Region string   `json:"region"`
+	ISP    string   `json:"isp"`
+	Ranges []string `json:"ranges"`
+}
+
+// Feed is a verified feed payload.
+type Feed struct {
+	Updated time.Time   `json:"updated"`
+	Entries []FeedEntry `json:"entries"`
+}
+
+// verifyFeed checks doc's signature against key and decodes its payload.
+func verifyFeed(doc []byte, key ed25519.PublicKey) (*Feed, error) {
+	var signed signedFeed
+	if err := json.Unmarshal(doc, &signed); err != nil {
+		return nil, fmt.Errorf("feed: %v", err)
+	}
+	payload, err := base64.StdEncoding.DecodeString(signed.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("feed payload: %v", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil || !ed25519.Verify(key, payload, sig) {
+		return nil, fmt.Errorf("feed signature does not match -feed-key")
+	}
+	var feed Feed
+	if err := json.Unmarshal(payload, &feed); err != nil {
+		return nil, fmt.Errorf("feed payload: %v", err)
+	}
+	return &feed, nil
+}
+
+// parseFeedKey decodes a base64 ed25519 public key.
+func parseFeedKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("-feed-key must be a base64 ed25519 public key")
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// ranges returns the ranges of the entries matching regions and isps (empty matches all).
+func (f *Feed) ranges(regions, isps string) []string {
+	var out []string
+	for _, e := range f.Entries {
+		if feedMatch(regions, e.Region) && feedMatch(isps, e.ISP) {
+			out = append(out, e.Ranges...)
+		}
+	}
+	return out
+}
+
+func feedMatch(list, value string) bool {
+	if list == "" {
+		return true
+	}
+	for _, want := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(want), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// FeedSource samples from the ranges of a signed community feed.
+type FeedSource struct {
+	URL     string
+	Key     ed25519.PublicKey
+	Regions string        // comma list; "" = all
+	ISPs    string        // comma list; "" = all
+	TTL     time.Duration // re-fetch once the cached copy is older
+	Cache   string        // file the verified document is kept in ("" = none)
+	Unique  bool
+}
+
+func (s FeedSource) IPs(ctx context.Context, max int) ([]string, error) {
+	feed, err := s.load(ctx)
+	if feed == nil {
+		return nil, err
+	}
+	ranges := parseRangeLines(strings.Join(feed.ranges(s.Regions, s.ISPs), "\n"))
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("feed has no ranges for region %q, ISP %q", s.Regions, s.ISPs)
+	}
+	return sampleIPs(ranges, max, s.Unique), err
+}
+
+// load returns the cached feed while fresh, else fetches it, falling back to the stale copy.
+func (s FeedSource) load(ctx context.Context) (*Feed, error) {
+	var cached *Feed
+	if s.Cache != "" {
+		if doc, err := os.ReadFile(s.Cache); err == nil {
+			cached, _ = verifyFeed(doc, s.Key)
+			if info, err := os.Stat(s.Cache); cached != nil && err == nil && time.Since(info.ModTime()) < s.TTL {
+				return cached, nil
+			}
+		}
+	}
+	doc, err := fetchFeed(ctx, s.URL)
+	var feed *Feed
+	if err == nil {
+		feed, err = verifyFeed(doc, s.Key)
+	}
+	if err != nil {
+		if cached != nil {
+			return cached, fmt.Errorf("%v; using the cached feed", err)
+		}
+		return nil, err
+	}
+	if s.Cache != "" {
+		os.WriteFile(s.Cache, doc, 0644)
+	}
+	return feed, nil
+}
+
+func fetchFeed(ctx context.Context, url string) ([]byte, error) {
+	if settingsOf(ctx).offline {
+		return nil, errOffline
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching feed %s: HTTP %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+}
+
+// withFeed gives feed up to half of the budget and base the rest.
+func withFeed(feed, base IPSource) IPSource {
+	return IPSourceFunc(func(ctx context.Context, max int) ([]string, error) {
+		feedIPs, ferr := feed.IPs(ctx, max/2)
+		baseIPs, berr := base.IPs(ctx, max-len(feedIPs))
+		seen := make(map[string]bool, len(feedIPs)+len(baseIPs))
+		var ips []string
+		for _, ip := range append(feedIPs, baseIPs...) {
+			if !seen[ip] {
+				seen[ip] = true
+				ips = append(ips, ip)
+			}
+		}
+		return ips, errors.Join(ferr, berr)
+	})
+}
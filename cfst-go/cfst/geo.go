@@ -0,0 +1,146 @@
+package cfst
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AlertColoDetour flags a nearby colo whose latency is far above what the distance allows.
+const AlertColoDetour = "colo_detour"
+
+// coloSite is where a colo is and which country it serves.
+type coloSite struct {
+	Lat, Lon float64
+	Country  string
+}
+
+// coloSites covers the major Cloudflare colos (IATA codes).
+var coloSites = map[string]coloSite{
+	"HKG": {22.31, 113.91, "HK"}, "TPE": {25.08, 121.23, "TW"}, "NRT": {35.77, 140.39, "JP"},
+	"KIX": {34.43, 135.24, "JP"}, "FUK": {33.59, 130.45, "JP"}, "OKA": {26.20, 127.65, "JP"},
+	"ICN": {37.46, 126.44, "KR"}, "SIN": {1.36, 103.99, "SG"}, "KUL": {2.74, 101.71, "MY"},
+	"BKK": {13.69, 100.75, "TH"}, "MNL": {14.51, 121.02, "PH"}, "SGN": {10.82, 106.65, "VN"},
+	"HAN": {21.22, 105.81, "VN"}, "CGK": {-6.13, 106.66, "ID"}, "BOM": {19.09, 72.87, "IN"},
+	"DEL": {28.56, 77.10, "IN"}, "MAA": {12.99, 80.17, "IN"}, "BLR": {13.20, 77.71, "IN"},
+	"PEK": {40.08, 116.58, "CN"}, "SHA": {31.20, 121.34, "CN"}, "CAN": {23.39, 113.30, "CN"},
+	"CTU": {30.58, 103.95, "CN"}, "SYD": {-33.95, 151.18, "AU"}, "MEL": {-37.67, 144.84, "AU"},
+	"AKL": {-37.01, 174.79, "NZ"}, "SJC": {37.36, -121.93, "US"}, "LAX": {33.94, -118.41, "US"},
+	"SEA": {47.45, -122.31, "US"}, "PDX": {45.59, -122.60, "US"}, "DFW": {32.90, -97.04, "US"},
+	"ORD": {41.97, -87.91, "US"}, "IAD": {38.95, -77.46, "US"}, "EWR": {40.69, -74.17, "US"},
+	"ATL": {33.64, -84.43, "US"}, "MIA": {25.79, -80.29, "US"}, "DEN": {39.86, -104.67, "US"},
+	"PHX": {33.43, -112.01, "US"}, "YYZ": {43.68, -79.63, "CA"}, "YVR": {49.19, -123.18, "CA"},
+	"YUL": {45.47, -73.74, "CA"}, "MEX": {19.44, -99.07, "MX"}, "GRU": {-23.43, -46.47, "BR"},
+	"EZE": {-34.82, -58.54, "AR"}, "SCL": {-33.39, -70.79, "CL"}, "BOG": {4.70, -74.15, "CO"},
+	"LIM": {-12.02, -77.11, "PE"}, "LHR": {51.47, -0.45, "GB"}, "MAN": {53.35, -2.27, "GB"},
+	"CDG": {49.01, 2.55, "FR"}, "MRS": {43.44, 5.22, "FR"}, "FRA": {50.04, 8.56, "DE"},
+	"DUS": {51.29, 6.77, "DE"}, "MUC": {48.35, 11.79, "DE"}, "AMS": {52.31, 4.76, "NL"},
+	"BRU": {50.90, 4.48, "BE"}, "ZRH": {47.46, 8.55, "CH"}, "MAD": {40.47, -3.56, "ES"},
+	"BCN": {41.30, 2.08, "ES"}, "MXP": {45.63, 8.72, "IT"}, "FCO": {41.80, 12.25, "IT"},
+	"VIE": {48.11, 16.57, "AT"}, "WAW": {52.17, 20.97, "PL"}, "PRG": {50.10, 14.26, "CZ"},
+	"ARN": {59.65, 17.92, "SE"}, "CPH": {55.62, 12.66, "DK"}, "OSL": {60.19, 11.10, "NO"},
+	"HEL": {60.32, 24.96, "FI"}, "DUB": {53.42, -6.27, "IE"}, "LIS": {38.77, -9.13, "PT"},
+	"ATH": {37.94, 23.94, "GR"}, "IST": {41.26, 28.74, "TR"}, "OTP": {44.57, 26.09, "RO"},
+	"KBP": {50.35, 30.89, "UA"}, "DME": {55.41, 37.90, "RU"}, "LED": {59.80, 30.26, "RU"},
+	"TLV": {32.01, 34.89, "IL"}, "DXB": {25.25, 55.36, "AE"}, "DOH": {25.27, 51.61, "QA"},
+	"JNB": {-26.14, 28.25, "ZA"}, "CPT": {-33.97, 18.60, "ZA"}, "LOS": {6.58, 3.32, "NG"},
+	"NBO": {-1.32, 36.93, "KE"}, "CAI": {30.12, 31.41, "EG"},
+}
+
+// Detour thresholds: ~1 ms of round trip per 100 km, plus slack for paths and the last mile.
+const (
+	fiberKmPerRTTms = 100.0
+	detourFactor    = 2.5
+	detourSlackMs   = 30.0
+	nearbyColoKm    = 3000.0 // only colos this close are expected to be fast
+)
+
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const r = 6371.0
+	rad := math.Pi / 180
+	dLat, dLon := (lat2-lat1)*rad, (lon2-lon1)*rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * r * math.Asin(math.Sqrt(a))
+}
+
+// countryOrigin approximates a country's location by its colos' centroid.
+func countryOrigin(country string) (lat, lon float64, ok bool) {
+	n := 0
+	for _, s := range coloSites {
+		if s.Country == country {
+			lat, lon = lat+s.Lat, lon+s.Lon
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, 0, false
+	}
+	return lat / float64(n), lon / float64(n), true
+}
+
+// geoOrigin resolves the user's approximate location from -geo or this host's trace.
+func geoOrigin(ctx context.Context, geo string) (lat, lon float64, ok bool) {
+	if a, b, found := strings.Cut(geo, ","); found {
+		lat, err1 := strconv.ParseFloat(strings.TrimSpace(a), 64)
+		lon, err2 := strconv.ParseFloat(strings.TrimSpace(b), 64)
+		return lat, lon, err1 == nil && err2 == nil
+	}
+	if geo == "" {
+		trace, err := localTrace(ctx)
+		if err != nil {
+			return 0, 0, false
+		}
+		geo = trace["loc"]
+	}
+	return countryOrigin(strings.ToUpper(geo))
+}
+
+// detectColoDetours checks each nearby colo's median latency against its distance.
+func detectColoDetours(colos []ColoCount, lat, lon float64) []Alert {
+	type candidate struct {
+		c  ColoCount
+		km float64
+	}
+	var near []candidate
+	for _, c := range colos {
+		site, ok := coloSites[c.Colo]
+		if !ok {
+			continue
+		}
+		if km := haversineKm(lat, lon, site.Lat, site.Lon); km <= nearbyColoKm {
+			near = append(near, candidate{c, km})
+		}
+	}
+	sort.Slice(near, func(i, j int) bool { return near[i].km < near[j].km })
+
+	var alerts []Alert
+	for _, n := range near {
+		expected := n.km/fiberKmPerRTTms*detourFactor + detourSlackMs
+		if n.c.MedianLatency <= expected {
+			continue
+		}
+		alerts = append(alerts, Alert{
+			Type: AlertColoDetour,
+			Message: fmt.Sprintf("%s is ~%.0f km away but its median latency is %.0f ms (expected ≲ %.0f ms): traffic to it likely takes a routing detour",
+				n.c.Colo, n.km, n.c.MedianLatency, expected),
+			Current:  n.c.MedianLatency,
+			Baseline: expected,
+		})
+	}
+	return alerts
+}
+
+// coloDetours resolves the origin for cfg and checks colos against it.
+func coloDetours(ctx context.Context, cfg Config, colos []ColoCount) []Alert {
+	if len(colos) == 0 || cfg.Geo == "off" {
+		return nil
+	}
+	lat, lon, ok := geoOrigin(ctx, cfg.Geo)
+	if !ok {
+		return nil
+	}
+	return detectColoDetours(colos, lat, lon)
+}
@@ -0,0 +1,56 @@
+package cfst
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// grafanaAnnotation is the body of POST /api/annotations.
+type grafanaAnnotation struct {
+	Time int64    `json:"time"` // epoch ms
+	Tags []string `json:"tags"`
+	Text string   `json:"text"`
+}
+
+// postGrafanaAnnotation posts one annotation to the Grafana instance at baseURL.
+func postGrafanaAnnotation(baseURL, token string, at time.Time, tags []string, text string) error {
+	if processSettings.offline {
+		return errOffline
+	}
+	body, err := json.Marshal(grafanaAnnotation{Time: at.UnixMilli(), Tags: tags, Text: text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(baseURL, "/")+"/api/annotations", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("grafana returned %s", resp.Status)
+	}
+	return nil
+}
+
+// grafanaEventEnabled reports whether event ("complete" or "change") is listed in the -grafana-events spec.
+func grafanaEventEnabled(spec, event string) bool {
+	for _, e := range strings.Split(spec, ",") {
+		if strings.TrimSpace(e) == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package cfst
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// GRPCProbe holds a gRPC-style HTTP/2 stream through ip:port for hold and checks its trailer.
+func GRPCProbe(ctx context.Context, ip string, port int, grpcURL string, customSNI string, hold time.Duration) (status string, held float64) {
+	u, err := url.Parse(grpcURL)
+	if err != nil {
+		return "url", 0
+	}
+	sni := u.Hostname()
+	if customSNI != "" {
+		sni = customSNI
+	}
+	rs := settingsOf(ctx)
+	tr := rs.pinnedTransport(ip, port, sni)
+	enableHTTP2(tr)
+	defer tr.CloseIdleConnections()
+	client := &http.Client{Transport: tr, CheckRedirect: rs.checkRedirect}
+
+	probeCtx, cancel := context.WithTimeout(ctx, hold+10*time.Second)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	req, err := http.NewRequestWithContext(probeCtx, "POST", grpcURL, pr)
+	if err != nil {
+		return "url", 0
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	req.Header.Set("User-Agent", "grpc-go/1.60.0")
+
+	start := time.Now()
+	go func() {
+		// Empty length-prefixed message: compressed flag + 4-byte length.
+		frame := []byte{0, 0, 0, 0, 0}
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		deadline := time.After(hold)
+		for {
+			if _, err := pw.Write(frame); err != nil {
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-deadline:
+				pw.Close()
+				return
+			case <-probeCtx.Done():
+				pw.CloseWithError(probeCtx.Err())
+				return
+			}
+		}
+	}()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		pr.Close()
+		return "reset", time.Since(start).Seconds()
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		pr.Close()
+		return "no-h2", time.Since(start).Seconds()
+	}
+	if resp.StatusCode != http.StatusOK {
+		pr.Close()
+		return fmt.Sprintf("http-%d", resp.StatusCode), time.Since(start).Seconds()
+	}
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return "reset", time.Since(start).Seconds()
+	}
+	held = time.Since(start).Seconds()
+	// Trailers-only responses carry grpc-status in the headers.
+	if resp.Trailer.Get("Grpc-Status") == "" && resp.Header.Get("Grpc-Status") == "" {
+		return "no-trailer", held
+	}
+	return "ok", held
+}
@@ -0,0 +1,86 @@
+package cfst
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultLatencyBuckets are the upper bounds (ms) of the latency histogram.
+var defaultLatencyBuckets = []float64{50, 100, 150, 200, 300, 500}
+
+// LatencyBucket counts valid IPs whose average latency is at most UpTo ms.
+type LatencyBucket struct {
+	UpTo  float64 `json:"up_to,omitempty"`
+	Count int     `json:"count"`
+}
+
+func (b LatencyBucket) Label() string {
+	if b.UpTo == 0 {
+		return "slower"
+	}
+	return fmt.Sprintf("<=%gms", b.UpTo)
+}
+
+// latencyHistogram is filled concurrently by the ping scan.
+type latencyHistogram struct {
+	mu      sync.Mutex
+	buckets []LatencyBucket
+}
+
+func newLatencyHistogram(bounds []float64) *latencyHistogram {
+	if len(bounds) == 0 {
+		bounds = defaultLatencyBuckets
+	}
+	h := &latencyHistogram{}
+	for _, b := range bounds {
+		h.buckets = append(h.buckets, LatencyBucket{UpTo: b})
+	}
+	h.buckets = append(h.buckets, LatencyBucket{})
+	return h
+}
+
+func (h *latencyHistogram) add(ms float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := sort.Search(len(h.buckets)-1, func(i int) bool { return ms <= h.buckets[i].UpTo })
+	h.buckets[i].Count++
+}
+
+// snapshot returns a copy of the buckets.
+func (h *latencyHistogram) snapshot() []LatencyBucket {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]LatencyBucket(nil), h.buckets...)
+}
+
+// parseLatencyBuckets parses a comma list of ms bounds such as "50,100,200".
+func parseLatencyBuckets(s string) ([]float64, error) {
+	var bounds []float64
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid latency bucket %q", f)
+		}
+		bounds = append(bounds, v)
+	}
+	sort.Float64s(bounds)
+	return bounds, nil
+}
+
+// printLatencyHistogram draws one bar per bucket, scaled to the fullest one.
+func printLatencyHistogram(buckets []LatencyBucket) {
+	peak := 0
+	for _, b := range buckets {
+		peak = max(peak, b.Count)
+	}
+	if peak == 0 {
+		return
+	}
+	fmt.Println("  Latency histogram:")
+	for _, b := range buckets {
+		fmt.Printf("    %-8s %5d %s\n", b.Label(), b.Count, strings.Repeat("█", (b.Count*30+peak-1)/peak))
+	}
+}
@@ -0,0 +1,150 @@
+package cfst
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HistoryRecord is one download measurement appended to the -history file.
+type HistoryRecord struct {
+	Time        time.Time `json:"time"`
+	Hour        int       `json:"hour"` // local hour of day, 0-23
+	IP          string    `json:"ip"`
+	Colo        string    `json:"colo"`
+	TCPLatency  float64   `json:"tcp_latency"`
+	Speed       float64   `json:"download_speed"`
+	Score       float64   `json:"score"`
+	RateLimited bool      `json:"rate_limited,omitempty"`
+	TestedAt    time.Time `json:"tested_at"` // when this IP was measured; Time is the run
+}
+
+// MarshalJSON leaves tested_at out of records of untested results.
+func (h HistoryRecord) MarshalJSON() ([]byte, error) {
+	type plain HistoryRecord
+	return json.Marshal(struct {
+		plain
+		TestedAt *time.Time `json:"tested_at,omitempty"`
+	}{plain(h), optionalTime(h.TestedAt)})
+}
+
+// appendHistory appends one record per result to the JSON-lines file at path.
+func appendHistory(path string, results []NodeResult, at time.Time) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	local := at.Local()
+	for _, r := range results {
+		if err := enc.Encode(HistoryRecord{
+			Time:        at.UTC(),
+			Hour:        local.Hour(),
+			IP:          r.IP,
+			Colo:        r.Colo,
+			TCPLatency:  r.TCPLatency,
+			Speed:       r.DownloadSpeed,
+			Score:       r.Score,
+			RateLimited: r.Colo == "429",
+			TestedAt:    r.TestedAt,
+		}); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// loadHistory reads every record from path, skipping malformed lines.
+func loadHistory(path string) ([]HistoryRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []HistoryRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var rec HistoryRecord
+		if json.Unmarshal(sc.Bytes(), &rec) == nil {
+			records = append(records, rec)
+		}
+	}
+	return records, sc.Err()
+}
+
+// todBucketHours is the width of one time-of-day bucket.
+const todBucketHours = 4
+
+// TimeOfDayRow is the median speed of one IP or colo per time-of-day bucket.
+type TimeOfDayRow struct {
+	Key     string    `json:"key"`
+	Samples int       `json:"samples"`
+	Buckets []float64 `json:"buckets"` // median MB/s per bucket, 0 = no data
+}
+
+// timeOfDayReport groups successful measurements by colo (or IP) and local hour.
+func timeOfDayReport(records []HistoryRecord, byIP bool) []TimeOfDayRow {
+	nBuckets := 24 / todBucketHours
+	speeds := make(map[string][][]float64)
+	for _, rec := range records {
+		if rec.RateLimited || rec.Speed <= 0 {
+			continue
+		}
+		key := rec.Colo
+		if byIP {
+			key = rec.IP
+		}
+		if speeds[key] == nil {
+			speeds[key] = make([][]float64, nBuckets)
+		}
+		b := rec.Hour / todBucketHours
+		speeds[key][b] = append(speeds[key][b], rec.Speed)
+	}
+
+	var rows []TimeOfDayRow
+	for key, buckets := range speeds {
+		row := TimeOfDayRow{Key: key, Buckets: make([]float64, nBuckets)}
+		for i, vals := range buckets {
+			sort.Float64s(vals)
+			row.Buckets[i] = median(vals)
+			row.Samples += len(vals)
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Samples > rows[j].Samples })
+	return rows
+}
+
+func printTimeOfDayReport(rows []TimeOfDayRow, byIP bool) {
+	label := "Colo"
+	if byIP {
+		label = "IP"
+	}
+	fmt.Printf("%-16s %7s", label, "Samples")
+	for h := 0; h < 24; h += todBucketHours {
+		fmt.Printf("  %02d-%02dh", h, h+todBucketHours)
+	}
+	fmt.Println()
+	fmt.Println(strings.Repeat("-", 24+9*(24/todBucketHours)))
+	for _, row := range rows {
+		fmt.Printf("%-16s %7d", row.Key, row.Samples)
+		for _, v := range row.Buckets {
+			if v == 0 {
+				fmt.Printf("  %6s", "-")
+			} else {
+				fmt.Printf("  %6.2f", v)
+			}
+		}
+		fmt.Println()
+	}
+	fmt.Println("(median MB/s per local time bucket)")
+}
@@ -0,0 +1,107 @@
+package cfst
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// -hosts-domains points domains at the best result in a marked block of the hosts file.
+
+const (
+	hostsBegin = "# BEGIN cfst (managed by cfst, replaced on every run)"
+	hostsEnd   = "# END cfst"
+)
+
+// defaultHostsFile returns this system's hosts file.
+func defaultHostsFile() string {
+	if runtime.GOOS == "windows" {
+		root := os.Getenv("SystemRoot")
+		if root == "" {
+			root = `C:\Windows`
+		}
+		return filepath.Join(root, "System32", "drivers", "etc", "hosts")
+	}
+	return "/etc/hosts"
+}
+
+// stripHostsBlock removes the cfst block (markers included) from content.
+func stripHostsBlock(content string) string {
+	var kept []string
+	inBlock := false
+	for _, line := range strings.SplitAfter(content, "\n") {
+		switch trimmed := strings.TrimSpace(line); {
+		case strings.HasPrefix(trimmed, "# BEGIN cfst"):
+			inBlock = true
+		case inBlock && trimmed == hostsEnd:
+			inBlock = false
+		case !inBlock:
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
+
+// formatHostsBlock renders the block pointing each domain at r.
+func formatHostsBlock(r NodeResult, domains []string) string {
+	var b strings.Builder
+	b.WriteString(hostsBegin + "\n")
+	if altPort(r) {
+		fmt.Fprintf(&b, "# measured on %s\n", resultAddr(r.IP, r.Port))
+	}
+	for _, d := range domains {
+		fmt.Fprintf(&b, "%s %s\n", r.IP, d)
+	}
+	b.WriteString(hostsEnd + "\n")
+	return b.String()
+}
+
+// rewriteHostsFile replaces the cfst block of the hosts file ("" removes it).
+func rewriteHostsFile(path, block string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	content := string(data)
+	nl := "\n"
+	if strings.Contains(content, "\r\n") {
+		nl = "\r\n"
+	}
+	content = stripHostsBlock(content)
+	if block != "" {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += nl
+		}
+		content += strings.ReplaceAll(block, "\n", nl)
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	// Written in place: /etc/hosts is often a bind mount.
+	return os.WriteFile(path, []byte(content), mode)
+}
+
+// writeHosts points the -hosts-domains at the best result.
+func writeHosts(cfg Config, results []NodeResult) error {
+	domains := parseDomainList(cfg.HostsDomains)
+	best := bestResult(forPortless(results, cfg.Check443))
+	if best == nil {
+		return fmt.Errorf("no usable result to point the hosts file at")
+	}
+	return rewriteHostsFile(cfg.HostsFile, formatHostsBlock(*best, domains))
+}
+
+// cleanHosts removes the cfst block from the hosts file, reporting whether there was one.
+func cleanHosts(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if stripHostsBlock(string(data)) == string(data) {
+		return false, nil
+	}
+	return true, rewriteHostsFile(path, "")
+}
@@ -0,0 +1,79 @@
+package cfst
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+// Idle web servers drop their caches and, with IdleExit, exit for socket activation.
+
+// releaseCaches drops process-wide caches and returns freed memory to the OS.
+func releaseCaches() {
+	cidrCache.Range(func(k, _ any) bool {
+		cidrCache.Delete(k)
+		return true
+	})
+	traceMu.Lock()
+	traceCached = nil
+	traceMu.Unlock()
+	downloadTemplatesMu.Lock()
+	clear(downloadTemplates)
+	downloadTemplatesMu.Unlock()
+	http.DefaultClient.CloseIdleConnections()
+	processSettings.transports.closeAll()
+	debug.FreeOSMemory()
+}
+
+// idleFor reports how long the queue has had no running or waiting job.
+func (q *runQueue) idleFor() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.active) > 0 || len(q.waiting) > 0 {
+		return 0
+	}
+	return time.Since(q.lastActive)
+}
+
+// watchIdle releases caches once the queue has been idle for timeout, then stops if exit.
+func watchIdle(ctx context.Context, q *runQueue, timeout time.Duration, exit bool, stop func(), logger *webLogger) {
+	ticker := time.NewTicker(min(timeout/4, 30*time.Second))
+	defer ticker.Stop()
+	released := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		idle := q.idleFor()
+		if idle < timeout {
+			released = false
+			continue
+		}
+		if !released {
+			releaseCaches()
+			released = true
+			logger.infof("💤 Idle for %s: caches released", idle.Round(time.Second))
+		}
+		if exit {
+			logger.infof("💤 Idle exit")
+			stop()
+			return
+		}
+	}
+}
+
+// webListener returns the systemd-activated socket, or listens on addr.
+func webListener(addr string) (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") == strconv.Itoa(os.Getpid()) {
+		if n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS")); n >= 1 {
+			return net.FileListener(os.NewFile(3, "systemd-socket"))
+		}
+	}
+	return net.Listen("tcp", addr)
+}
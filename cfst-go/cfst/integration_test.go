@@ -0,0 +1,308 @@
+package cfst
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// End-to-end tests of the pipeline against simServer.
+
+func simCandidates(n int) []NodeResult {
+	nodes := make([]NodeResult, n)
+	for i := range nodes {
+		nodes[i] = NodeResult{IP: fmt.Sprintf("104.16.0.%d", i+1), Port: 443, TCPLatency: float64(10 + i)}
+	}
+	return nodes
+}
+
+func TestDownloadAgainstSim(t *testing.T) {
+	sim := &simServer{Colo: "SJC", Rate: 4 << 20}
+	cfg := startSimServer(t, sim)
+	cfg.Duration = 2
+	cfg.DownloadNum = 2
+	cfg.DLInterval = 0
+	cfg.SkipLoadLatency = true
+
+	var stats DownloadStats
+	results := runParallelDownloadTest(context.Background(), simCandidates(2), cfg, &stats, nil, nil, nil, nil)
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	for _, r := range results {
+		if r.Colo != "SJC" {
+			t.Errorf("%s: colo %q, want SJC from the trace", r.IP, r.Colo)
+		}
+		// The server sends 4 MB/s; allow for ramp-up and scheduling.
+		if r.DownloadSpeed < 2 || r.DownloadSpeed > 6 {
+			t.Errorf("%s: speed %.2f MB/s, want about 4", r.IP, r.DownloadSpeed)
+		}
+		if r.Score <= 0 || r.TestedAt.IsZero() {
+			t.Errorf("%s: score %.1f, tested at %v: result not finalized", r.IP, r.Score, r.TestedAt)
+		}
+	}
+}
+
+func TestRateLimitedDownloadsAreSkipped(t *testing.T) {
+	sim := &simServer{Colo: "SJC", LimitFrom: 1}
+	cfg := startSimServer(t, sim)
+	cfg.Duration = 1
+	cfg.DownloadNum = 3
+	cfg.DLInterval = 0
+
+	var stats DownloadStats
+	results := runParallelDownloadTest(context.Background(), simCandidates(3), cfg, &stats, nil, nil, nil, nil)
+	if len(results) != 0 {
+		t.Errorf("got %d results, want none with -skip429", len(results))
+	}
+	if got := stats.Blocked.Load(); got != 3 {
+		t.Errorf("blocked = %d, want 3", got)
+	}
+	if sim.limited.Load() == 0 {
+		t.Error("server never answered 429")
+	}
+}
+
+// TestOwnZoneResultCache checks that a second -own-zone run reuses the cache.
+func TestOwnZoneResultCache(t *testing.T) {
+	sim := &simServer{Colo: "SJC", Rate: 8 << 20}
+	cfg := startSimServer(t, sim)
+	cfg.Duration = 1
+	cfg.DownloadNum = 2
+	cfg.DLInterval = 0
+	cfg.SkipLoadLatency = true
+	cfg.CacheTTL = time.Hour
+	cfg.CacheFile = filepath.Join(t.TempDir(), "cache.json")
+
+	for run := 1; run <= 2; run++ {
+		u, err := buildOwnZoneURL("zone.example")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.URL = u
+		var stats DownloadStats
+		results := runParallelDownloadTest(context.Background(), simCandidates(2), cfg, &stats, nil, nil, nil, nil)
+		if len(results) != 2 {
+			t.Fatalf("run %d: got %d results, want 2", run, len(results))
+		}
+		if run == 2 && stats.Tested.Load() != 0 {
+			t.Errorf("second run tested %d IPs, want every result from the cache", stats.Tested.Load())
+		}
+	}
+	if got := sim.downloads.Load(); got != 2 {
+		t.Errorf("server saw %d downloads, want 2 from the first run only", got)
+	}
+}
+
+func TestScanAgainstSim(t *testing.T) {
+	cfg := startSimServer(t, &simServer{Colo: "SJC"})
+	ips := GenerateIPs(20, false, "")
+	nodes, valid := ScanPingBounded(context.Background(), ips, cfg.Port, 20, 5, pingerFor(cfg), nil, nil)
+	if valid != len(ips) || len(nodes) != 5 {
+		t.Fatalf("valid %d of %d, kept %d; want all valid and 5 kept", valid, len(ips), len(nodes))
+	}
+	cfg.TLSPing = true
+	if _, valid = ScanPingBounded(context.Background(), ips, cfg.Port, 20, 5, pingerFor(cfg), nil, nil); valid != len(ips) {
+		t.Errorf("TLS ping: valid %d of %d", valid, len(ips))
+	}
+}
+
+// TestConcurrentScans checks that concurrent Scans each dial their own target.
+func TestConcurrentScans(t *testing.T) {
+	colos := []string{"SJC", "NRT"}
+	cfgs := make([]Config, len(colos))
+	for i, colo := range colos {
+		cfg := startSimServer(t, &simServer{Colo: colo, Rate: 8 << 20})
+		cfg.MaxScan = 10
+		cfg.ScanConcurrent = 10
+		cfg.TopN = 3
+		cfg.DownloadNum = 2
+		cfg.Duration = 1
+		cfg.QuickDuration = 1
+		cfg.DLInterval = 0
+		cfgs[i] = cfg
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(colos))
+	results := make([][]NodeResult, len(colos))
+	for i := range colos {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, errs[i] = Scan(context.Background(), WithConfig(cfgs[i]))
+		}(i)
+	}
+	wg.Wait()
+	for i, colo := range colos {
+		if errs[i] != nil {
+			t.Errorf("%s scan: %v", colo, errs[i])
+			continue
+		}
+		if len(results[i]) == 0 {
+			t.Errorf("%s scan: no results", colo)
+		}
+		for _, r := range results[i] {
+			if r.Colo != colo {
+				t.Errorf("%s scan: %s reports colo %q", colo, r.IP, r.Colo)
+			}
+		}
+	}
+}
+
+// TestRunnerStages checks the stages and callbacks of a Runner.
+func TestRunnerStages(t *testing.T) {
+	cfg := startSimServer(t, &simServer{Colo: "SJC", Rate: 8 << 20})
+	cfg.MaxScan = 10
+	cfg.ScanConcurrent = 10
+	cfg.TopN = 3
+	cfg.DownloadNum = 2
+	cfg.Duration = 1
+	cfg.QuickDuration = 1
+	cfg.DLInterval = 0
+	cfg.Longevity = time.Second
+	cfg.LongevityN = 1
+
+	r := NewRunner(cfg)
+	var mu sync.Mutex
+	var valid, longevity int
+	var phases []string
+	r.OnValid = func(NodeResult) { mu.Lock(); valid++; mu.Unlock() }
+	r.OnPhase = func(p PhaseTiming) { phases = append(phases, p.Name) }
+	r.OnLongevity = func(NodeResult) { mu.Lock(); longevity++; mu.Unlock() }
+	results, summary, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid != summary.Valid || valid == 0 {
+		t.Errorf("OnValid saw %d IPs, summary %d", valid, summary.Valid)
+	}
+	if want := []string{"generate", "ping", "prefilter", "download", "longevity"}; !slices.Equal(phases, want) {
+		t.Errorf("phases %v, want %v", phases, want)
+	}
+	if longevity != 1 || results[0].LongevityStatus == "" {
+		t.Errorf("%d longevity tests, top result %q", longevity, results[0].LongevityStatus)
+	}
+}
+
+func TestRunCLIAgainstSim(t *testing.T) {
+	cfg := startSimServer(t, &simServer{Colo: "SJC", Rate: 8 << 20})
+	cfg.MaxScan = 10
+	cfg.ScanConcurrent = 10
+	cfg.TopN = 3
+	cfg.DownloadNum = 2
+	cfg.Duration = 1
+	cfg.QuickDuration = 1
+	cfg.DLInterval = 0
+	cfg.Output = filepath.Join(t.TempDir(), "result.csv")
+
+	RunCLI(cfg)
+
+	b, err := os.ReadFile(cfg.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 1+cfg.DownloadNum {
+		t.Fatalf("CSV has %d lines, want a header and %d rows:\n%s", len(lines), cfg.DownloadNum, b)
+	}
+	if !strings.Contains(lines[1], "SJC") {
+		t.Errorf("first row lacks the simulated colo: %s", lines[1])
+	}
+}
+
+// TestRunWebAgainstSim runs the web server and lets -idle-exit stop it.
+func TestRunWebAgainstSim(t *testing.T) {
+	cfg := startSimServer(t, &simServer{Colo: "SJC", Rate: 8 << 20})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.WebPort = ln.Addr().String()
+	ln.Close()
+	cfg.IdleTimeout = time.Second
+	cfg.IdleExit = true
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		RunWeb(cfg)
+	}()
+
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		resp, err = http.Get("http://" + cfg.WebPort + "/api/test?format=ndjson&max=10&topn=3&dn=2&dt=1&qd=1&dli=0s")
+		if err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	complete := readJobEvents(t, resp)
+	if len(complete.Results) != 2 || complete.Summary.Tested < 2 {
+		t.Errorf("complete: %d results, %d tested; want 2 of at least 2", len(complete.Results), complete.Summary.Tested)
+	}
+
+	if len(complete.Results) > 0 {
+		ip := complete.Results[0].IP
+		resp, err := http.Get("http://" + cfg.WebPort + "/api/retest?format=ndjson&dt=1&ips=" + ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		retested := readJobEvents(t, resp)
+		if len(retested.Results) != 1 || retested.Results[0].IP != ip || retested.Results[0].DownloadSpeed <= 0 {
+			t.Errorf("retest of %s: %+v", ip, retested.Results)
+		}
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Error("web server did not exit when idle")
+	}
+}
+
+type jobComplete struct {
+	Results []NodeResult `json:"results"`
+	Summary RunSummary   `json:"summary"`
+}
+
+// readJobEvents reads an NDJSON job stream and returns its complete event.
+func readJobEvents(t *testing.T, resp *http.Response) jobComplete {
+	t.Helper()
+	var complete jobComplete
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		var evt struct {
+			Event string          `json:"event"`
+			Data  json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &evt); err != nil {
+			t.Fatalf("bad event %q: %v", sc.Text(), err)
+		}
+		switch evt.Event {
+		case "error":
+			t.Fatalf("error event: %s", evt.Data)
+		case "complete":
+			if err := json.Unmarshal(evt.Data, &complete); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return complete
+}
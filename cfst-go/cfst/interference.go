@@ -0,0 +1,90 @@
+package cfst
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Interference verdicts.
+const (
+	InterferenceNone    = "ok"
+	InterferenceTLS     = "tls-blocked"  // TCP fine, TLS handshake stalls or is reset
+	InterferenceHTTP    = "http-blocked" // TLS fine, no first byte
+	InterferenceTLSSlow = "tls-slow"     // TLS handshake far slower than the TCP RTT suggests
+)
+
+const interferenceAttempts = 3
+
+// interferenceSuspected reports whether a verdict points at the network path.
+func interferenceSuspected(verdict string) bool {
+	return verdict != "" && verdict != InterferenceNone
+}
+
+// InterferenceProbe compares connect, handshake and first-byte latency to spot interference.
+func InterferenceProbe(ctx context.Context, ip string, port int, sni string, timeout time.Duration) string {
+	if sni == "" {
+		sni = "speed.cloudflare.com"
+	}
+	addr := settingsOf(ctx).dialAddr(ip, port)
+	conf := &tls.Config{InsecureSkipVerify: true, ServerName: sni, NextProtos: []string{"http/1.1"}}
+
+	var tcpOK, tlsFail, httpFail, tlsSlow int
+	for i := 0; i < interferenceAttempts; i++ {
+		if ctx.Err() != nil {
+			return ""
+		}
+		start := time.Now()
+		raw, err := (&net.Dialer{Timeout: timeout}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			continue
+		}
+		tcpMs := time.Since(start).Seconds() * 1000
+		tcpOK++
+
+		raw.SetDeadline(time.Now().Add(timeout))
+		stop := closeOnCancel(ctx, raw)
+		conn := tls.Client(raw, conf)
+		start = time.Now()
+		if err := conn.Handshake(); err != nil {
+			stop()
+			raw.Close()
+			if ctx.Err() != nil {
+				return ""
+			}
+			tlsFail++
+			continue
+		}
+		tlsMs := time.Since(start).Seconds() * 1000
+		// A TLS 1.3 handshake is one round trip; allow generous slack.
+		if tlsMs > 300 && tlsMs > 5*tcpMs {
+			tlsSlow++
+		}
+
+		fmt.Fprintf(conn, "GET /cdn-cgi/trace HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", sni)
+		var b [1]byte
+		_, err = conn.Read(b[:])
+		stop()
+		conn.Close()
+		if ctx.Err() != nil {
+			return ""
+		}
+		if err != nil {
+			httpFail++
+		}
+	}
+
+	switch {
+	case tcpOK == 0:
+		return ""
+	case tlsFail*2 > tcpOK:
+		return InterferenceTLS
+	case httpFail*2 > tcpOK-tlsFail:
+		return InterferenceHTTP
+	case tlsSlow*2 > tcpOK-tlsFail:
+		return InterferenceTLSSlow
+	}
+	return InterferenceNone
+}
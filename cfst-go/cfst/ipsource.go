@@ -0,0 +1,249 @@
+package cfst
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// IPSource produces the candidate IPs for the ping phase; max is the -max budget.
+type IPSource interface {
+	IPs(ctx context.Context, max int) ([]string, error)
+}
+
+// IPSourceFunc adapts a plain function to IPSource.
+type IPSourceFunc func(ctx context.Context, max int) ([]string, error)
+
+func (f IPSourceFunc) IPs(ctx context.Context, max int) ([]string, error) { return f(ctx, max) }
+
+// RangeSource samples from CIDR ranges; nil Ranges means the embedded list.
+type RangeSource struct {
+	Ranges []string
+	Unique bool // at most one IP per /24
+}
+
+func (s RangeSource) IPs(ctx context.Context, max int) ([]string, error) {
+	ranges := s.Ranges
+	if ranges == nil {
+		ranges = CloudflareIPv4Ranges
+	}
+	return sampleIPs(ranges, max, s.Unique), nil
+}
+
+// FileSource samples from the IP/CIDR list in a local file.
+type FileSource struct {
+	Path   string
+	Unique bool
+}
+
+func (s FileSource) IPs(ctx context.Context, max int) ([]string, error) {
+	content, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	ranges := parseRangeLines(string(content))
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no ranges in %s", s.Path)
+	}
+	return sampleIPs(ranges, max, s.Unique), nil
+}
+
+// URLSource samples from an IP/CIDR list downloaded over HTTP(S).
+type URLSource struct {
+	URL    string
+	Unique bool
+}
+
+func (s URLSource) IPs(ctx context.Context, max int) ([]string, error) {
+	ranges, err := fetchRanges(ctx, s.URL)
+	if err != nil {
+		return nil, err
+	}
+	return sampleIPs(ranges, max, s.Unique), nil
+}
+
+func fetchRanges(ctx context.Context, url string) ([]string, error) {
+	if settingsOf(ctx).offline {
+		return nil, errOffline
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: HTTP %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, err
+	}
+	ranges := parseRangeLines(string(body))
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no ranges at %s", url)
+	}
+	return ranges, nil
+}
+
+// HistorySource returns the Top best-scoring IPs of a -history file.
+type HistorySource struct {
+	Path string
+	Top  int
+}
+
+func (s HistorySource) IPs(ctx context.Context, max int) ([]string, error) {
+	history, err := loadHistory(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	best := make(map[string]float64)
+	for _, rec := range history {
+		if rec.Speed > 0 && rec.Score > best[rec.IP] {
+			best[rec.IP] = rec.Score
+		}
+	}
+	ips := make([]string, 0, len(best))
+	for ip := range best {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool { return best[ips[i]] > best[ips[j]] })
+	if len(ips) > s.Top {
+		ips = ips[:s.Top]
+	}
+	return ips, nil
+}
+
+// EnumerateSource returns every host address of the ranges (nil = embedded), ignoring max.
+type EnumerateSource struct {
+	Ranges []string
+}
+
+func (s EnumerateSource) IPs(ctx context.Context, max int) ([]string, error) {
+	ranges := s.Ranges
+	if ranges == nil {
+		ranges = CloudflareIPv4Ranges
+	}
+	var ips []string
+	for _, r := range ranges {
+		if ip := net.ParseIP(r); ip != nil {
+			ips = append(ips, r)
+			continue
+		}
+		info := parseCIDRCached(r)
+		if info == nil {
+			continue
+		}
+		first, last := 1, info.maxHost+1 // skip network and broadcast addresses
+		if info.maxHost == 0 {
+			first, last = 0, 1<<info.hostBits
+		}
+		var buf [4]byte
+		for off := first; off < last; off++ {
+			binary.BigEndian.PutUint32(buf[:], info.baseIP+uint32(off))
+			ips = append(ips, net.IP(buf[:]).String())
+		}
+		if err := ctx.Err(); err != nil {
+			return ips, err
+		}
+	}
+	return ips, nil
+}
+
+// MultiSource concatenates its sources in order, dropping duplicates.
+type MultiSource []IPSource
+
+func (m MultiSource) IPs(ctx context.Context, max int) ([]string, error) {
+	seen := make(map[string]bool)
+	var ips []string
+	var errs []error
+	for _, src := range m {
+		got, err := src.IPs(ctx, max)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, ip := range got {
+			if !seen[ip] {
+				seen[ip] = true
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips, errors.Join(errs...)
+}
+
+// buildIPSource assembles the source selected by the command-line options.
+func buildIPSource(cfg Config) IPSource {
+	var base IPSource
+	switch {
+	case cfg.AllIP:
+		var ranges []string
+		if cfg.IPFile != "" {
+			if content, err := os.ReadFile(cfg.IPFile); err == nil {
+				ranges = parseRangeLines(string(content))
+			}
+		}
+		base = EnumerateSource{Ranges: ranges}
+	case cfg.Strategy == "coarse-fine":
+		cf := CoarseFineSource{Port: cfg.Port, Concurrency: cfg.ScanConcurrent, Unique: cfg.Unique}
+		base = IPSourceFunc(func(ctx context.Context, budget int) ([]string, error) {
+			switch {
+			case cfg.IPURL != "":
+				ranges, err := fetchRanges(ctx, cfg.IPURL)
+				if err != nil {
+					return nil, err
+				}
+				cf.Ranges = ranges
+			case cfg.IPFile != "":
+				content, err := os.ReadFile(cfg.IPFile)
+				if err != nil {
+					return nil, err
+				}
+				cf.Ranges = parseRangeLines(string(content))
+			}
+			return cf.IPs(ctx, budget)
+		})
+	case cfg.IPURL != "":
+		base = URLSource{URL: cfg.IPURL, Unique: cfg.Unique}
+	case cfg.IPFile != "":
+		base = FileSource{Path: cfg.IPFile, Unique: cfg.Unique}
+	default:
+		base = RangeSource{Unique: cfg.Unique}
+	}
+	if cfg.FeedURL != "" {
+		key, _ := parseFeedKey(cfg.FeedKey) // checked at startup
+		base = withFeed(FeedSource{URL: cfg.FeedURL, Key: key, Regions: cfg.FeedRegion, ISPs: cfg.FeedISP,
+			TTL: cfg.FeedTTL, Cache: cfg.FeedCache, Unique: cfg.Unique}, base)
+	}
+	if cfg.HistorySeed > 0 && cfg.HistoryFile != "" {
+		return MultiSource{HistorySource{Path: cfg.HistoryFile, Top: cfg.HistorySeed}, base}
+	}
+	return base
+}
+
+// generateCandidates produces the IPs to ping from cfg's source and the ip-source plugin.
+func generateCandidates(ctx context.Context, cfg Config) ([]string, error) {
+	src := cfg.Source
+	if src == nil {
+		src = buildIPSource(cfg)
+	}
+	ips, err := src.IPs(ctx, cfg.MaxScan)
+	if len(ips) == 0 && err != nil {
+		ips, _ = RangeSource{Unique: cfg.Unique}.IPs(ctx, cfg.MaxScan)
+	}
+	ips, perr := pluginSourceIPs(ctx, cfg, ips)
+	ips, derr := settingsOf(ctx).dialableIPs(appendPinned(ips, cfg.PinIPs))
+	return ips, errors.Join(err, perr, derr)
+}
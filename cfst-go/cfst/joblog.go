@@ -0,0 +1,151 @@
+package cfst
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Every web job keeps a log of the events it sent, served under /api/jobs.
+
+const (
+	jobLogKeep       = 50   // jobs kept
+	jobLogMaxEntries = 2000 // entries kept per job; later ones are counted as dropped
+)
+
+// jobIDs numbers the web jobs of this process.
+var jobIDs atomic.Int64
+
+// unloggedEvents are the per-tick events a job log leaves out.
+var unloggedEvents = map[string]bool{
+	"queued":         true,
+	"progress_scan":  true,
+	"progress_colo":  true,
+	"progress_live":  true,
+	"progress_bytes": true,
+	"leaderboard":    true,
+}
+
+// JobInfo describes one logged job.
+type JobInfo struct {
+	ID      int64      `json:"id"`
+	Path    string     `json:"path"`   // /api/test or /api/retest
+	Params  string     `json:"params"` // query string, token removed
+	Started time.Time  `json:"started"`
+	Ended   *time.Time `json:"ended,omitempty"`
+	Outcome string     `json:"outcome,omitempty"` // as in the audit log; empty while running
+	Entries int        `json:"entries"`
+	Dropped int        `json:"dropped,omitempty"`
+}
+
+// JobLogEntry is one event of a job.
+type JobLogEntry struct {
+	Time  time.Time       `json:"time"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type jobLog struct {
+	mu      sync.Mutex
+	logger  *webLogger
+	ns      string
+	info    JobInfo
+	entries []JobLogEntry
+}
+
+// add records one event. A nil *jobLog ignores it.
+func (j *jobLog) add(evtType string, data interface{}) {
+	if j == nil || unloggedEvents[evtType] {
+		return
+	}
+	if evtType == "complete" {
+		data = "job complete" // results and summary went to the client; keep the log small
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.entries) >= jobLogMaxEntries {
+		j.info.Dropped++
+		return
+	}
+	j.entries = append(j.entries, JobLogEntry{Time: time.Now(), Event: evtType, Data: b})
+}
+
+// end records how the job ended.
+func (j *jobLog) end(outcome string) {
+	if j == nil {
+		return
+	}
+	now := time.Now()
+	j.mu.Lock()
+	j.info.Ended, j.info.Outcome = &now, outcome
+	j.mu.Unlock()
+	j.logger.infof("job %d ended after %.1fs: %s", j.info.ID, now.Sub(j.info.Started).Seconds(), outcome)
+}
+
+func (j *jobLog) snapshot() JobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := j.info
+	info.Entries = len(j.entries)
+	return info
+}
+
+// jobParams is r's query string without the token.
+func jobParams(r *http.Request) string {
+	q := r.URL.Query()
+	q.Del("token")
+	return q.Encode()
+}
+
+// jobLogStore holds the logs of the last jobLogKeep jobs.
+type jobLogStore struct {
+	logger *webLogger // also gets a line when a job starts and ends
+	mu     sync.Mutex
+	jobs   []*jobLog // oldest first
+}
+
+// start opens the log of a new job in namespace ns.
+func (s *jobLogStore) start(path, params, ns string) *jobLog {
+	j := &jobLog{logger: s.logger, ns: ns, info: JobInfo{ID: jobIDs.Add(1), Path: path, Params: params, Started: time.Now()}}
+	s.logger.infof("job %d started: %s?%s", j.info.ID, path, params)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, j)
+	if len(s.jobs) > jobLogKeep {
+		s.jobs = s.jobs[len(s.jobs)-jobLogKeep:]
+	}
+	return j
+}
+
+// list returns the kept jobs of namespace ns, newest first.
+func (s *jobLogStore) list(ns string) []JobInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := []JobInfo{}
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		if s.jobs[i].ns == ns {
+			infos = append(infos, s.jobs[i].snapshot())
+		}
+	}
+	return infos
+}
+
+// log returns the entries of job id in namespace ns, false if it isn't kept.
+func (s *jobLogStore) log(id int64, ns string) ([]JobLogEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.info.ID == id && j.ns == ns {
+			j.mu.Lock()
+			defer j.mu.Unlock()
+			return append([]JobLogEntry(nil), j.entries...), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,159 @@
+package cfst
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// queueUpdateInterval is how often a waiting job is told its position and ETA.
+const queueUpdateInterval = 3 * time.Second
+
+// QueueStatus is the payload of the "queued" event.
+type QueueStatus struct {
+	Position int     `json:"position"`              // 1 = next to run
+	ETA      float64 `json:"eta_seconds,omitempty"` // 0 while no estimate is available
+	Progress float64 `json:"progress"`              // 0..1 of the job that will free a slot first
+}
+
+// runQueue runs at most slots web jobs at once, in arrival order.
+type runQueue struct {
+	mu      sync.Mutex
+	slots   int
+	active  []*queuedJob
+	waiting []*queuedJob
+	changed chan struct{} // closed and replaced on every change
+	doneSum time.Duration // total duration of finished jobs, for ETAs
+	doneN   int
+
+	lastActive time.Time // when the last job finished (or the queue was created)
+}
+
+type queuedJob struct {
+	q        *runQueue
+	started  time.Time
+	progress float64
+}
+
+func newRunQueue(slots int) *runQueue {
+	return &runQueue{slots: max(slots, 1), changed: make(chan struct{}), lastActive: time.Now()}
+}
+
+func (q *runQueue) notifyLocked() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// wait blocks until the job may run, calling report while it is queued.
+func (q *runQueue) wait(ctx context.Context, report func(QueueStatus)) (*queuedJob, error) {
+	j := &queuedJob{q: q}
+	q.mu.Lock()
+	q.waiting = append(q.waiting, j)
+	q.mu.Unlock()
+
+	ticker := time.NewTicker(queueUpdateInterval)
+	defer ticker.Stop()
+	for {
+		q.mu.Lock()
+		pos := q.indexLocked(j)
+		if pos < q.slots-len(q.active) {
+			q.waiting = append(q.waiting[:pos], q.waiting[pos+1:]...)
+			j.started = time.Now()
+			q.active = append(q.active, j)
+			q.notifyLocked()
+			q.mu.Unlock()
+			return j, nil
+		}
+		status := q.statusLocked(pos)
+		changed := q.changed
+		q.mu.Unlock()
+		report(status)
+
+		select {
+		case <-changed:
+		case <-ticker.C:
+		case <-ctx.Done():
+			q.mu.Lock()
+			pos := q.indexLocked(j)
+			q.waiting = append(q.waiting[:pos], q.waiting[pos+1:]...)
+			q.notifyLocked()
+			q.mu.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (q *runQueue) indexLocked(j *queuedJob) int {
+	for i, w := range q.waiting {
+		if w == j {
+			return i
+		}
+	}
+	return -1
+}
+
+// statusLocked estimates when the waiter at index pos gets a slot.
+func (q *runQueue) statusLocked(pos int) QueueStatus {
+	st := QueueStatus{Position: pos + 1}
+	var avg time.Duration
+	if q.doneN > 0 {
+		avg = q.doneSum / time.Duration(q.doneN)
+	}
+	if len(q.active) > 0 {
+		st.Progress = q.active[0].progress
+	}
+	var frees []time.Duration
+	for _, a := range q.active {
+		elapsed := time.Since(a.started)
+		switch {
+		case a.progress >= 0.05:
+			frees = append(frees, time.Duration(float64(elapsed)/a.progress)-elapsed)
+		case avg > 0:
+			frees = append(frees, max(avg-elapsed, 0))
+		default:
+			return st // too early to tell
+		}
+	}
+	if len(frees) == 0 {
+		return st
+	}
+	for i := 0; ; i++ {
+		sort.Slice(frees, func(a, b int) bool { return frees[a] < frees[b] })
+		if i == pos {
+			st.ETA = frees[0].Seconds()
+			return st
+		}
+		if avg == 0 {
+			return st // jobs ahead of us haven't started; no duration to assume yet
+		}
+		frees[0] += avg
+	}
+}
+
+// report records progress from..to scaled by done/total of the current phase.
+func (j *queuedJob) report(from, to float64, done, total int) {
+	if total <= 0 {
+		return
+	}
+	j.q.mu.Lock()
+	j.progress = from + (to-from)*min(float64(done)/float64(total), 1)
+	j.q.mu.Unlock()
+}
+
+// done releases the job's slot.
+func (j *queuedJob) done() {
+	q := j.q
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, a := range q.active {
+		if a == j {
+			q.active = append(q.active[:i], q.active[i+1:]...)
+			break
+		}
+	}
+	q.doneSum += time.Since(j.started)
+	q.doneN++
+	q.lastActive = time.Now()
+	q.notifyLocked()
+}
@@ -0,0 +1,30 @@
+package cfst
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// -jsonl streams each completed test to stdout as one JSON line; other output goes to stderr.
+
+var jsonlStream = struct {
+	sync.Mutex
+	w io.Writer // nil = off
+}{}
+
+// startJSONL claims stdout for the JSON lines and points os.Stdout at stderr.
+func startJSONL() {
+	jsonlStream.w = os.Stdout
+	os.Stdout = os.Stderr
+}
+
+// emitJSONL writes r as one line when -jsonl is on.
+func emitJSONL(r NodeResult) {
+	jsonlStream.Lock()
+	defer jsonlStream.Unlock()
+	if jsonlStream.w != nil {
+		json.NewEncoder(jsonlStream.w).Encode(r)
+	}
+}
@@ -0,0 +1,125 @@
+package cfst
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The result file is CSV unless -format or the -o extension asks for JSON or Clash.
+
+// version is the release reported by the web API docs and JSON results.
+var version = "1.8.5"
+
+// Result file formats.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// ResultDoc is the JSON result file.
+type ResultDoc struct {
+	Version   string       `json:"version"`
+	Timestamp time.Time    `json:"timestamp"`
+	Config    RunConfig    `json:"config"`
+	Summary   *RunSummary  `json:"summary,omitempty"`
+	Results   []NodeResult `json:"results"`
+}
+
+// RunConfig is the part of Config that shaped the measurements.
+type RunConfig struct {
+	Port        int      `json:"port"`
+	MaxScan     int      `json:"max"`
+	TopN        int      `json:"topn"`
+	DownloadNum int      `json:"dn"`
+	Duration    int      `json:"dt"`
+	URL         string   `json:"url"`
+	SNI         string   `json:"sni,omitempty"`
+	FilterMode  string   `json:"filter"`
+	Strategy    string   `json:"strategy"`
+	Streams     int      `json:"streams"`
+	HTTP2       bool     `json:"http2,omitempty"`
+	Pings       int      `json:"n"`
+	MaxLatency  float64  `json:"tl,omitempty"`
+	MinSpeed    float64  `json:"sl,omitempty"`
+	CFColo      string   `json:"cfcolo,omitempty"`
+	Verify      int      `json:"verify,omitempty"`
+	Expand      int      `json:"expand,omitempty"`
+	Preset      string   `json:"preset,omitempty"`
+	LatencyOnly bool     `json:"latency_only,omitempty"`
+	PinIPs      []string `json:"pin,omitempty"`
+}
+
+func runConfig(cfg Config) RunConfig {
+	return RunConfig{
+		Port: cfg.Port, MaxScan: cfg.MaxScan, TopN: cfg.TopN, DownloadNum: cfg.DownloadNum, Duration: cfg.Duration,
+		URL: cfg.URL, SNI: cfg.SNI, FilterMode: cfg.FilterMode, Strategy: cfg.Strategy, Streams: cfg.Streams,
+		HTTP2: cfg.HTTP2, Pings: cfg.Pings, MaxLatency: cfg.MaxLatency, MinSpeed: cfg.MinSpeed, CFColo: cfg.CFColo,
+		Verify: cfg.Verify, Expand: cfg.Expand, Preset: cfg.Preset, LatencyOnly: cfg.LatencyOnly, PinIPs: cfg.PinIPs,
+	}
+}
+
+// resultFormat is the format the result file is written in.
+func resultFormat(cfg Config) string {
+	if cfg.Format != "" {
+		return cfg.Format
+	}
+	switch ext := strings.ToLower(filepath.Ext(cfg.Output)); {
+	case ext == ".json":
+		return FormatJSON
+	case (ext == ".yaml" || ext == ".yml") && cfg.ClashTemplate != "":
+		return FormatClash
+	}
+	return FormatCSV
+}
+
+func validResultFormat(format string) error {
+	switch format {
+	case "", FormatCSV, FormatJSON, FormatClash:
+		return nil
+	}
+	return fmt.Errorf("unknown -format %q (have csv, json, clash)", format)
+}
+
+// saveResults writes the result file in the configured format.
+func saveResults(cfg Config, results []NodeResult, summary *RunSummary) {
+	switch resultFormat(cfg) {
+	case FormatJSON:
+		saveJSON(cfg, results, summary)
+	case FormatClash:
+		saveClash(cfg, results)
+	default:
+		saveCSV(cfg.Output, results, cfg)
+	}
+	// A partial save leaves a "<output>.partial" marker; a complete one removes it.
+	marker := cfg.Output + ".partial"
+	if summary != nil && summary.Partial {
+		os.WriteFile(marker, []byte("partial run saved at "+time.Now().Format(time.RFC3339)+"\n"), 0644)
+		fmt.Printf("\n💾 Saved partial results to: %s (marked by %s)\n", cfg.Output, marker)
+		return
+	}
+	os.Remove(marker)
+	fmt.Printf("\n💾 Saved to: %s\n", cfg.Output)
+}
+
+func saveJSON(cfg Config, results []NodeResult, summary *RunSummary) {
+	if results == nil {
+		results = []NodeResult{}
+	}
+	b, err := json.MarshalIndent(ResultDoc{
+		Version:   version,
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+		Config:    runConfig(cfg),
+		Summary:   summary,
+		Results:   results,
+	}, "", "  ")
+	if err == nil {
+		err = os.WriteFile(cfg.Output, append(b, '\n'), 0644)
+	}
+	if err != nil {
+		fmt.Println("Error saving JSON:", err)
+	}
+}
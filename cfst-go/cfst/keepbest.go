@@ -0,0 +1,78 @@
+package cfst
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// Enter (or SIGUSR1) ends the CLI download test early and keeps the results so far.
+
+// stdinLines carries the lines typed on a terminal stdin to whoever listens.
+var (
+	stdinOnce  sync.Once
+	stdinLines chan struct{}
+)
+
+func watchStdin() <-chan struct{} {
+	stdinOnce.Do(func() {
+		if !isTerminal(os.Stdin) {
+			return
+		}
+		stdinLines = make(chan struct{})
+		go func() {
+			sc := bufio.NewScanner(os.Stdin)
+			for sc.Scan() {
+				select {
+				case stdinLines <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	})
+	return stdinLines
+}
+
+// downloadStopper returns a download context that also ends on request, and its stop func.
+func downloadStopper(ctx context.Context) (context.Context, func() bool) {
+	dlCtx, cancel := context.WithCancel(ctx)
+	lines := watchStdin()
+	sigs := make(chan os.Signal, 1)
+	if len(keepBestSignals) > 0 {
+		signal.Notify(sigs, keepBestSignals...)
+	}
+	switch {
+	case lines != nil && len(keepBestSignals) > 0:
+		fmt.Println("   Press Enter (or send SIGUSR1) to stop testing and keep the results so far")
+	case lines != nil:
+		fmt.Println("   Press Enter to stop testing and keep the results so far")
+	}
+
+	var stopped bool
+	done, finished := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(finished)
+		select {
+		case <-lines:
+		case <-sigs:
+		case <-done:
+			return
+		case <-dlCtx.Done():
+			return
+		}
+		if stopped = ctx.Err() == nil; stopped {
+			fmt.Println("\n⏭ Stopping the download test: keeping the results so far...")
+		}
+		cancel()
+	}()
+	return dlCtx, func() bool {
+		signal.Stop(sigs)
+		close(done)
+		<-finished
+		cancel()
+		return stopped
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package cfst
+
+import "os"
+
+// keepBestSignals is empty where there is no SIGUSR1; Enter still works.
+var keepBestSignals []os.Signal
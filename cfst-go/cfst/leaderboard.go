@@ -0,0 +1,68 @@
+package cfst
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// leaderboard keeps the usable download results so far in score order.
+
+// leaderboard holds the best size results seen, best first.
+type leaderboard struct {
+	mu   sync.Mutex
+	size int
+	top  []NodeResult
+}
+
+func newLeaderboard(size int) *leaderboard {
+	return &leaderboard{size: max(size, 1)}
+}
+
+// add ranks r and returns a copy of the top, and whether r made it in.
+func (l *leaderboard) add(r NodeResult) ([]NodeResult, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r.DownloadSpeed <= 0 {
+		return nil, false
+	}
+	i := sort.Search(len(l.top), func(i int) bool { return l.top[i].Score < r.Score })
+	if i >= l.size {
+		return nil, false
+	}
+	l.top = append(l.top, NodeResult{})
+	copy(l.top[i+1:], l.top[i:])
+	l.top[i] = r
+	l.top = l.top[:min(len(l.top), l.size)]
+	return append([]NodeResult(nil), l.top...), true
+}
+
+// liveTable redraws the CLI leaderboard in place for -live-top.
+type liveTable struct {
+	cols  []tableColumn
+	drawn int // rows of the last draw still right above the cursor
+}
+
+func (t *liveTable) draw(top []NodeResult) {
+	fmt.Print("\r")
+	if t.drawn > 0 {
+		fmt.Printf("\033[%dA", t.drawn)
+	}
+	fmt.Print("\033[J")
+	for _, r := range top {
+		printTableRow(t.cols, r)
+	}
+	t.drawn = len(top)
+}
+
+// detach starts the next draw below whatever was printed since the last.
+func (t *liveTable) detach() {
+	t.drawn = 0
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
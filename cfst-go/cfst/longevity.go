@@ -0,0 +1,112 @@
+package cfst
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// longevityStallTimeout is how long a connection may deliver no bytes before it stalls.
+const longevityStallTimeout = 15 * time.Second
+
+// LongevityTest keeps a slow download open through ip for dur and reports how it ended.
+func LongevityTest(ctx context.Context, ip string, port int, testURL string, customSNI string, dur time.Duration) (status string, survived float64) {
+	testCtx, cancel := context.WithTimeout(ctx, dur)
+	defer cancel()
+
+	start := time.Now()
+	var lastProgress atomic.Int64
+	lastProgress.Store(start.UnixNano())
+	var stalled atomic.Bool
+
+	watchCtx, stopWatch := context.WithCancel(testCtx)
+	defer stopWatch()
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if time.Since(time.Unix(0, lastProgress.Load())) > longevityStallTimeout {
+					stalled.Store(true)
+					cancel()
+					return
+				}
+			case <-watchCtx.Done():
+				return
+			}
+		}
+	}()
+
+	// Small reads keep the transfer slow; the buffer itself comes from the pool.
+	bufPtr := downloadBufPool.Get().(*[]byte)
+	defer downloadBufPool.Put(bufPtr)
+	buf := (*bufPtr)[:min(8*1024, len(*bufPtr))]
+	pace := time.NewTicker(250 * time.Millisecond)
+	defer pace.Stop()
+
+	// Small test files end early; re-request until the duration is up.
+	for testCtx.Err() == nil {
+		client, req, err := newDownloadRequest(testCtx, ip, port, testURL, customSNI)
+		if err != nil {
+			return "reset", 0
+		}
+		resp, err := client.Do(req)
+		if err != nil || resp.StatusCode >= 400 {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			break
+		}
+		for {
+			n, err := resp.Body.Read(buf)
+			if n > 0 {
+				lastProgress.Store(time.Now().UnixNano())
+			}
+			if err != nil {
+				break
+			}
+			select {
+			case <-pace.C:
+			case <-testCtx.Done():
+			}
+		}
+		resp.Body.Close()
+	}
+
+	survived = time.Since(start).Seconds()
+	switch {
+	case stalled.Load():
+		return "stall", time.Unix(0, lastProgress.Load()).Sub(start).Seconds()
+	case ctx.Err() == nil && survived < dur.Seconds()-1:
+		return "reset", survived
+	default:
+		return "ok", survived
+	}
+}
+
+// runLongevityTests runs LongevityTest on the first n results concurrently.
+func runLongevityTests(ctx context.Context, results []NodeResult, cfg Config, n int,
+	progressRow func(res NodeResult)) {
+
+	if n > len(results) {
+		n = len(results)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		if results[i].DownloadSpeed <= 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			r := &results[idx]
+			r.LongevityStatus, r.LongevitySec = LongevityTest(ctx, r.IP, cfg.Port, cfg.URL, cfg.SNI, cfg.Longevity)
+			if progressRow != nil {
+				progressRow(*r)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,53 @@
+package cfst
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+)
+
+// -low-mem trims sockets, buffers, state files and the heap target for small routers.
+
+const (
+	lowMemHeapLimit = 48 << 20
+	lowMemReadBuf   = 32 << 10
+)
+
+// lowMemProfile lists, per flag, how the profile clamps the setting.
+var lowMemProfile = []struct {
+	flag  string
+	apply func(*Config)
+}{
+	{"sc", func(c *Config) { c.ScanConcurrent = min(c.ScanConcurrent, 32) }},
+	{"max", func(c *Config) { c.MaxScan = min(c.MaxScan, 1000) }},
+	{"topn", func(c *Config) { c.TopN = min(c.TopN, 30) }},
+	{"dn", func(c *Config) { c.DownloadNum = min(c.DownloadNum, 10) }},
+	{"dlc", func(c *Config) { c.DLConc = 1 }},
+	{"streams", func(c *Config) { c.Streams = 1 }},
+	{"h2", func(c *Config) { c.HTTP2 = false }},
+	{"idle-conns", func(c *Config) { c.MaxIdlePerHost = 1 }},
+	{"tls-session-cache", func(c *Config) { c.TLSSessions = min(c.TLSSessions, 32) }},
+	{"web-jobs", func(c *Config) { c.WebJobs = 1 }},
+	{"history", func(c *Config) { c.HistoryFile = "" }},
+	{"cache-ttl", func(c *Config) { c.CacheTTL = 0 }},
+}
+
+// lowMemConfig applies the profile's settings to cfg, leaving the flags in set alone.
+func lowMemConfig(cfg *Config, set map[string]bool) {
+	for _, p := range lowMemProfile {
+		if !set[p.flag] {
+			p.apply(cfg)
+		}
+	}
+}
+
+// applyLowMem applies the profile to cfg and shrinks the process-wide buffers and heap target.
+func applyLowMem(cfg *Config, set map[string]bool) {
+	lowMemConfig(cfg, set)
+	downloadBufSize = lowMemReadBuf
+	if os.Getenv("GOMEMLIMIT") == "" {
+		debug.SetMemoryLimit(lowMemHeapLimit)
+	}
+	fmt.Printf("🪶 Low-memory profile: scan concurrency %d, max %d IPs, top %d, %d KB read buffers\n",
+		cfg.ScanConcurrent, cfg.MaxScan, cfg.TopN, downloadBufSize>>10)
+}
@@ -0,0 +1,178 @@
+package cfst
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// /metrics serves the last run in the Prometheus text format.
+
+// runMetrics is the snapshot /metrics serves.
+type runMetrics struct {
+	mu      sync.Mutex
+	runs    int
+	at      time.Time
+	best    *NodeResult
+	summary RunSummary
+	colos   []coloMetrics
+}
+
+// coloMetrics are the usable results of one colo.
+type coloMetrics struct {
+	colo      string
+	results   int
+	bestSpeed float64
+	minLat    float64
+}
+
+// nsMetrics holds the metrics of each web namespace ("" outside -web-tokens).
+var (
+	nsMetricsMu sync.Mutex
+	nsMetrics   = map[string]*runMetrics{}
+)
+
+// metricsFor returns the metrics of namespace ns.
+func metricsFor(ns string) *runMetrics {
+	nsMetricsMu.Lock()
+	defer nsMetricsMu.Unlock()
+	m := nsMetrics[ns]
+	if m == nil {
+		m = &runMetrics{}
+		nsMetrics[ns] = m
+	}
+	return m
+}
+
+// record makes a finished run the one /metrics serves.
+func (m *runMetrics) record(results []NodeResult, summary RunSummary, at time.Time) {
+	byColo := make(map[string]*coloMetrics)
+	var colos []coloMetrics
+	for _, r := range results {
+		if r.DownloadSpeed <= 0 || !knownColo(r.Colo) {
+			continue
+		}
+		c := byColo[r.Colo]
+		if c == nil {
+			c = &coloMetrics{colo: r.Colo, minLat: r.TCPLatency}
+			byColo[r.Colo] = c
+		}
+		c.results++
+		c.bestSpeed = max(c.bestSpeed, r.DownloadSpeed)
+		c.minLat = min(c.minLat, r.TCPLatency)
+	}
+	for _, c := range byColo {
+		colos = append(colos, *c)
+	}
+	sort.Slice(colos, func(i, j int) bool { return colos[i].colo < colos[j].colo })
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs++
+	m.at = at
+	m.best = bestResult(results)
+	m.summary = summary
+	m.colos = colos
+}
+
+// metricLabel escapes a label value.
+var metricLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// write renders the snapshot in the Prometheus text format.
+func (m *runMetrics) write(w http.ResponseWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	metric("cfst_runs_total", "counter", "Runs finished since the process started.")
+	fmt.Fprintf(w, "cfst_runs_total %d\n", m.runs)
+	if m.runs == 0 {
+		return
+	}
+	s := m.summary
+	metric("cfst_last_run_timestamp_seconds", "gauge", "When the last run finished, as a Unix time.")
+	fmt.Fprintf(w, "cfst_last_run_timestamp_seconds %d\n", m.at.Unix())
+	metric("cfst_last_run_duration_seconds", "gauge", "How long the last run took.")
+	fmt.Fprintf(w, "cfst_last_run_duration_seconds %g\n", s.Elapsed)
+	metric("cfst_scanned_ips", "gauge", "IPs ping-scanned in the last run.")
+	fmt.Fprintf(w, "cfst_scanned_ips %d\n", s.Scanned)
+	metric("cfst_valid_ips", "gauge", "IPs that answered the ping scan in the last run.")
+	fmt.Fprintf(w, "cfst_valid_ips %d\n", s.Valid)
+	metric("cfst_tested_ips", "gauge", "IPs download-tested in the last run.")
+	fmt.Fprintf(w, "cfst_tested_ips %d\n", s.Tested)
+	metric("cfst_blocked_ips", "gauge", "Download-tested IPs that failed or were rate-limited in the last run.")
+	fmt.Fprintf(w, "cfst_blocked_ips %d\n", s.Blocked)
+	metric("cfst_phase_duration_seconds", "gauge", "Time the last run spent in each phase.")
+	for _, p := range s.Phases {
+		fmt.Fprintf(w, "cfst_phase_duration_seconds{phase=\"%s\"} %g\n", metricLabel.Replace(p.Name), p.Seconds)
+	}
+	if b := m.best; b != nil {
+		metric("cfst_best_latency_ms", "gauge", "TCP latency of the last run's best result.")
+		fmt.Fprintf(w, "cfst_best_latency_ms %g\n", b.TCPLatency)
+		metric("cfst_best_speed_mbytes_per_second", "gauge", "Download speed of the last run's best result, MB/s.")
+		fmt.Fprintf(w, "cfst_best_speed_mbytes_per_second %g\n", b.DownloadSpeed)
+		metric("cfst_best_info", "gauge", "The last run's best result; always 1.")
+		fmt.Fprintf(w, "cfst_best_info{ip=\"%s\",addr=\"%s\",colo=\"%s\"} 1\n",
+			metricLabel.Replace(b.IP), metricLabel.Replace(usableAt(*b)), metricLabel.Replace(b.Colo))
+	}
+	metric("cfst_colo_candidates", "gauge", "Candidates detected in each colo in the last run.")
+	for _, c := range s.Colos {
+		fmt.Fprintf(w, "cfst_colo_candidates{colo=\"%s\"} %d\n", metricLabel.Replace(c.Colo), c.Count)
+	}
+	metric("cfst_colo_median_latency_ms", "gauge", "Median TCP latency of each colo's candidates in the last run.")
+	for _, c := range s.Colos {
+		fmt.Fprintf(w, "cfst_colo_median_latency_ms{colo=\"%s\"} %g\n", metricLabel.Replace(c.Colo), c.MedianLatency)
+	}
+	metric("cfst_colo_results", "gauge", "Usable results in each colo in the last run.")
+	for _, c := range m.colos {
+		fmt.Fprintf(w, "cfst_colo_results{colo=\"%s\"} %d\n", metricLabel.Replace(c.colo), c.results)
+	}
+	metric("cfst_colo_best_speed_mbytes_per_second", "gauge", "Fastest usable result in each colo in the last run, MB/s.")
+	for _, c := range m.colos {
+		fmt.Fprintf(w, "cfst_colo_best_speed_mbytes_per_second{colo=\"%s\"} %g\n", metricLabel.Replace(c.colo), c.bestSpeed)
+	}
+	metric("cfst_colo_best_latency_ms", "gauge", "Lowest TCP latency of a usable result in each colo in the last run.")
+	for _, c := range m.colos {
+		fmt.Fprintf(w, "cfst_colo_best_latency_ms{colo=\"%s\"} %g\n", metricLabel.Replace(c.colo), c.minLat)
+	}
+}
+
+// serve is the /metrics handler for m.
+func (m *runMetrics) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+// serveDaemonMetrics serves /metrics on addr for -daemon until the process exits.
+func serveDaemonMetrics(addr string) error {
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsFor("").serve)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	host := addr
+	if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+	fmt.Printf("📈 Metrics at http://%s/metrics\n", host)
+	go func() {
+		if err := http.Serve(ln, mux); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("[!] Metrics server:", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,92 @@
+package cfst
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// With -web-tokens each API token gets its own history and result cache directory.
+
+var namespaceRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// loadWebTokens reads "token namespace" lines; '#' starts a comment.
+func loadWebTokens(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make(map[string]string)
+	for i, line := range strings.Split(string(content), "\n") {
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || !namespaceRe.MatchString(fields[1]) {
+			return nil, fmt.Errorf("%s:%d: expected '<token> <namespace>'", path, i+1)
+		}
+		tokens[fields[0]] = fields[1]
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no tokens in %s", path)
+	}
+	return tokens, nil
+}
+
+// requestToken returns the bearer token, or the token query parameter.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+// namespacedPath moves path into the ns subdirectory next to it.
+func namespacedPath(path, ns string) string {
+	if path == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(path), ns, filepath.Base(path))
+}
+
+// namespaceConfig returns cfg with its per-user files moved into ns.
+func namespaceConfig(cfg Config, ns string) (Config, error) {
+	cfg.Namespace = ns
+	cfg.HistoryFile = namespacedPath(cfg.HistoryFile, ns)
+	cfg.CacheFile = namespacedPath(cfg.CacheFile, ns)
+	for _, p := range []string{cfg.HistoryFile, cfg.CacheFile} {
+		if p != "" {
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				return cfg, err
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// withNamespace hands h a Config scoped to the caller's namespace.
+func withNamespace(cfg Config, tokens map[string]string, h func(w http.ResponseWriter, r *http.Request, cfg Config)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if tokens == nil {
+			h(w, r, cfg)
+			return
+		}
+		ns, ok := tokens[requestToken(r)]
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		nsCfg, err := namespaceConfig(cfg, ns)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h(w, r, nsCfg)
+	}
+}
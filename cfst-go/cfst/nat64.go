@@ -0,0 +1,115 @@
+package cfst
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Without an IPv4 route, IPv4 addresses are left out or dialed through -nat64.
+
+// nat64WellKnown is the IPv4 address ipv4only.arpa resolves to.
+var nat64WellKnown = net.IPv4(192, 0, 0, 170).To4()
+
+const nat64LookupTimeout = 5 * time.Second
+
+// configureNAT64 installs the -nat64 prefix.
+func (rs *runSettings) configureNAT64(cfg Config) error {
+	rs.nat64 = nil
+	switch cfg.NAT64 {
+	case "":
+		return nil
+	case "auto":
+		prefix, err := discoverNAT64(rs.offline)
+		if err != nil {
+			return fmt.Errorf("-nat64 auto: %v", err)
+		}
+		rs.nat64 = prefix
+		return nil
+	}
+	ip, n, err := net.ParseCIDR(cfg.NAT64)
+	if err != nil || ip.To4() != nil {
+		return fmt.Errorf("-nat64 %q: want auto or an IPv6 prefix such as 64:ff9b::/96", cfg.NAT64)
+	}
+	if ones, _ := n.Mask.Size(); ones != 96 {
+		return fmt.Errorf("-nat64 %q: only /96 prefixes are supported", cfg.NAT64)
+	}
+	rs.nat64 = n.IP
+	return nil
+}
+
+// discoverNAT64 finds the network's NAT64 prefix from ipv4only.arpa (RFC 7050).
+func discoverNAT64(offline bool) (net.IP, error) {
+	if offline {
+		return nil, errOffline
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), nat64LookupTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIP(ctx, "ip6", "ipv4only.arpa")
+	if err != nil {
+		return nil, fmt.Errorf("no NAT64 found: ipv4only.arpa: %v", err)
+	}
+	for _, a := range addrs {
+		if a.To4() == nil && a[12:].Equal(nat64WellKnown) {
+			return append(net.IP(nil), a[:12]...).To16(), nil
+		}
+	}
+	return nil, fmt.Errorf("no NAT64 found: ipv4only.arpa has no synthesized AAAA record")
+}
+
+// nat64Addr returns the address ip is dialed at under -nat64.
+func (rs *runSettings) nat64Addr(ip string) string {
+	if rs.nat64 == nil {
+		return ip
+	}
+	v4 := net.ParseIP(ip).To4()
+	if v4 == nil {
+		return ip
+	}
+	a := make(net.IP, net.IPv6len)
+	copy(a, rs.nat64)
+	copy(a[12:], v4)
+	return a.String()
+}
+
+// Route probes: connecting a UDP socket sends nothing but fails without a route.
+var (
+	routeOnce    sync.Once
+	hasIPv4Route bool
+)
+
+// ipv4Routable reports whether this host has a route to the IPv4 internet.
+func ipv4Routable() bool {
+	routeOnce.Do(func() {
+		conn, err := net.Dial("udp4", "1.1.1.1:53")
+		if err == nil {
+			conn.Close()
+		}
+		hasIPv4Route = err == nil
+	})
+	return hasIPv4Route
+}
+
+// dialableIPs leaves out the IPv4 addresses when they can't be reached.
+func (rs *runSettings) dialableIPs(ips []string) ([]string, error) {
+	if rs.nat64 != nil || rs.target != "" || ipv4Routable() {
+		return ips, nil
+	}
+	kept := ips[:0:0]
+	for _, ip := range ips {
+		if parsed := net.ParseIP(ip); parsed == nil || parsed.To4() == nil {
+			kept = append(kept, ip)
+		}
+	}
+	skipped := len(ips) - len(kept)
+	if skipped == 0 {
+		return ips, nil
+	}
+	hint := "use -nat64 auto if the network has NAT64, or test IPv6 ranges (-f)"
+	if len(kept) == 0 {
+		return kept, fmt.Errorf("IPv4 testing is impossible: this host has no IPv4 route, so none of the %d IPv4 address(es) can be reached; %s", skipped, hint)
+	}
+	return kept, fmt.Errorf("this host has no IPv4 route: skipped %d IPv4 address(es); %s", skipped, hint)
+}
@@ -0,0 +1,91 @@
+package cfst
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// -never-select IPs and subnets are measured but withheld from the final results.
+
+// ipMatcher matches IPs against a list of subnets; nil matches nothing.
+type ipMatcher []*net.IPNet
+
+// parseIPMatcher parses IPs and CIDRs separated by commas, spaces or newlines.
+func parseIPMatcher(s string) (ipMatcher, error) {
+	var m ipMatcher
+	for _, line := range strings.Split(s, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		for _, f := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\r' }) {
+			if !strings.Contains(f, "/") {
+				ip := net.ParseIP(f)
+				if ip == nil {
+					return nil, fmt.Errorf("invalid IP %q", f)
+				}
+				bits := 128
+				if ip4 := ip.To4(); ip4 != nil {
+					ip, bits = ip4, 32
+				}
+				m = append(m, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+			_, ipNet, err := net.ParseCIDR(f)
+			if err != nil {
+				return nil, fmt.Errorf("invalid subnet %q", f)
+			}
+			m = append(m, ipNet)
+		}
+	}
+	return m, nil
+}
+
+// loadIPMatcherFile reads an IP/CIDR list file.
+func loadIPMatcherFile(path string) (ipMatcher, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseIPMatcher(string(b))
+}
+
+func (m ipMatcher) contains(ip string) bool {
+	if len(m) == 0 {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range m {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// withholdNeverSelect splits results into kept and never-select ones, in order.
+func withholdNeverSelect(m ipMatcher, results []NodeResult) (kept, held []NodeResult) {
+	if len(m) == 0 {
+		return results, nil
+	}
+	kept = results[:0:0]
+	for _, r := range results {
+		if m.contains(r.IP) {
+			held = append(held, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	return kept, held
+}
+
+// heldIPs lists the IPs of held results for a status line.
+func heldIPs(held []NodeResult) string {
+	ips := make([]string, len(held))
+	for i, r := range held {
+		ips[i] = r.IP
+	}
+	return strings.Join(ips, ", ")
+}
@@ -0,0 +1,32 @@
+package cfst
+
+import "errors"
+
+// -offline-sources allows no traffic but the probes of the tested IPs.
+
+var errOffline = errors.New("network fetches are disabled by -offline-sources")
+
+// offlineConflicts returns the options cfg sets that -offline-sources forbids.
+func offlineConflicts(cfg Config) []string {
+	var bad []string
+	for _, o := range []struct {
+		flag string
+		on   bool
+	}{
+		{"-ip-url", cfg.IPURL != ""},
+		{"-feed", cfg.FeedURL != ""},
+		{"-telemetry-url", cfg.TelemetryURL != ""},
+		{"-grafana-url", cfg.GrafanaURL != ""},
+		{"-ddns-zone", cfg.DDNSZone != ""},
+		{"-tg-chat", cfg.TGChat != ""},
+		{"-discord-webhook", cfg.DiscordWebhook != ""},
+		{"-slack-webhook", cfg.SlackWebhook != ""},
+		{"-webhook", cfg.Webhook != ""},
+		{"-nat64 auto", cfg.NAT64 == "auto"},
+	} {
+		if o.on {
+			bad = append(bad, o.flag)
+		}
+	}
+	return bad
+}
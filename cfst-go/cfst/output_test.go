@@ -0,0 +1,90 @@
+package cfst
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTestedAtJSON(t *testing.T) {
+	at := time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name string
+		v    any
+		want string // "" = no tested_at
+	}{
+		{"untested result", NodeResult{IP: "1.1.1.1"}, ""},
+		{"tested result", NodeResult{IP: "1.1.1.1", TestedAt: at}, `"tested_at":"2026-10-17T06:00:00Z"`},
+		{"untested history", HistoryRecord{IP: "1.1.1.1"}, ""},
+		{"tested history", HistoryRecord{IP: "1.1.1.1", TestedAt: at}, `"tested_at":"2026-10-17T06:00:00Z"`},
+	} {
+		b, err := json.Marshal(tc.v)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		switch got := string(b); {
+		case tc.want == "" && strings.Contains(got, "tested_at"):
+			t.Errorf("%s: %s has tested_at", tc.name, got)
+		case tc.want != "" && !strings.Contains(got, tc.want):
+			t.Errorf("%s: %s lacks %s", tc.name, got, tc.want)
+		case !strings.Contains(got, `"ip":"1.1.1.1"`):
+			t.Errorf("%s: %s lost the other fields", tc.name, got)
+		}
+	}
+
+	var back NodeResult
+	if err := json.Unmarshal([]byte(`{"ip":"1.1.1.1","tested_at":"2026-10-17T06:00:00Z"}`), &back); err != nil || !back.TestedAt.Equal(at) {
+		t.Errorf("round trip: %v, tested at %v", err, back.TestedAt)
+	}
+}
+
+func TestCSVColumns(t *testing.T) {
+	base := []string{"IP", "Colo", "Latency", "Jitter", "SgSpeed_MB", "Speed_MB", "MinSpeed_MB", "LoadLatency", "Stability", "Score"}
+	for _, tc := range []struct {
+		name  string
+		set   func(cfg *Config)
+		extra []string
+	}{
+		{"defaults", func(cfg *Config) {}, nil},
+		{"custom URL", func(cfg *Config) { cfg.URL = "https://example.com/file" }, []string{"CacheStatus"}},
+		{"ECH", func(cfg *Config) { cfg.ProbeECH = true }, []string{"ECH"}},
+		{"WebSocket", func(cfg *Config) { cfg.WSURL = "wss://example.com/ws" }, []string{"WebSocket", "WSRTT"}},
+		{"gRPC", func(cfg *Config) { cfg.GRPCURL = "https://example.com/svc" }, []string{"GRPC", "GRPCHeld"}},
+		{"resume", func(cfg *Config) { cfg.ProbeResume = true }, []string{"TLSHandshake", "ResumeLatency", "Resumed"}},
+		{"cert", func(cfg *Config) { cfg.ProbeCert = true }, []string{"CertStatus", "CertSubject", "CertIssuer", "CertSANs"}},
+		{"trace fields", func(cfg *Config) { cfg.TraceFields = true }, []string{"EgressIP", "TraceHTTP", "TraceTLS", "Warp", "EgressChanged"}},
+		{"trace fields, egress off", func(cfg *Config) { cfg.TraceFields, cfg.EgressChange = true, EgressOff }, []string{"EgressIP", "TraceHTTP", "TraceTLS", "Warp"}},
+		{"pin", func(cfg *Config) { cfg.PinIPs = []string{"1.1.1.1"} }, []string{"Pinned"}},
+		{"DPI", func(cfg *Config) { cfg.ProbeDPI = true }, []string{"Interference"}},
+		{"longevity", func(cfg *Config) { cfg.Longevity = time.Minute }, []string{"Longevity", "LongevitySec"}},
+		{"cache", func(cfg *Config) { cfg.CacheTTL = time.Hour }, []string{"TestedAt"}},
+		{"pings", func(cfg *Config) { cfg.Pings = 20 }, []string{"PacketLoss"}},
+		{"alt port", func(cfg *Config) { cfg.Port = 8443 }, []string{"Addr"}},
+		{"check 443", func(cfg *Config) { cfg.Port, cfg.Check443 = 8443, true }, []string{"Addr", "Port443"}},
+		{"raw", func(cfg *Config) { cfg.Raw = true }, []string{"TestedAt", "PacketLoss", "Bytes", "DownloadUs", "LatencyUs"}},
+	} {
+		cfg := DefaultConfig()
+		tc.set(&cfg)
+		path := filepath.Join(t.TempDir(), "result.csv")
+		saveCSV(path, []NodeResult{{IP: "1.1.1.1", Colo: "SJC", TCPLatency: 12.345}}, cfg)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(b), "\uFEFF"))).ReadAll()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if want := append(slices.Clone(base), tc.extra...); !slices.Equal(rows[0], want) {
+			t.Errorf("%s: header %v, want %v", tc.name, rows[0], want)
+		}
+		if len(rows) != 2 || len(rows[1]) != len(rows[0]) || rows[1][0] != "1.1.1.1" {
+			t.Errorf("%s: rows %v", tc.name, rows)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package cfst
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pick chooses one of the top results at random, weighted by score, with optional stickiness.
+
+// pickOptions tunes one pick.
+type pickOptions struct {
+	Top    int           // choose among this many top-scored results
+	Power  float64       // weight = score^Power; 0 is uniform, higher favors the best
+	Sticky time.Duration // keep the previous pick this long while it stays in Top (0 = off)
+}
+
+// Pick is the result of one pick.
+type Pick struct {
+	IP       string    `json:"ip"`
+	Colo     string    `json:"colo"`
+	Score    float64   `json:"score"`
+	Speed    float64   `json:"download_speed"`
+	Latency  float64   `json:"tcp_latency"`
+	Weight   float64   `json:"weight"` // chance of this IP being picked, 0-1
+	Sticky   bool      `json:"sticky"` // the previous pick was kept
+	PickedAt time.Time `json:"picked_at"`
+}
+
+var errNoPickCandidates = errors.New("no usable results to pick from")
+
+// latestRun returns the usable records of the most recent run, best first.
+func latestRun(records []HistoryRecord) []HistoryRecord {
+	var last time.Time
+	for _, rec := range records {
+		if rec.Time.After(last) {
+			last = rec.Time
+		}
+	}
+	var run []HistoryRecord
+	for _, rec := range records {
+		if rec.Time.Equal(last) && rec.Speed > 0 && !rec.RateLimited {
+			run = append(run, rec)
+		}
+	}
+	sort.SliceStable(run, func(i, j int) bool { return run[i].Score > run[j].Score })
+	return run
+}
+
+// loadResultCSV reads the usable rows of a result CSV written by saveCSV, best first.
+func loadResultCSV(path string) ([]HistoryRecord, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(b), "\ufeff"))).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	col := make(map[string]int)
+	for i, name := range rows[0] {
+		col[name] = i
+	}
+	for _, name := range []string{"IP", "Colo", "Latency", "Speed_MB", "Score"} {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("%s: no %s column", path, name)
+		}
+	}
+	var recs []HistoryRecord
+	for _, row := range rows[1:] {
+		if len(row) != len(rows[0]) {
+			continue
+		}
+		rec := HistoryRecord{IP: row[col["IP"]], Colo: row[col["Colo"]]}
+		rec.TCPLatency, _ = strconv.ParseFloat(row[col["Latency"]], 64)
+		rec.Speed, _ = strconv.ParseFloat(row[col["Speed_MB"]], 64)
+		rec.Score, _ = strconv.ParseFloat(row[col["Score"]], 64)
+		if rec.Speed > 0 && rec.Colo != "429" {
+			recs = append(recs, rec)
+		}
+	}
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].Score > recs[j].Score })
+	return recs, nil
+}
+
+// pickWeights returns each candidate's chance among the first top.
+func pickWeights(cands []HistoryRecord, opts pickOptions) []float64 {
+	n := len(cands)
+	if opts.Top > 0 && opts.Top < n {
+		n = opts.Top
+	}
+	weights := make([]float64, n)
+	var sum float64
+	for i := range weights {
+		weights[i] = math.Pow(math.Max(cands[i].Score, 0.1), opts.Power)
+		sum += weights[i]
+	}
+	for i := range weights {
+		weights[i] /= sum
+	}
+	return weights
+}
+
+// pickIP chooses from cands (best first). prev is the previous pick, or nil.
+func pickIP(cands []HistoryRecord, opts pickOptions, prev *Pick, now time.Time, rnd *rand.Rand) (Pick, error) {
+	if len(cands) == 0 {
+		return Pick{}, errNoPickCandidates
+	}
+	weights := pickWeights(cands, opts)
+	chosen, sticky := -1, false
+	if prev != nil && opts.Sticky > 0 && now.Sub(prev.PickedAt) < opts.Sticky {
+		for i := range weights {
+			if cands[i].IP == prev.IP {
+				chosen, sticky = i, true
+				break
+			}
+		}
+	}
+	if chosen < 0 {
+		x := rnd.Float64()
+		chosen = len(weights) - 1
+		for i, w := range weights {
+			if x < w {
+				chosen = i
+				break
+			}
+			x -= w
+		}
+	}
+	c := cands[chosen]
+	p := Pick{IP: c.IP, Colo: c.Colo, Score: c.Score, Speed: c.Speed, Latency: c.TCPLatency,
+		Weight: weights[chosen], Sticky: sticky, PickedAt: now}
+	if sticky {
+		p.PickedAt = prev.PickedAt // the sticky window runs from the original pick
+	}
+	return p, nil
+}
+
+// readPickState loads the previous pick saved by the pick subcommand.
+func readPickState(path string) *Pick {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var p Pick
+	if json.Unmarshal(b, &p) != nil || p.IP == "" {
+		return nil
+	}
+	return &p
+}
+
+// runPick implements the pick subcommand.
+func runPick(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("pick", flag.ExitOnError)
+	from := fs.String("from", DefaultConfig().Output, "Result CSV to pick from")
+	history := fs.String("history", "", "Pick from the latest run in this history file instead of -from")
+	top := fs.Int("top", 5, "Choose among the N top-scored results")
+	power := fs.Float64("power", 2, "Weight = score^power: 0 picks uniformly, higher favors the best")
+	stateFile := fs.String("state", "", "File remembering the previous pick, for -sticky")
+	sticky := fs.Duration("sticky", 0, "Keep the previous pick this long while it stays in the top N, e.g. 1h (needs -state)")
+	asJSON := fs.Bool("json", false, "Print the pick as JSON")
+	fs.Parse(args)
+
+	if *sticky > 0 && *stateFile == "" {
+		return errors.New("-sticky needs -state <file>")
+	}
+	var cands []HistoryRecord
+	if *history != "" {
+		records, err := loadHistory(*history)
+		if err != nil {
+			return err
+		}
+		cands = latestRun(records)
+	} else {
+		var err error
+		if cands, err = loadResultCSV(*from); err != nil {
+			return err
+		}
+	}
+
+	var prev *Pick
+	if *stateFile != "" {
+		prev = readPickState(*stateFile)
+	}
+	opts := pickOptions{Top: *top, Power: *power, Sticky: *sticky}
+	p, err := pickIP(cands, opts, prev, time.Now(), rand.New(rand.NewSource(time.Now().UnixNano())))
+	if err != nil {
+		return err
+	}
+	if *stateFile != "" {
+		b, _ := json.Marshal(p)
+		if err := os.WriteFile(*stateFile, b, 0644); err != nil {
+			return err
+		}
+	}
+	if *asJSON {
+		return json.NewEncoder(stdout).Encode(p)
+	}
+	_, err = fmt.Fprintln(stdout, p.IP)
+	return err
+}
+
+// maxPickStates bounds the sticky picks the web server remembers.
+const maxPickStates = 1024
+
+// pickStates remembers /api/pick's previous pick per namespace and key.
+var pickStates = struct {
+	sync.Mutex
+	m map[string]Pick
+}{m: make(map[string]Pick)}
+
+// servePick handles /api/pick from the latest run in cfg.HistoryFile.
+func servePick(w http.ResponseWriter, r *http.Request, cfg Config) {
+	if cfg.HistoryFile == "" {
+		http.Error(w, "History not enabled (start with -history <file>)", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	opts := pickOptions{Top: 5, Power: 2}
+	if v, err := strconv.Atoi(q.Get("top")); err == nil && v > 0 {
+		opts.Top = v
+	}
+	if v, err := strconv.ParseFloat(q.Get("power"), 64); err == nil && v >= 0 {
+		opts.Power = v
+	}
+	if v, err := time.ParseDuration(q.Get("sticky")); err == nil && v > 0 {
+		opts.Sticky = v
+	}
+	records, err := loadHistory(cfg.HistoryFile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stateKey := cfg.Namespace + "\x00" + q.Get("key")
+	pickStates.Lock()
+	var prev *Pick
+	if p, ok := pickStates.m[stateKey]; ok {
+		prev = &p
+	}
+	p, err := pickIP(latestRun(records), opts, prev, time.Now(), rand.New(rand.NewSource(time.Now().UnixNano())))
+	if err == nil && opts.Sticky > 0 {
+		if len(pickStates.m) >= maxPickStates {
+			clear(pickStates.m)
+		}
+		pickStates.m[stateKey] = p
+	}
+	pickStates.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(p)
+}
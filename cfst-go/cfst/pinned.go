@@ -0,0 +1,120 @@
+package cfst
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Pinned IPs are added to every candidate set and always download-tested.
+
+// parsePinList parses IPs separated by commas, spaces or newlines; # starts a comment.
+func parsePinList(s string) ([]string, error) {
+	var ips []string
+	for _, line := range strings.Split(s, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		for _, f := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\r' }) {
+			ip := net.ParseIP(f)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid pinned IP %q", f)
+			}
+			ips = append(ips, ip.String())
+		}
+	}
+	return ips, nil
+}
+
+// loadPinFile reads a pin list file.
+func loadPinFile(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePinList(string(b))
+}
+
+// appendPinned adds the pinned IPs missing from ips.
+func appendPinned(ips, pinned []string) []string {
+	if len(pinned) == 0 {
+		return ips
+	}
+	have := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		have[ip] = true
+	}
+	for _, ip := range pinned {
+		if !have[ip] {
+			have[ip] = true
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// pinTracker keeps the scan results of pinned IPs.
+type pinTracker struct {
+	mu    sync.Mutex
+	order []string
+	seen  map[string]NodeResult
+}
+
+// newPinTracker returns nil when nothing is pinned; a nil tracker is a no-op.
+func newPinTracker(pinned []string) *pinTracker {
+	if len(pinned) == 0 {
+		return nil
+	}
+	t := &pinTracker{seen: make(map[string]NodeResult)}
+	for _, ip := range pinned {
+		if _, dup := t.seen[ip]; !dup {
+			t.order = append(t.order, ip)
+			t.seen[ip] = NodeResult{}
+		}
+	}
+	return t
+}
+
+// observe records n if it is pinned. Safe for concurrent use.
+func (t *pinTracker) observe(n NodeResult) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.seen[n.IP]; ok {
+		t.seen[n.IP] = n
+	}
+}
+
+// count is the number of pinned IPs.
+func (t *pinTracker) count() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.order)
+}
+
+// ensure returns candidates with every pinned IP first, marked Pinned.
+func (t *pinTracker) ensure(candidates []NodeResult, port int) []NodeResult {
+	if t == nil {
+		return candidates
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]NodeResult, 0, len(candidates)+len(t.order))
+	for _, ip := range t.order {
+		n := t.seen[ip]
+		if n.IP == "" {
+			n = NodeResult{IP: ip, Port: port, PacketLoss: 1}
+		}
+		n.Pinned = true
+		out = append(out, n)
+	}
+	for _, c := range candidates {
+		if _, pinned := t.seen[c.IP]; !pinned {
+			out = append(out, c)
+		}
+	}
+	return out
+}
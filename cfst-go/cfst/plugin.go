@@ -0,0 +1,96 @@
+package cfst
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Exec plugins get one pluginRequest as JSON on stdin and answer one pluginResponse on stdout.
+const (
+	HookIPSource     = "ip-source"
+	HookResultFilter = "result-filter"
+	HookExporter     = "exporter"
+)
+
+const pluginTimeout = 2 * time.Minute
+
+type pluginRequest struct {
+	Hook    string       `json:"hook"`
+	Max     int          `json:"max,omitempty"`
+	Port    int          `json:"port,omitempty"`
+	IPs     []string     `json:"ips,omitempty"`
+	Results []NodeResult `json:"results,omitempty"`
+	Summary *RunSummary  `json:"summary,omitempty"`
+}
+
+type pluginResponse struct {
+	IPs     []string     `json:"ips"`
+	Results []NodeResult `json:"results"`
+	Message string       `json:"message"`
+}
+
+// runPlugin runs command (split on whitespace) with req on stdin.
+func runPlugin(ctx context.Context, command string, req pluginRequest) (pluginResponse, error) {
+	var resp pluginResponse
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return resp, fmt.Errorf("empty plugin command")
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pluginTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return resp, fmt.Errorf("%s plugin %q: %v", req.Hook, args[0], err)
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return resp, nil
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return resp, fmt.Errorf("%s plugin %q: bad response: %v", req.Hook, args[0], err)
+	}
+	return resp, nil
+}
+
+// pluginSourceIPs passes the generated IPs through the ip-source plugin.
+func pluginSourceIPs(ctx context.Context, cfg Config, ips []string) ([]string, error) {
+	if cfg.PluginSource == "" {
+		return ips, nil
+	}
+	resp, err := runPlugin(ctx, cfg.PluginSource, pluginRequest{Hook: HookIPSource, Max: cfg.MaxScan, Port: cfg.Port, IPs: ips})
+	if err != nil {
+		return ips, err
+	}
+	if resp.IPs == nil {
+		return ips, nil
+	}
+	return resp.IPs, nil
+}
+
+// pluginFilterResults passes the final results through the result-filter plugin.
+func pluginFilterResults(ctx context.Context, cfg Config, results []NodeResult) ([]NodeResult, error) {
+	if cfg.PluginFilter == "" {
+		return results, nil
+	}
+	resp, err := runPlugin(ctx, cfg.PluginFilter, pluginRequest{Hook: HookResultFilter, Results: results})
+	if err != nil {
+		return results, err
+	}
+	if resp.Results == nil {
+		return results, nil
+	}
+	return resp.Results, nil
+}
@@ -0,0 +1,103 @@
+package cfst
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Dials that fail for lack of a local port are counted, and the scan throttles itself while they last.
+
+// portExhaustion counts dials that failed for lack of a local port or socket buffer.
+var portExhaustion atomic.Int64
+
+// Winsock codes; syscall's Windows constants for these names never match.
+const (
+	wsaeAddrInUse    = 10048
+	wsaeAddrNotAvail = 10049
+	wsaeNoBufs       = 10055
+)
+
+// isPortExhaustion reports whether a dial error means the local side ran out of ports or buffers.
+func isPortExhaustion(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	switch errno {
+	case syscall.EADDRNOTAVAIL, syscall.EADDRINUSE, syscall.ENOBUFS,
+		wsaeAddrInUse, wsaeAddrNotAvail, wsaeNoBufs:
+		return true
+	}
+	return false
+}
+
+// noteDialError counts err if it indicates port exhaustion.
+func noteDialError(err error) {
+	if isPortExhaustion(err) {
+		portExhaustion.Add(1)
+	}
+}
+
+// portExhaustionWarning explains n exhausted dials to the user.
+func portExhaustionWarning(n int) string {
+	return fmt.Sprintf("%d connection(s) failed because this machine ran out of local ports; "+
+		"results may be incomplete. Lower -sc/-dlc or wait a minute for closed sockets to be released.", n)
+}
+
+// Throttle tuning: halve the probes in flight on exhaustion, double them again when quiet.
+const (
+	throttleFloor   = 8
+	throttlePause   = 2 * time.Second
+	throttleRecover = 15 * time.Second
+)
+
+// dialThrottle limits a scan's in-flight probes while port exhaustion errors appear.
+type dialThrottle struct {
+	max, limit int
+	seen       int64     // portExhaustion at the last check
+	resumeAt   time.Time // no new probes before this
+	lastHit    time.Time
+}
+
+func newDialThrottle(concurrency int) *dialThrottle {
+	return &dialThrottle{max: concurrency, limit: concurrency, seen: portExhaustion.Load()}
+}
+
+// update adjusts the limit to the errors seen since the last call.
+func (t *dialThrottle) update(now time.Time) {
+	if n := portExhaustion.Load(); n > t.seen {
+		t.seen = n
+		// One burst of failures from probes already in flight counts once.
+		if now.After(t.resumeAt) {
+			t.limit = max(t.limit/2, min(throttleFloor, t.max))
+			t.resumeAt = now.Add(throttlePause)
+		}
+		t.lastHit = now
+		return
+	}
+	if t.limit < t.max && now.Sub(t.lastHit) > throttleRecover {
+		t.limit = min(t.limit*2, t.max)
+		t.lastHit = now
+	}
+}
+
+// admit waits until another probe may start, or returns false when ctx is done.
+func (t *dialThrottle) admit(ctx context.Context, inflight *atomic.Int32) bool {
+	for {
+		now := time.Now()
+		t.update(now)
+		// At full concurrency the caller's semaphore is the only limit.
+		if now.After(t.resumeAt) && (t.limit >= t.max || int(inflight.Load()) < t.limit) {
+			return true
+		}
+		select {
+		case <-time.After(20 * time.Millisecond):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
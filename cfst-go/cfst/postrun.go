@@ -0,0 +1,201 @@
+package cfst
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// bestResult returns the top-scored usable result of the sorted results, or nil.
+func bestResult(results []NodeResult) *NodeResult {
+	for i := range results {
+		if results[i].DownloadSpeed > 0 {
+			return &results[i]
+		}
+	}
+	return nil
+}
+
+// topUsable returns up to n usable results (all with n <= 0), in order.
+func topUsable(results []NodeResult, n int) []NodeResult {
+	var top []NodeResult
+	for _, r := range results {
+		if r.DownloadSpeed > 0 && (n <= 0 || len(top) < n) {
+			top = append(top, r)
+		}
+	}
+	return top
+}
+
+// previousBestIP returns the top-scored IP of the most recent run in history.
+func previousBestIP(history []HistoryRecord) string {
+	if rec := previousBestRecord(history); rec != nil {
+		return rec.IP
+	}
+	return ""
+}
+
+// previousBestRecord returns the top-scored record of the most recent run in history, or nil.
+func previousBestRecord(history []HistoryRecord) *HistoryRecord {
+	var last time.Time
+	for _, rec := range history {
+		if rec.Time.After(last) {
+			last = rec.Time
+		}
+	}
+	var best *HistoryRecord
+	for i, rec := range history {
+		if rec.Time.Equal(last) && rec.Speed > 0 && (best == nil || rec.Score > best.Score) {
+			best = &history[i]
+		}
+	}
+	return best
+}
+
+// reportBlocked records a run whose download tests all failed and tells the chat hooks.
+func reportBlocked(cfg Config, summary RunSummary) []error {
+	metricsFor(cfg.Namespace).record(nil, summary, time.Now())
+	return notifyChat(cfg, "blocked", fmt.Sprintf("cfst: all %d tested IPs failed or were rate-limited", summary.Tested), "")
+}
+
+// finishRun runs the post-run integrations shared by the CLI and the web server.
+func finishRun(cfg Config, results []NodeResult, summary RunSummary, notify func(kind string, data interface{})) {
+	now := time.Now()
+	metricsFor(cfg.Namespace).record(results, summary, now)
+	var history []HistoryRecord
+	if cfg.HistoryFile != "" {
+		history, _ = loadHistory(cfg.HistoryFile)
+	}
+
+	if alert := detectFleetDegradation(history, results, cfg.AlertDrop); alert != nil {
+		notify("alert", alert)
+	}
+	for i := range summary.Detours {
+		notify("alert", &summary.Detours[i])
+	}
+
+	if cfg.GrafanaURL != "" {
+		best := bestResult(results)
+		if best != nil && grafanaEventEnabled(cfg.GrafanaEvents, "complete") {
+			text := fmt.Sprintf("CFST run complete: best %s (%s) %.2f MB/s, %.1f ms", best.IP, best.Colo, best.DownloadSpeed, best.TCPLatency)
+			if err := postGrafanaAnnotation(cfg.GrafanaURL, cfg.GrafanaToken, now, []string{"cfst", "run"}, text); err != nil {
+				notify("status", "Grafana annotation failed: "+err.Error())
+			}
+		}
+		prev := previousBestIP(history)
+		if best != nil && prev != "" && prev != best.IP && grafanaEventEnabled(cfg.GrafanaEvents, "change") {
+			text := fmt.Sprintf("CFST best IP changed: %s → %s (%s)", prev, best.IP, best.Colo)
+			if err := postGrafanaAnnotation(cfg.GrafanaURL, cfg.GrafanaToken, now, []string{"cfst", "best-ip-change"}, text); err != nil {
+				notify("status", "Grafana annotation failed: "+err.Error())
+			}
+		}
+	}
+
+	if cfg.PluginExporter != "" {
+		resp, err := runPlugin(context.Background(), cfg.PluginExporter, pluginRequest{Hook: HookExporter, Results: results, Summary: &summary})
+		if err != nil {
+			notify("status", "Exporter plugin failed: "+err.Error())
+		} else if resp.Message != "" {
+			notify("status", resp.Message)
+		}
+	}
+
+	if cfg.BestOut != "" {
+		if err := writeBest(cfg, results); err != nil {
+			notify("status", "Error writing the best result: "+err.Error())
+		}
+	}
+
+	if cfg.BindOut != "" {
+		if err := writeZone(cfg, results, now); err != nil {
+			notify("status", "Error writing zone records: "+err.Error())
+		}
+	}
+
+	if cfg.DnsmasqOut != "" || cfg.AdGuardOut != "" {
+		if err := writeRewrites(cfg, results); err != nil {
+			notify("status", "Error writing DNS rewrites: "+err.Error())
+		}
+	}
+
+	if cfg.HostsDomains != "" {
+		if err := writeHosts(cfg, results); err != nil {
+			notify("status", "Error writing the hosts file: "+err.Error())
+		}
+	}
+
+	if cfg.DDNSZone != "" {
+		if msg, err := updateDDNS(cfg, results); err != nil {
+			notify("status", "DDNS update failed: "+err.Error())
+		} else {
+			notify("status", msg)
+		}
+	}
+
+	if cfg.SingBoxTemplate != "" {
+		if msg, err := writeSingBox(cfg, results); err != nil {
+			notify("status", "sing-box config update failed: "+err.Error())
+		} else {
+			notify("status", msg)
+		}
+	}
+
+	if cfg.XrayConfig != "" {
+		if msg, err := writeXray(cfg, results); err != nil {
+			notify("status", "Xray config update failed: "+err.Error())
+		} else {
+			notify("status", msg)
+		}
+	}
+
+	if cfg.TGChat != "" {
+		if err := sendTelegram(cfg, runReport("cfst run complete", results, summary)); err != nil {
+			notify("status", "Telegram notification failed: "+err.Error())
+		}
+	}
+
+	if cfg.DiscordWebhook != "" || cfg.SlackWebhook != "" {
+		errs := notifyChat(cfg, "complete", "cfst run complete", reportBody(results, summary))
+		if best, prev := bestResult(results), previousBestIP(history); best != nil && prev != "" && prev != best.IP {
+			errs = append(errs, notifyChat(cfg, "change", fmt.Sprintf("cfst: best IP changed %s → %s (%s)", prev, best.IP, best.Colo), "")...)
+		}
+		for _, err := range errs {
+			notify("status", "Chat notification failed: "+err.Error())
+		}
+	}
+
+	if cfg.Webhook != "" {
+		if err := postWebhook(cfg, results, summary, now); err != nil {
+			notify("status", "Webhook failed: "+err.Error())
+		}
+	}
+
+	if cfg.TelemetryURL != "" {
+		if err := sendTelemetry(cfg, summary.ranges, results, now); err != nil {
+			notify("status", "Telemetry upload failed: "+err.Error())
+		} else {
+			notify("status", "Anonymized telemetry sent")
+		}
+	}
+
+	if cfg.HistoryFile != "" {
+		if err := appendHistory(cfg.HistoryFile, results, now); err != nil {
+			notify("status", "Error writing history: "+err.Error())
+		}
+	}
+	if cfg.DBFile != "" {
+		if err := appendRunDB(cfg, results, summary, now); err != nil {
+			notify("status", "Error writing the result database: "+err.Error())
+		}
+	}
+}
+
+// printNotice is the CLI sink for finishRun events.
+func printNotice(kind string, data interface{}) {
+	switch v := data.(type) {
+	case *Alert:
+		fmt.Printf("\n🚨 %s\n", v.Message)
+	default:
+		fmt.Printf("\n%v\n", v)
+	}
+}
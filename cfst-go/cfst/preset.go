@@ -0,0 +1,85 @@
+package cfst
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Presets bundle settings for one use case; explicit flags keep their value.
+type presetSetting struct {
+	flag  string // "" = always applied
+	apply func(*Config)
+}
+
+var presets = map[string][]presetSetting{
+	"quick": {
+		{"sc", func(c *Config) { c.ScanConcurrent = max(c.ScanConcurrent, 1000) }},
+		{"max", func(c *Config) { c.MaxScan = min(c.MaxScan, 2000) }},
+		{"dn", func(c *Config) { c.DownloadNum = 10 }},
+		{"n", func(c *Config) { c.Pings = 3 }},
+		{"", func(c *Config) {
+			c.LatencyOnly = true
+			c.PingTimeout = 500 * time.Millisecond
+		}},
+	},
+	"thorough": {
+		{"dt", func(c *Config) { c.Duration = max(c.Duration, 15) }},
+		{"expand", func(c *Config) { c.Expand = max(c.Expand, 3) }},
+		{"verify", func(c *Config) { c.Verify = max(c.Verify, 2) }},
+		{"longevity", func(c *Config) { c.Longevity = max(c.Longevity, 2*time.Minute) }},
+		{"longevity-n", func(c *Config) { c.LongevityN = min(c.LongevityN, verifyTop) }},
+		{"n", func(c *Config) { c.Pings = max(c.Pings, 10) }},
+	},
+}
+
+// presetNames lists the presets for help and error messages.
+func presetNames() string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// presetConfig applies the named preset to cfg, leaving the flags in set alone.
+func presetConfig(name string, cfg *Config, set map[string]bool) error {
+	settings, ok := presets[name]
+	if !ok {
+		return fmt.Errorf("unknown preset %q (have %s)", name, presetNames())
+	}
+	for _, s := range settings {
+		if s.flag == "" || !set[s.flag] {
+			s.apply(cfg)
+		}
+	}
+	return nil
+}
+
+// applyPreset is presetConfig for the CLI, which reports the outcome.
+func applyPreset(name string, cfg *Config, set map[string]bool) error {
+	if err := presetConfig(name, cfg, set); err != nil {
+		return err
+	}
+	fmt.Printf("🎛 Preset %s: scan concurrency %d, max %d IPs, %d result(s)\n",
+		name, cfg.ScanConcurrent, cfg.MaxScan, cfg.DownloadNum)
+	return nil
+}
+
+// latencyColumns is the CLI table layout of a latency-only run.
+func latencyColumns() []tableColumn {
+	return []tableColumn{
+		{"IP", 16, func(r NodeResult) string { return r.IP }},
+		{"Latency", 9, func(r NodeResult) string { return fmt.Sprintf("%6.1fms", r.TCPLatency) }},
+		{"Jitter", 9, func(r NodeResult) string { return fmt.Sprintf("%5.1fms", r.Jitter) }},
+		{"Loss", 6, func(r NodeResult) string { return fmt.Sprintf("%3.0f%%", r.PacketLoss*100) }},
+	}
+}
+
+// latencyOnlyResults returns the DownloadNum lowest-latency recommendable scan results.
+func latencyOnlyResults(cfg Config, nodes []NodeResult) []NodeResult {
+	nodes, _ = withholdNeverSelect(cfg.NeverSelect, nodes)
+	return nodes[:min(cfg.DownloadNum, len(nodes))]
+}
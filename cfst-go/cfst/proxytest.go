@@ -0,0 +1,105 @@
+package cfst
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -proxy downloads through a local proxy whose outbound -proxy-switch points at each IP.
+
+const proxySwitchTimeout = 30 * time.Second
+
+// parseProxyURL parses a -proxy address; a bare host:port means SOCKS5.
+func parseProxyURL(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "socks5://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		if u.Host == "" {
+			return nil, fmt.Errorf("-proxy %q has no host", s)
+		}
+		return u, nil
+	}
+	return nil, fmt.Errorf("-proxy %q: scheme must be http, https or socks5", s)
+}
+
+func expandProxySwitch(s, ip string, port int) string {
+	return strings.NewReplacer("{ip}", ip, "{port}", strconv.Itoa(port)).Replace(s)
+}
+
+// switchProxy points the proxy's outbound at ip:port.
+func switchProxy(ctx context.Context, hook, ip string, port int) error {
+	ctx, cancel := context.WithTimeout(ctx, proxySwitchTimeout)
+	defer cancel()
+	if strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://") {
+		req, err := http.NewRequestWithContext(ctx, "GET", expandProxySwitch(hook, ip, port), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("proxy switch: %v", err)
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("proxy switch: %s", resp.Status)
+		}
+		return nil
+	}
+
+	args := strings.Fields(hook)
+	if len(args) == 0 {
+		return fmt.Errorf("empty -proxy-switch command")
+	}
+	for i := range args {
+		args[i] = expandProxySwitch(args[i], ip, port)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("proxy switch %q: %v", args[0], err)
+	}
+	return nil
+}
+
+// ProxyStreamTest switches the proxy to ip and downloads testURL through it.
+func ProxyStreamTest(ctx context.Context, cfg Config, ip string, progressCallback func(LiveProgress)) (StreamResult, error) {
+	if cfg.ProxySwitch != "" {
+		if err := switchProxy(ctx, cfg.ProxySwitch, ip, cfg.Port); err != nil {
+			return StreamResult{}, err
+		}
+	}
+	proxyURL, err := parseProxyURL(cfg.Proxy)
+	if err != nil {
+		return StreamResult{}, err
+	}
+	downloadCtx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Duration)*time.Second)
+	defer cancel()
+
+	t, err := loadDownloadTemplate(cfg.URL, "")
+	if err != nil {
+		return StreamResult{}, err
+	}
+	rs := settingsOf(ctx)
+	req := t.req.Clone(downloadCtx)
+	setUserAgent(req.Header, rs.userAgents.pick())
+	// A fresh transport per test: a kept-alive tunnel would still use the previous outbound.
+	tr := &http.Transport{Proxy: http.ProxyURL(proxyURL), MaxIdleConnsPerHost: max(cfg.Streams, 1)}
+	defer tr.CloseIdleConnections()
+	client := &http.Client{Transport: tr, CheckRedirect: rs.checkRedirect}
+	return streamTest(downloadCtx, client, req, ip, cfg.Duration, max(cfg.Streams, 1), progressCallback), nil
+}
@@ -0,0 +1,42 @@
+package cfst
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Redirect policies for requests made through a pinned IP.
+const (
+	RedirectFollow = "follow" // follow up to MaxRedirects hops
+	RedirectError  = "error"  // a redirect fails the request
+)
+
+var errRedirected = errors.New("redirected")
+
+type redirectPolicy struct {
+	mode    string
+	maxHops int
+}
+
+// configureRedirects installs the redirect policy from the config.
+func (rs *runSettings) configureRedirects(cfg Config) error {
+	switch cfg.Redirect {
+	case RedirectFollow, RedirectError:
+	default:
+		return fmt.Errorf("unknown redirect policy %q (want %s or %s)", cfg.Redirect, RedirectFollow, RedirectError)
+	}
+	rs.redirects = redirectPolicy{mode: cfg.Redirect, maxHops: cfg.MaxRedirects}
+	return nil
+}
+
+// checkRedirect is the CheckRedirect of every IP-pinned client.
+func (rs *runSettings) checkRedirect(req *http.Request, via []*http.Request) error {
+	if rs.redirects.mode == RedirectError {
+		return fmt.Errorf("%w to %s", errRedirected, req.URL.Redacted())
+	}
+	if len(via) > rs.redirects.maxHops {
+		return fmt.Errorf("%w: more than %d hops", errRedirected, rs.redirects.maxHops)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package cfst
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestCheckRedirect(t *testing.T) {
+	for _, tc := range []struct {
+		mode     string
+		maxHops  int
+		hops     int
+		redirect bool // want errRedirected
+	}{
+		{RedirectFollow, 5, 1, false},
+		{RedirectFollow, 5, 5, false},
+		{RedirectFollow, 5, 6, true},
+		{RedirectFollow, 0, 1, true},
+		{RedirectError, 5, 1, true},
+	} {
+		rs := newRunSettings()
+		cfg := DefaultConfig()
+		cfg.Redirect, cfg.MaxRedirects = tc.mode, tc.maxHops
+		if err := rs.configureRedirects(cfg); err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/next", nil)
+		err := rs.checkRedirect(req, make([]*http.Request, tc.hops))
+		if got := errors.Is(err, errRedirected); got != tc.redirect {
+			t.Errorf("%s, %d hops max, after %d: %v", tc.mode, tc.maxHops, tc.hops, err)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.Redirect = "sometimes"
+	if err := newRunSettings().configureRedirects(cfg); err == nil {
+		t.Error("unknown redirect policy accepted")
+	}
+}
@@ -0,0 +1,139 @@
+package cfst
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// -resolve maps hosts other than the test URL's to fixed addresses, like curl's --resolve.
+
+// resolveEntry is one -resolve mapping.
+type resolveEntry struct {
+	host string
+	port int // 0 = any
+	ip   string
+}
+
+// parseResolve parses a comma-separated -resolve list.
+func parseResolve(s string) ([]resolveEntry, error) {
+	var entries []resolveEntry
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		host, rest, ok := strings.Cut(f, ":")
+		if !ok || host == "" {
+			return nil, fmt.Errorf("-resolve %q: want host:ip or host:port:ip", f)
+		}
+		e := resolveEntry{host: strings.ToLower(host), ip: strings.Trim(rest, "[]")}
+		if net.ParseIP(e.ip) == nil {
+			// host:port:ip; a bare IPv6 address was handled above.
+			p, ip, _ := strings.Cut(rest, ":")
+			port, err := strconv.Atoi(p)
+			if e.ip = strings.Trim(ip, "[]"); err != nil || port < 1 || port > 65535 || net.ParseIP(e.ip) == nil {
+				return nil, fmt.Errorf("-resolve %q: want host:ip or host:port:ip", f)
+			}
+			e.port = port
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// configureResolve installs the -resolve mappings.
+func (rs *runSettings) configureResolve(cfg Config) error {
+	entries, err := parseResolve(cfg.Resolve)
+	if err != nil {
+		return err
+	}
+	rs.resolve = entries
+	if u, err := url.Parse(cfg.URL); err == nil {
+		if _, ok := rs.resolvedAddr(net.JoinHostPort(u.Hostname(), defaultPort(u))); ok {
+			rs.resolve = nil
+			return fmt.Errorf("-resolve maps %s, the test URL's host; use -sni or -target-override instead", u.Hostname())
+		}
+	}
+	return nil
+}
+
+// defaultPort is u's port, or its scheme's default.
+func defaultPort(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+	if u.Scheme == "http" {
+		return "80"
+	}
+	return "443"
+}
+
+// resolvedAddr returns the address -resolve maps hostport to, if any.
+func (rs *runSettings) resolvedAddr(hostport string) (string, bool) {
+	host, p, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return "", false
+	}
+	port, _ := strconv.Atoi(p)
+	host = strings.ToLower(host)
+	for _, e := range rs.resolve {
+		if e.host == host && (e.port == 0 || e.port == port) {
+			return net.JoinHostPort(e.ip, p), true
+		}
+	}
+	return "", false
+}
+
+// resolvedTransport builds the transport for -resolve hosts, with the host as SNI.
+func (rs *runSettings) resolvedTransport() *http.Transport {
+	return &http.Transport{
+		TLSClientConfig: rs.tls,
+		DialContext: func(ctx context.Context, network, hostport string) (net.Conn, error) {
+			addr, ok := rs.resolvedAddr(hostport)
+			if !ok {
+				return nil, fmt.Errorf("%s: no -resolve mapping", hostport)
+			}
+			conn, err := rs.dialer(rs.transport.dialTimeout).DialContext(ctx, "tcp", addr)
+			if err != nil {
+				noteDialError(err)
+				return nil, err
+			}
+			rs.tuneConn(conn)
+			return conn, nil
+		},
+	}
+}
+
+// resolvingTransport sends -resolve hosts to their mapped address and the rest to the tested IP.
+type resolvingTransport struct {
+	rs     *runSettings
+	pinned *http.Transport
+}
+
+func (t resolvingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := t.rs.resolvedAddr(net.JoinHostPort(req.URL.Hostname(), defaultPort(req.URL))); ok {
+		return t.rs.resolved.RoundTrip(req)
+	}
+	return t.pinned.RoundTrip(req)
+}
+
+// withResolve returns the RoundTripper of a client over the pinned transport tr.
+func (rs *runSettings) withResolve(tr *http.Transport) http.RoundTripper {
+	if len(rs.resolve) == 0 {
+		return tr
+	}
+	return resolvingTransport{rs: rs, pinned: tr}
+}
+
+// pinnedOf returns the pinned transport under rt, for reconfiguring it.
+func pinnedOf(rt http.RoundTripper) (*http.Transport, bool) {
+	if t, ok := rt.(resolvingTransport); ok {
+		return t.pinned, true
+	}
+	tr, ok := rt.(*http.Transport)
+	return tr, ok
+}
@@ -0,0 +1,103 @@
+package cfst
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The result cache keeps each ip:port's last download measurement for -cache-ttl.
+
+const defaultResultCacheFile = "cfst-cache.json"
+
+type cachedResult struct {
+	TestedAt time.Time  `json:"tested_at"`
+	URL      string     `json:"url"`
+	Result   NodeResult `json:"result"`
+}
+
+// resultCacheMu serializes read-modify-write cycles from concurrent web runs.
+var resultCacheMu sync.Mutex
+
+func resultCacheKey(ip string, port int) string {
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// cacheURL is the test URL without the per-run cfst parameter of -own-zone.
+func cacheURL(testURL string) string {
+	u, err := url.Parse(testURL)
+	if err != nil {
+		return testURL
+	}
+	q := u.Query()
+	if !q.Has("cfst") {
+		return testURL
+	}
+	q.Del("cfst")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func loadResultCache(path string) map[string]cachedResult {
+	cache := make(map[string]cachedResult)
+	if content, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(content, &cache)
+	}
+	return cache
+}
+
+// splitCachedCandidates splits candidates into fresh cache hits and those still to test.
+func splitCachedCandidates(cfg Config, candidates []NodeResult) (hits, rest []NodeResult) {
+	resultCacheMu.Lock()
+	cache := loadResultCache(cfg.CacheFile)
+	resultCacheMu.Unlock()
+
+	key := cacheURL(cfg.URL)
+	now := time.Now()
+	for _, cand := range candidates {
+		entry, ok := cache[resultCacheKey(cand.IP, cand.Port)]
+		if !ok || cacheURL(entry.URL) != key || now.Sub(entry.TestedAt) > cfg.CacheTTL {
+			rest = append(rest, cand)
+			continue
+		}
+		res := entry.Result
+		res.TCPLatency, res.Jitter, res.PacketLoss = cand.TCPLatency, cand.Jitter, cand.PacketLoss
+		res.Pinned = cand.Pinned
+		res.CalcScore()
+		hits = append(hits, res)
+	}
+	return hits, rest
+}
+
+// storeResultCache records successful measurements and drops expired entries.
+func storeResultCache(cfg Config, results []NodeResult) error {
+	resultCacheMu.Lock()
+	defer resultCacheMu.Unlock()
+
+	cache := loadResultCache(cfg.CacheFile)
+	now := time.Now()
+	for k, entry := range cache {
+		if now.Sub(entry.TestedAt) > cfg.CacheTTL {
+			delete(cache, k)
+		}
+	}
+	for _, r := range results {
+		if r.DownloadSpeed > 0 {
+			// A cache hit keeps its original time, so reuse can't extend the TTL.
+			testedAt := r.TestedAt
+			if testedAt.IsZero() {
+				testedAt = now
+			}
+			cache[resultCacheKey(r.IP, r.Port)] = cachedResult{TestedAt: testedAt, URL: cacheURL(cfg.URL), Result: r}
+		}
+	}
+	b, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(cfg.CacheFile, b, 0644)
+}
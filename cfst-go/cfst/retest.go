@@ -0,0 +1,82 @@
+package cfst
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// /api/retest re-measures a few IPs from an earlier job.
+
+// maxRetestIPs bounds one retest request.
+const maxRetestIPs = 50
+
+// parseRetestIPs parses the comma-separated ips parameter.
+func parseRetestIPs(v string) ([]string, error) {
+	var ips []string
+	seen := make(map[string]bool)
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		ip := net.ParseIP(f)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP %q", f)
+		}
+		if s := ip.String(); !seen[s] {
+			seen[s] = true
+			ips = append(ips, s)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("ips is required (comma-separated)")
+	}
+	if len(ips) > maxRetestIPs {
+		return nil, fmt.Errorf("at most %d IPs per retest", maxRetestIPs)
+	}
+	return ips, nil
+}
+
+// retest pings, colo-checks and download-tests every one of ips, ignoring the cache.
+func retest(ctx context.Context, cfg Config, ips []string, stats *DownloadStats, timer *phaseTimer,
+	send func(evtType string, data interface{}), report func(done, total int)) []NodeResult {
+	cfg.DownloadNum = len(ips)
+	cfg.Skip429 = false
+	cfg.MinSpeed = 0
+	cfg.CacheTTL = 0
+	cfg.StopThreshold = 9999.0 // disable fast-exit
+	if isCustomURL(cfg.URL) {
+		cfg.SkipLoadLatency = true
+	}
+
+	send("status", fmt.Sprintf("Pinging %d IP(s)...", len(ips)))
+	pinged, _ := ScanPingBounded(ctx, ips, cfg.Port, len(ips), len(ips), pingerFor(cfg), nil, nil)
+	byIP := make(map[string]NodeResult, len(pinged))
+	for _, n := range pinged {
+		byIP[n.IP] = n
+	}
+	candidates := make([]NodeResult, len(ips))
+	for i, ip := range ips {
+		n, ok := byIP[ip]
+		if !ok {
+			n = NodeResult{IP: ip, Port: cfg.Port, PacketLoss: 1}
+		}
+		candidates[i] = n
+	}
+	send("phase", timer.mark("ping", len(ips)))
+
+	var done int
+	results := runParallelDownloadTest(ctx, candidates, cfg, stats, func(res NodeResult) {
+		done++
+		report(done, len(ips))
+		send("progress_download", res)
+	}, func(msg string) {
+		send("status", msg)
+	}, func(p LiveProgress) {
+		send("progress_live", p)
+	}, nil)
+	send("phase", timer.mark("download", int(stats.Tested.Load())))
+	return results
+}
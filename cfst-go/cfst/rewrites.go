@@ -0,0 +1,80 @@
+package cfst
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// -dnsmasq-out and -adguard-out point the -rewrite-domains at the top results.
+
+// Rewrite is one AdGuard Home DNS rewrite.
+type Rewrite struct {
+	Domain string `json:"domain"`
+	Answer string `json:"answer"`
+
+	addr string // ip:port the answer was measured on, when not 443
+}
+
+// parseDomainList splits a comma-separated domain list.
+func parseDomainList(s string) []string {
+	var domains []string
+	for _, d := range strings.Split(s, ",") {
+		if d = strings.TrimSuffix(strings.TrimSpace(d), "."); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// rewritesFor pairs every domain with each of the top usable results.
+func rewritesFor(results []NodeResult, domains []string, top int, only443 bool) []Rewrite {
+	var rw []Rewrite
+	ips := topUsable(forPortless(results, only443), top)
+	for _, d := range domains {
+		for _, r := range ips {
+			w := Rewrite{Domain: d, Answer: r.IP}
+			if altPort(r) {
+				w.addr = resultAddr(r.IP, r.Port)
+			}
+			rw = append(rw, w)
+		}
+	}
+	return rw
+}
+
+func formatDnsmasq(rw []Rewrite) string {
+	var b strings.Builder
+	for _, r := range rw {
+		if r.addr != "" {
+			fmt.Fprintf(&b, "# measured on %s\n", r.addr)
+		}
+		fmt.Fprintf(&b, "address=/%s/%s\n", r.Domain, r.Answer)
+	}
+	return b.String()
+}
+
+// writeRewrites writes the -dnsmasq-out and -adguard-out files.
+func writeRewrites(cfg Config, results []NodeResult) error {
+	domains := parseDomainList(cfg.RewriteDomains)
+	if len(domains) == 0 {
+		return fmt.Errorf("-dnsmasq-out and -adguard-out need -rewrite-domains")
+	}
+	rw := rewritesFor(results, domains, cfg.RewriteTop, cfg.Check443)
+	if len(rw) == 0 {
+		return fmt.Errorf("no usable results to write rewrites for")
+	}
+	if cfg.DnsmasqOut != "" {
+		if err := os.WriteFile(cfg.DnsmasqOut, []byte(formatDnsmasq(rw)), 0644); err != nil {
+			return err
+		}
+	}
+	if cfg.AdGuardOut != "" {
+		b, _ := json.MarshalIndent(rw, "", "  ")
+		if err := os.WriteFile(cfg.AdGuardOut, append(b, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin
+
+package cfst
+
+import "syscall"
+
+// raiseFDLimit raises the soft open-file limit to the hard limit and returns it.
+func raiseFDLimit() (uint64, error) {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, err
+	}
+	if lim.Cur >= lim.Max {
+		return lim.Cur, nil
+	}
+	raised := lim
+	raised.Cur = lim.Max
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &raised); err != nil {
+		return lim.Cur, err
+	}
+	return raised.Cur, nil
+}
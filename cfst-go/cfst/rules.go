@@ -0,0 +1,312 @@
+package cfst
+
+// A small rules language (-rules) that drops, keeps and re-ranks the final results.
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ruleStmt struct {
+	line   int
+	action string // drop, keep, rank, keep-previous
+	cond   ruleCond
+	field  string // rank
+	asc    bool   // rank
+}
+
+type ruleCond interface {
+	eval(r NodeResult, best NodeResult) bool
+}
+
+type ruleAnd struct{ a, b ruleCond }
+type ruleOr struct{ a, b ruleCond }
+type ruleNot struct{ c ruleCond }
+type ruleCmp struct {
+	field string
+	best  bool
+	op    string
+	value string
+}
+
+func (c ruleAnd) eval(r, best NodeResult) bool { return c.a.eval(r, best) && c.b.eval(r, best) }
+func (c ruleOr) eval(r, best NodeResult) bool  { return c.a.eval(r, best) || c.b.eval(r, best) }
+func (c ruleNot) eval(r, best NodeResult) bool { return !c.c.eval(r, best) }
+
+func (c ruleCmp) eval(r, best NodeResult) bool {
+	if c.best {
+		r = best
+	}
+	v, _ := resultField(r, c.field)
+	switch c.op {
+	case "in", "not in":
+		found := false
+		for _, item := range strings.Split(c.value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), fmt.Sprint(v)) {
+				found = true
+				break
+			}
+		}
+		return found == (c.op == "in")
+	}
+	if f, ok := v.(float64); ok {
+		want, err := strconv.ParseFloat(c.value, 64)
+		if err != nil {
+			return false
+		}
+		switch c.op {
+		case "==":
+			return f == want
+		case "!=":
+			return f != want
+		case "<":
+			return f < want
+		case "<=":
+			return f <= want
+		case ">":
+			return f > want
+		case ">=":
+			return f >= want
+		}
+		return false
+	}
+	s := fmt.Sprint(v)
+	switch c.op {
+	case "==":
+		return strings.EqualFold(s, c.value)
+	case "!=":
+		return !strings.EqualFold(s, c.value)
+	}
+	return false
+}
+
+// resultField exposes NodeResult fields to rules by name.
+func resultField(r NodeResult, name string) (interface{}, bool) {
+	switch name {
+	case "ip":
+		return r.IP, true
+	case "colo":
+		return r.Colo, true
+	case "cache":
+		return r.CacheStatus, true
+	case "latency":
+		return r.TCPLatency, true
+	case "jitter":
+		return r.Jitter, true
+	case "loss":
+		return r.PacketLoss, true
+	case "speed":
+		return r.DownloadSpeed, true
+	case "single_speed":
+		return r.SingleSpeed, true
+	case "min_speed":
+		return r.MinSpeed, true
+	case "load_latency":
+		return r.LoadLatency, true
+	case "stability":
+		return r.Stability, true
+	case "score":
+		return r.Score, true
+	}
+	return nil, false
+}
+
+// loadRules parses a rules file.
+func loadRules(path string) ([]ruleStmt, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseRules(string(content))
+}
+
+func parseRules(src string) ([]ruleStmt, error) {
+	var stmts []ruleStmt
+	for i, line := range strings.Split(src, "\n") {
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		st := ruleStmt{line: i + 1, action: strings.ToLower(words[0])}
+		switch st.action {
+		case "drop", "keep", "keep-previous":
+			if len(words) < 2 || words[1] != "if" {
+				return nil, fmt.Errorf("rules line %d: expected '%s if <condition>'", st.line, st.action)
+			}
+			p := &ruleParser{toks: words[2:]}
+			cond, err := p.parseOr()
+			if err == nil && p.pos < len(p.toks) {
+				err = fmt.Errorf("unexpected %q", p.toks[p.pos])
+			}
+			if err != nil {
+				return nil, fmt.Errorf("rules line %d: %v", st.line, err)
+			}
+			st.cond = cond
+		case "rank":
+			if len(words) < 3 || words[1] != "by" {
+				return nil, fmt.Errorf("rules line %d: expected 'rank by <field> [asc|desc]'", st.line)
+			}
+			st.field = words[2]
+			if _, ok := resultField(NodeResult{}, st.field); !ok {
+				return nil, fmt.Errorf("rules line %d: unknown field %q", st.line, st.field)
+			}
+			st.asc = len(words) > 3 && words[3] == "asc"
+		default:
+			return nil, fmt.Errorf("rules line %d: unknown action %q", st.line, words[0])
+		}
+		stmts = append(stmts, st)
+	}
+	return stmts, nil
+}
+
+type ruleParser struct {
+	toks []string
+	pos  int
+}
+
+func (p *ruleParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *ruleParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *ruleParser) parseOr() (ruleCond, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = ruleOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *ruleParser) parseAnd() (ruleCond, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = ruleAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *ruleParser) parseTerm() (ruleCond, error) {
+	if p.peek() == "not" {
+		p.next()
+		c, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		return ruleNot{c}, nil
+	}
+	field := p.next()
+	cmp := ruleCmp{field: field}
+	if strings.HasPrefix(field, "best.") {
+		cmp.best = true
+		cmp.field = strings.TrimPrefix(field, "best.")
+	}
+	if _, ok := resultField(NodeResult{}, cmp.field); !ok {
+		return nil, fmt.Errorf("unknown field %q", field)
+	}
+	op := p.next()
+	if op == "not" && p.peek() == "in" {
+		p.next()
+		op = "not in"
+	}
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "in", "not in":
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op)
+	}
+	cmp.op = op
+	if p.peek() == "" {
+		return nil, fmt.Errorf("missing value after %q", op)
+	}
+	cmp.value = p.next()
+	return cmp, nil
+}
+
+// applyConfiguredRules applies cfg.Rules to the final results.
+func applyConfiguredRules(cfg Config, results []NodeResult) []NodeResult {
+	if len(cfg.Rules) == 0 {
+		return results
+	}
+	var prev *NodeResult
+	if cfg.HistoryFile != "" {
+		history, _ := loadHistory(cfg.HistoryFile)
+		if rec := previousBestRecord(history); rec != nil {
+			prev = &NodeResult{IP: rec.IP, Colo: rec.Colo, TCPLatency: rec.TCPLatency, DownloadSpeed: rec.Speed, Score: rec.Score}
+		}
+	}
+	return applyRules(cfg.Rules, results, prev)
+}
+
+// applyRules runs the statements over results in order; prevBest serves keep-previous.
+func applyRules(stmts []ruleStmt, results []NodeResult, prevBest *NodeResult) []NodeResult {
+	for _, st := range stmts {
+		var best NodeResult
+		if len(results) > 0 {
+			best = results[0]
+		}
+		switch st.action {
+		case "drop", "keep":
+			kept := results[:0:0]
+			for _, r := range results {
+				if st.cond.eval(r, best) == (st.action == "keep") {
+					kept = append(kept, r)
+				}
+			}
+			results = kept
+		case "rank":
+			sort.SliceStable(results, func(i, j int) bool {
+				a, _ := resultField(results[i], st.field)
+				b, _ := resultField(results[j], st.field)
+				af, _ := a.(float64)
+				bf, _ := b.(float64)
+				if st.asc {
+					return af < bf
+				}
+				return af > bf
+			})
+		case "keep-previous":
+			if prevBest == nil || len(results) == 0 || !st.cond.eval(best, best) {
+				continue
+			}
+			reordered := []NodeResult{*prevBest}
+			for _, r := range results {
+				if r.IP != prevBest.IP {
+					reordered = append(reordered, r)
+				} else {
+					reordered[0] = r // fresh measurement beats the history copy
+				}
+			}
+			results = reordered
+		}
+	}
+	return results
+}
@@ -0,0 +1,369 @@
+package cfst
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Runner runs the whole pipeline, reporting progress through its optional callbacks.
+type Runner struct {
+	Config Config
+
+	OnStatus    func(msg string)             // phase changes and notes
+	OnScan      func(done, total, valid int) // ping scan progress
+	OnValid     func(NodeResult)             // each IP that answered the ping scan
+	OnFilter    func(done, total int)        // candidate filter progress
+	OnPhase     func(PhaseTiming)            // each finished phase
+	OnResult    func(NodeResult)             // each completed download test, rate-limited ones included
+	OnProgress  func(LiveProgress)           // live progress of the running downloads
+	OnTop       func([]NodeResult)           // the best DownloadNum results so far, best first, after each result that changes them
+	OnFastExit  func()                       // the download test stopped early at the speed threshold
+	OnLongevity func(NodeResult)             // each finished longevity test
+
+	// Scorer, if set, replaces the built-in score of the final results, higher being better.
+	Scorer func(NodeResult) float64
+
+	// Set by the CLI and web mode around their runs.
+	settings       *runSettings                                         // used instead of settings built from Config
+	stats          *DownloadStats                                       // the run's download counters
+	timer          *phaseTimer                                          // the run's phase timer
+	downloadCtx    func(context.Context) (context.Context, func() bool) // lets the user end the download test early
+	beforeDownload func(cfg Config, candidates int)                     // cfg as the download test runs with it
+	reranked       func(results []NodeResult)                           // the results after verify or post-processing
+}
+
+// NewRunner returns a Runner for cfg, usually DefaultConfig() adjusted.
+func NewRunner(cfg Config) *Runner {
+	return &Runner{Config: cfg}
+}
+
+// newFrontendRunner returns a Runner for the CLI or web mode, whose settings Main already applied.
+func newFrontendRunner(cfg Config) *Runner {
+	cfg.Preset, cfg.LowMem = "", false
+	return &Runner{Config: cfg, settings: processSettings, stats: &DownloadStats{}, timer: newPhaseTimer()}
+}
+
+func (r *Runner) status(format string, args ...interface{}) {
+	if r.OnStatus != nil {
+		r.OnStatus(fmt.Sprintf(format, args...))
+	}
+}
+
+func (r *Runner) phase(p PhaseTiming) {
+	if r.OnPhase != nil {
+		r.OnPhase(p)
+	}
+}
+
+// configure returns ctx carrying the run's settings and a func closing their pooled connections.
+func (r *Runner) configure(ctx context.Context, cfg Config) (context.Context, func(), error) {
+	if r.settings != nil {
+		return withRunSettings(ctx, r.settings), func() {}, nil
+	}
+	rs, notes, err := settingsFor(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, note := range notes {
+		r.status("%s", note)
+	}
+	return withRunSettings(ctx, rs), rs.transports.closeAll, nil
+}
+
+// Run runs the pipeline and returns the results, best first, with the run summary.
+func (r *Runner) Run(ctx context.Context) ([]NodeResult, RunSummary, error) {
+	cfg := r.Config
+	if cfg.Preset != "" {
+		if err := presetConfig(cfg.Preset, &cfg, nil); err != nil {
+			return nil, RunSummary{}, err
+		}
+	}
+	if cfg.LowMem {
+		lowMemConfig(&cfg, nil)
+	}
+	if err := checkTestURL(cfg.URL); err != nil {
+		return nil, RunSummary{}, err
+	}
+	ctx, release, err := r.configure(ctx, cfg)
+	if err != nil {
+		return nil, RunSummary{}, err
+	}
+	defer release()
+	if cfg.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Deadline)
+		defer cancel()
+	}
+	timer, stats := r.timer, r.stats
+	if timer == nil {
+		timer = newPhaseTimer()
+	}
+	if stats == nil {
+		stats = &DownloadStats{}
+	}
+
+	r.status("Generating IPs...")
+	ips, err := generateCandidates(ctx, cfg)
+	if err != nil {
+		r.status("%v", err)
+	}
+	r.phase(timer.mark("generate", len(ips)))
+
+	r.status("Ping scanning %d IPs (concurrency: %d)...", len(ips), cfg.ScanConcurrent)
+	spill, err := newNodeSpill(cfg.Spill)
+	if err != nil {
+		r.status("Spill file: %v", err)
+	}
+	defer spill.Close()
+	latHist := newLatencyHistogram(cfg.LatBuckets)
+	pins := newPinTracker(cfg.PinIPs)
+	ranges := newRangeTally(cfg.TelemetryURL != "")
+	onValid := func(n NodeResult) {
+		spill.write(n)
+		latHist.add(n.TCPLatency)
+		pins.observe(n)
+		ranges.observe(n)
+		if r.OnValid != nil {
+			r.OnValid(n)
+		}
+	}
+	validNodes, validCount := ScanPingBounded(ctx, ips, cfg.Port, cfg.ScanConcurrent, scanKeep(cfg), pingerFor(cfg), onValid, r.OnScan)
+	r.phase(timer.mark("ping", len(ips)))
+	if n := timer.portFailures(); n > 0 {
+		r.status("Scan throttled: %s", portExhaustionWarning(n))
+	}
+	if spill != nil {
+		r.status("All %d valid nodes written to %s", validCount, spill.Path())
+	}
+	summarize := func(coloNodes, results []NodeResult) RunSummary {
+		s := buildSummary(len(ips), validCount, latHist.snapshot(), coloNodes, stats, results, timer)
+		s.Partial = ctx.Err() != nil
+		return s
+	}
+	// scanOnly ends a run stopped before any download with the best ping results.
+	scanOnly := func(nodes []NodeResult) ([]NodeResult, RunSummary, error) {
+		results := latencyOnlyResults(cfg, nodes)
+		return results, summarize(nil, results), runError(ctx, ErrNoValidIPs)
+	}
+
+	if len(validNodes) == 0 {
+		return nil, summarize(nil, nil), runError(ctx, ErrNoValidIPs)
+	}
+	if cfg.MaxLatency > 0 {
+		if validNodes = underLatency(validNodes, cfg.MaxLatency); len(validNodes) == 0 {
+			return nil, summarize(nil, nil), fmt.Errorf("%w under the %gms latency limit", ErrNoValidIPs, cfg.MaxLatency)
+		}
+	}
+	if cfg.LatencyOnly {
+		results := latencyOnlyResults(cfg, validNodes)
+		return results, summarize(nil, results), nil
+	}
+	if ctx.Err() != nil {
+		return scanOnly(validNodes)
+	}
+	if cfg.CFColo != "" {
+		r.status("Keeping only IPs in %s...", cfg.CFColo)
+		validNodes = scanForColos(ctx, cfg, validNodes, func(more []string) []NodeResult {
+			nodes, n := ScanPingBounded(ctx, more, cfg.Port, cfg.ScanConcurrent, scanKeep(cfg), pingerFor(cfg), onValid, nil)
+			ips = append(ips, more...)
+			validCount += n
+			return underLatency(nodes, cfg.MaxLatency)
+		}, func(msg string) { r.status("%s", msg) })
+		r.phase(timer.mark("cfcolo", len(validNodes)))
+		if len(validNodes) == 0 {
+			return nil, summarize(nil, nil), runError(ctx, fmt.Errorf("%w in %s", ErrNoValidIPs, cfg.CFColo))
+		}
+		r.status("%d candidates in the allowed colos", len(validNodes))
+	}
+
+	if isCustomURL(cfg.URL) {
+		cfg.SkipLoadLatency = true
+		cfg.StopThreshold = 9999.0 // disable fast-exit
+		if cfg.FilterMode == "multi-colo" {
+			r.status("Multi-colo filtering is not supported in custom URL mode; falling back to the speed pre-filter.")
+			cfg.FilterMode = "speed"
+		}
+	}
+	candidates, coloNodes, filtered := r.filter(ctx, cfg, validNodes, stats)
+	r.phase(timer.mark(filterPhaseName(cfg.FilterMode), filtered))
+	if n := pins.count(); n > 0 {
+		candidates = pins.ensure(candidates, cfg.Port)
+		cfg.DownloadNum += n
+		r.status("Added %d pinned IP(s) to the download test", n)
+	}
+	if ctx.Err() != nil {
+		return scanOnly(validNodes)
+	}
+	if len(candidates) == 0 {
+		return nil, summarize(coloNodes, nil), fmt.Errorf("%w: no candidates selected for testing", ErrNoValidIPs)
+	}
+
+	if cfg.ProbeECH && cfg.ECHConfigList == nil {
+		if cfg.ECHConfigList, err = loadECHConfig(cfg.ECHConfig, cfg.ECHDomain); err != nil {
+			r.status("ECH probe disabled: %v", err)
+			cfg.ProbeECH = false
+		}
+	}
+	r.status("Download test of up to %d candidates (%ds, %d parallel)...", len(candidates), cfg.Duration, cfg.DLConc)
+	if r.beforeDownload != nil {
+		r.beforeDownload(cfg, len(candidates))
+	}
+	board := newLeaderboard(cfg.DownloadNum)
+	onResult := func(res NodeResult) {
+		if r.OnResult != nil {
+			r.OnResult(res)
+		}
+		if top, ok := board.add(res); ok && r.OnTop != nil {
+			r.OnTop(top)
+		}
+	}
+	dlCtx, stopDownloads := ctx, func() bool { return false }
+	if r.downloadCtx != nil {
+		dlCtx, stopDownloads = r.downloadCtx(ctx)
+	}
+	results := runParallelDownloadTest(dlCtx, candidates, cfg, stats, onResult, r.OnStatus, r.OnProgress, r.OnFastExit)
+	if stopDownloads() {
+		r.status("Download test ended early with %d result(s).", len(results))
+	}
+	r.phase(timer.mark("download", int(stats.Tested.Load())))
+	results = dropDisallowedColos(cfg, results)
+	if cfg.MinSpeed > 0 && len(results) < cfg.DownloadNum {
+		r.status("Only %d of %d tested IP(s) reached %g MB/s (-sl); lower -sl or raise -topn.",
+			len(results), stats.Tested.Load(), cfg.MinSpeed)
+	}
+	if len(results) == 0 {
+		if ctx.Err() != nil {
+			return scanOnly(candidates)
+		}
+		if n := stats.Interference.Load(); n > 0 {
+			r.status("%d of them showed signs of network interference (TCP connects, TLS or first byte fails); "+
+				"try another -sni, port or network.", n)
+		}
+		if n := timer.portFailures(); n > 0 {
+			r.status("%s", portExhaustionWarning(n))
+		}
+		return nil, summarize(coloNodes, nil), ErrAllRateLimited
+	}
+
+	if cfg.Expand > 0 {
+		r.status("Neighbor expansion around the top %d IPs...", cfg.Expand)
+		var scanned int
+		results, scanned = expandNeighbors(ctx, results, cfg, stats, onResult, r.OnStatus)
+		r.phase(timer.mark("expand", scanned))
+	}
+	results, egressChanged, note := checkEgress(cfg.EgressChange, results)
+	if note != "" {
+		r.status("%s", note)
+	}
+	if cfg.Verify > 0 {
+		r.status("Verifying the top %d IPs with %d more download pass(es)...", verifyTop, cfg.Verify)
+		results = verifyFinalists(ctx, results, cfg, cfg.Verify, stats, r.OnStatus)
+		r.phase(timer.mark("verify", min(verifyTop, len(results))*cfg.Verify))
+		r.rerank(results)
+	}
+	if cfg.Check443 {
+		if checked, open := check443(ctx, cfg, results); checked > 0 {
+			r.status("%s", check443Note(checked, open))
+		}
+	}
+	if cfg.Longevity > 0 {
+		r.status("Longevity test: holding a slow transfer to the top %d IPs for %s...",
+			min(cfg.LongevityN, len(results)), cfg.Longevity)
+		runLongevityTests(ctx, results, cfg, cfg.LongevityN, r.OnLongevity)
+		r.phase(timer.mark("longevity", min(cfg.LongevityN, len(results))))
+	}
+	if r.Scorer != nil {
+		rescore(results, r.Scorer)
+	}
+	if cfg.PluginFilter != "" {
+		if results, err = pluginFilterResults(ctx, cfg, results); err != nil {
+			r.status("%v", err)
+		}
+	}
+	if len(cfg.Rules) > 0 {
+		results = applyConfiguredRules(cfg, results)
+		r.status("Rules applied: %d result(s) kept", len(results))
+	}
+	if len(cfg.Rules) > 0 || cfg.PluginFilter != "" {
+		r.rerank(results)
+	}
+	var held []NodeResult
+	if results, held = withholdNeverSelect(cfg.NeverSelect, results); len(held) > 0 {
+		r.status("%d result(s) on the never-select list withheld: %s", len(held), heldIPs(held))
+	}
+
+	summary := summarize(coloNodes, results)
+	summary.Detours = coloDetours(ctx, cfg, summary.Colos)
+	summary.EgressMoved = egressChanged
+	summary.ranges = ranges
+	ranges.scan(ips)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && cfg.Deadline > 0 {
+		r.status("-timeout %v reached; later stages were cut short and the results are partial.", cfg.Deadline)
+	}
+	return results, summary, nil
+}
+
+func (r *Runner) rerank(results []NodeResult) {
+	if r.reranked != nil {
+		r.reranked(results)
+	}
+}
+
+// filter narrows the scan results down to the download candidates by cfg.FilterMode.
+func (r *Runner) filter(ctx context.Context, cfg Config, nodes []NodeResult, stats *DownloadStats) (candidates, coloNodes []NodeResult, items int) {
+	switch cfg.FilterMode {
+	case "speed":
+		pool := nodes[:min(len(nodes), cfg.TopN*2)]
+		quickCfg := cfg
+		quickCfg.DLConc = max(cfg.DLConc*3, 6)
+		r.status("Speed pre-filter: %ds quick test on %d candidates (%d workers)...", cfg.QuickDuration, len(pool), quickCfg.DLConc)
+		candidates = runQuickFilter(ctx, pool, quickCfg, cfg.TopN, stats, r.OnFilter)
+		r.status("%d candidates selected for the full test", len(candidates))
+		return candidates, nil, len(pool)
+
+	case "multi-colo":
+		nodes = nodes[:min(len(nodes), cfg.TopN)]
+		r.status("Detecting the colo of %d candidates...", len(nodes))
+		_, groups := detectColoBatch(ctx, append([]NodeResult(nil), nodes...), cfg.Port, cfg.ScanConcurrent, r.OnFilter)
+		if len(groups) == 0 {
+			r.status("No colo detected; testing all candidates")
+			return nodes, nil, len(nodes)
+		}
+		colos := make([]string, 0, len(groups))
+		for colo := range groups {
+			colos = append(colos, colo)
+		}
+		sort.Slice(colos, func(i, j int) bool { return avgLatency(groups[colos[i]]) < avgLatency(groups[colos[j]]) })
+		avgs := make([]string, len(colos))
+		for i, colo := range colos {
+			avgs[i] = fmt.Sprintf("%s %.1fms (%d)", colo, avgLatency(groups[colo]), len(groups[colo]))
+		}
+		r.status("Colo average latencies: %s", strings.Join(avgs, ", "))
+		top := colos[:min(len(colos), 3)]
+		for _, colo := range top {
+			candidates = append(candidates, groups[colo]...)
+		}
+		r.status("%d candidates selected from the top %d colos", len(candidates), len(top))
+		return candidates, flattenColoGroups(groups), len(nodes)
+
+	default:
+		nodes = nodes[:min(len(nodes), cfg.TopN)]
+		r.status("Skipping candidate filtering, testing the top %d candidates directly", len(nodes))
+		return nodes, nil, len(nodes)
+	}
+}
+
+// DetectColo returns the nodes grouped by the colo their trace reports.
+func DetectColo(ctx context.Context, nodes []NodeResult, port, concurrency int) map[string][]NodeResult {
+	_, groups := detectColoBatch(ctx, append([]NodeResult(nil), nodes...), port, concurrency, nil)
+	return groups
+}
+
+// RunDownloadTest download-tests candidates until cfg.DownloadNum results are in, best first.
+func RunDownloadTest(ctx context.Context, candidates []NodeResult, cfg Config, onResult func(NodeResult), onProgress func(LiveProgress)) []NodeResult {
+	var stats DownloadStats
+	return runParallelDownloadTest(ctx, candidates, cfg, &stats, onResult, nil, onProgress, nil)
+}
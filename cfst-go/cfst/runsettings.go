@@ -0,0 +1,78 @@
+package cfst
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+)
+
+// The dial and request settings belong to a run and travel on its context.
+
+// runSettings are the dial and request settings of one run.
+type runSettings struct {
+	transport  transportSettings
+	sockets    socketSettings
+	target     string      // -target-override, dialed instead of every tested IP
+	nat64      net.IP      // the /96 IPv4 addresses are dialed through (nil = off)
+	tls        *tls.Config // shared by the pinned transports; holds the session cache
+	transports *transportPool
+	resolve    []resolveEntry
+	resolved   *http.Transport // carries the requests for -resolve hosts
+	redirects  redirectPolicy
+	userAgents *userAgentPool
+	offline    bool // -offline-sources
+}
+
+// newRunSettings returns the settings before any configuration.
+func newRunSettings() *runSettings {
+	rs := &runSettings{
+		transport:  defaultTransportSettings,
+		sockets:    socketSettings{noDelay: true},
+		tls:        &tls.Config{InsecureSkipVerify: true},
+		transports: newTransportPool(),
+		redirects:  redirectPolicy{mode: RedirectFollow, maxHops: 5},
+		userAgents: &userAgentPool{agents: []string{defaultUserAgent}},
+	}
+	rs.resolved = rs.resolvedTransport()
+	return rs
+}
+
+// processSettings are the settings of everything not run by a Runner.
+var processSettings = newRunSettings()
+
+// settingsFor builds the settings of a run under cfg, with configureSockets' notes.
+func settingsFor(cfg Config) (rs *runSettings, notes []string, err error) {
+	rs = newRunSettings()
+	rs.offline = cfg.OfflineSources
+	if err := rs.configureUserAgents(cfg); err != nil {
+		return nil, nil, err
+	}
+	rs.configureTransports(cfg)
+	if err := rs.configureResolve(cfg); err != nil {
+		return nil, nil, err
+	}
+	if err := rs.configureNAT64(cfg); err != nil {
+		return nil, nil, err
+	}
+	notes = rs.configureSockets(cfg)
+	if err := rs.configureRedirects(cfg); err != nil {
+		return nil, nil, err
+	}
+	return rs, notes, nil
+}
+
+type runSettingsKey struct{}
+
+// withRunSettings returns ctx carrying rs for everything run under it.
+func withRunSettings(ctx context.Context, rs *runSettings) context.Context {
+	return context.WithValue(ctx, runSettingsKey{}, rs)
+}
+
+// settingsOf returns the settings of ctx's run, or processSettings outside a Runner.
+func settingsOf(ctx context.Context) *runSettings {
+	if rs, ok := ctx.Value(runSettingsKey{}).(*runSettings); ok {
+		return rs
+	}
+	return processSettings
+}
@@ -0,0 +1,105 @@
+package cfst
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Scan runs the whole pipeline with DefaultConfig() adjusted by opts, as Runner.Run does.
+func Scan(ctx context.Context, opts ...Option) ([]NodeResult, RunSummary, error) {
+	r := NewRunner(DefaultConfig())
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, RunSummary{}, err
+		}
+	}
+	return r.Run(ctx)
+}
+
+// Option adjusts the Runner of a Scan.
+type Option func(*Runner) error
+
+// WithConfig starts from cfg instead of DefaultConfig().
+func WithConfig(cfg Config) Option {
+	return func(r *Runner) error {
+		r.Config = cfg
+		return nil
+	}
+}
+
+// WithRanges samples the IPs from these CIDRs or IPs instead of the embedded ranges.
+func WithRanges(ranges ...string) Option {
+	return func(r *Runner) error {
+		var parsed []string
+		for _, s := range ranges {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			if _, _, err := net.ParseCIDR(s); err != nil && net.ParseIP(s) == nil {
+				return fmt.Errorf("invalid range %q", s)
+			}
+			parsed = append(parsed, s)
+		}
+		if len(parsed) == 0 {
+			return fmt.Errorf("no ranges given")
+		}
+		r.Config.Source = IPSourceFunc(func(ctx context.Context, max int) ([]string, error) {
+			// Unique is read at run time, so options may come in any order.
+			return RangeSource{Ranges: parsed, Unique: r.Config.Unique}.IPs(ctx, max)
+		})
+		return nil
+	}
+}
+
+// WithColoFilter keeps only the IPs in these colos, as -cfcolo does.
+func WithColoFilter(colos ...string) Option {
+	return func(r *Runner) error {
+		r.Config.CFColo = strings.Join(colos, ",")
+		return nil
+	}
+}
+
+// Progress is one report of a Scan; Phase is status, scan, filter, download, result or top.
+type Progress struct {
+	Phase   string
+	Message string
+	Done    int
+	Total   int
+	Valid   int
+	Live    *LiveProgress
+	Result  *NodeResult
+	Top     []NodeResult
+}
+
+// WithProgress sends the Runner's progress callbacks to fn as Progress values.
+func WithProgress(fn func(Progress)) Option {
+	return func(r *Runner) error {
+		r.OnStatus = func(msg string) { fn(Progress{Phase: "status", Message: msg}) }
+		r.OnScan = func(done, total, valid int) { fn(Progress{Phase: "scan", Done: done, Total: total, Valid: valid}) }
+		r.OnFilter = func(done, total int) { fn(Progress{Phase: "filter", Done: done, Total: total}) }
+		r.OnProgress = func(p LiveProgress) { fn(Progress{Phase: "download", Live: &p}) }
+		r.OnResult = func(res NodeResult) { fn(Progress{Phase: "result", Result: &res}) }
+		r.OnTop = func(top []NodeResult) { fn(Progress{Phase: "top", Top: top}) }
+		return nil
+	}
+}
+
+// WithScorer orders the results by score(result), higher being better.
+func WithScorer(score func(NodeResult) float64) Option {
+	return func(r *Runner) error {
+		r.Scorer = score
+		return nil
+	}
+}
+
+// rescore sets each result's Score with score and re-sorts the results.
+func rescore(results []NodeResult, score func(NodeResult) float64) {
+	for i := range results {
+		results[i].Score = score(results[i])
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+}
@@ -0,0 +1,102 @@
+package cfst
+
+import (
+	"container/heap"
+	"encoding/json"
+	"os"
+	"sort"
+)
+
+// scanRank is the latency the scan ranks n by, plus jitterWeight ms per ms of jitter.
+func scanRank(n NodeResult, jitterWeight float64) float64 {
+	return n.TCPLatency + jitterWeight*n.Jitter
+}
+
+// latencyHeap is a max-heap on scanRank: the root is the worst node kept.
+type latencyHeap struct {
+	nodes        []NodeResult
+	jitterWeight float64
+}
+
+func (h *latencyHeap) Len() int { return len(h.nodes) }
+func (h *latencyHeap) Less(i, j int) bool {
+	return scanRank(h.nodes[i], h.jitterWeight) > scanRank(h.nodes[j], h.jitterWeight)
+}
+func (h *latencyHeap) Swap(i, j int)      { h.nodes[i], h.nodes[j] = h.nodes[j], h.nodes[i] }
+func (h *latencyHeap) Push(x interface{}) { h.nodes = append(h.nodes, x.(NodeResult)) }
+func (h *latencyHeap) Pop() interface{} {
+	n := h.nodes[len(h.nodes)-1]
+	h.nodes = h.nodes[:len(h.nodes)-1]
+	return n
+}
+
+// topNodes keeps the k best-ranked nodes offered to it (all of them when k <= 0).
+type topNodes struct {
+	k     int
+	nodes latencyHeap
+}
+
+func (t *topNodes) offer(n NodeResult) {
+	switch {
+	case t.k <= 0 || t.nodes.Len() < t.k:
+		heap.Push(&t.nodes, n)
+	case scanRank(n, t.nodes.jitterWeight) < scanRank(t.nodes.nodes[0], t.nodes.jitterWeight):
+		t.nodes.nodes[0] = n
+		heap.Fix(&t.nodes, 0)
+	}
+}
+
+// sorted returns the kept nodes by ascending scanRank.
+func (t *topNodes) sorted() []NodeResult {
+	out, w := t.nodes.nodes, t.nodes.jitterWeight
+	sort.Slice(out, func(i, j int) bool { return scanRank(out[i], w) < scanRank(out[j], w) })
+	return out
+}
+
+// scanKeep is how many scan results the pipeline can use; -mem-topk overrides it.
+func scanKeep(cfg Config) int {
+	if cfg.MemTopK > 0 {
+		return cfg.MemTopK
+	}
+	if cfg.TopN <= 0 {
+		return 0
+	}
+	return cfg.TopN * 2
+}
+
+// nodeSpill writes every valid scan result to a JSON-lines temp file; nil is a no-op.
+type nodeSpill struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+func newNodeSpill(enabled bool) (*nodeSpill, error) {
+	if !enabled {
+		return nil, nil
+	}
+	f, err := os.CreateTemp("", "cfst-scan-*.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	return &nodeSpill{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *nodeSpill) write(n NodeResult) {
+	if s != nil {
+		s.enc.Encode(n)
+	}
+}
+
+func (s *nodeSpill) Path() string {
+	if s == nil {
+		return ""
+	}
+	return s.f.Name()
+}
+
+func (s *nodeSpill) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.f.Close()
+}
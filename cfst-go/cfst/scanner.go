@@ -0,0 +1,1063 @@
+package cfst
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+type Config struct {
+	IPFile          string
+	Port            int
+	MaxScan         int
+	TopN            int
+	DLConc          int
+	DownloadNum     int
+	Duration        int
+	StopThreshold   float64
+	Unique          bool
+	Output          string
+	ClashTemplate   string // one proxy's YAML, rendered per result by -format clash
+	Format          string // result file format: "csv", "json" or "clash" ("" = by the Output extension)
+	Raw             bool   // CSV: full-precision floats plus raw byte and µs counters
+	JSONL           bool   // CLI: stream each completed test to stdout as a JSON line, the rest to stderr
+	LiveTop         bool   // CLI: redraw the top results in score order as they come in (terminals only)
+	ScanConcurrent  int
+	WebPort         string
+	WebMode         bool
+	Silent          bool // web: log only errors to stdout
+	URL             string
+	Skip429         bool
+	QuickDuration   int
+	SkipLoadLatency bool // auto-set for custom URL mode
+	FilterMode      string
+	SNI             string
+	UserAgent       string
+	UAFile          string
+	UARotate        bool
+	DLInterval      time.Duration // pause between consecutive download tests per worker
+	DLJitter        time.Duration // random ± spread applied to DLInterval
+	OwnZone         string        // host[/path] of a test file on the user's own CF zone
+	CachePrime      bool          // fetch the URL once per IP before timing (custom URL mode)
+	Streams         int           // concurrent download streams per IP
+	HTTP2           bool          // multiplex Streams over a single HTTP/2 connection
+	ProbeResume     bool          // measure TLS session resumption per tested IP
+	ProbeECH        bool          // attempt an ECH handshake per tested IP
+	ECHDomain       string        // inner SNI and HTTPS record used for the ECH probe
+	ECHConfig       string        // base64 ECHConfigList overriding the DNS lookup
+	ECHConfigList   []byte        // resolved at run start from ECHConfig/ECHDomain
+	WSURL           string        // ws(s):// echo endpoint probed through each tested IP
+	GRPCURL         string        // gRPC endpoint probed with a long-lived HTTP/2 stream
+	GRPCHold        time.Duration // how long the gRPC probe keeps its stream open
+	Verify          int           // extra download passes over the top results, averaged in (0 = off)
+	Longevity       time.Duration // keep a slow transfer open this long to detect stalls (0 = off)
+	LongevityN      int           // number of top results given the longevity test
+	HistoryFile     string        // JSON-lines file every run's measurements are appended to
+	DBFile          string        // SQLite database every run is appended to (via the sqlite3 shell)
+	AlertDrop       float64       // fleet median drop vs history baseline that raises an alert (0 = off)
+	GrafanaURL      string        // Grafana base URL for run annotations
+	GrafanaToken    string        // Grafana API token (CFST_GRAFANA_TOKEN)
+	GrafanaEvents   string        // comma list of "complete", "change"
+	PluginSource    string        // ip-source exec plugin command
+	PluginFilter    string        // result-filter exec plugin command
+	PluginExporter  string        // exporter exec plugin command
+	IPURL           string        // download the IP/CIDR list from this URL
+	FeedURL         string        // signed community range feed sampled alongside the local ranges
+	FeedKey         string        // base64 ed25519 public key the feed must be signed with
+	FeedRegion      string        // comma list of feed regions to use ("" = all)
+	FeedISP         string        // comma list of feed ISPs to use ("" = all)
+	FeedTTL         time.Duration // re-fetch the feed once the cached copy is older
+	FeedCache       string        // file the verified feed is cached in
+	AllIP           bool          // enumerate every host of the ranges instead of sampling
+	HistorySeed     int           // also re-test the top N IPs from HistoryFile
+	Strategy        string        // IP sampling: "uniform" or "coarse-fine"
+	Source          IPSource      // overrides the flag-built IP source when set
+	ProbeDPI        bool          // run the TCP/TLS/first-byte interference probe
+	ProbeCert       bool          // record and classify the leaf certificate of each tested IP
+	CertIssuers     string        // comma list of issuer organizations -cert-check expects
+	TraceFirst      bool          // one trace request per candidate for colo + blocked check before downloading
+	TraceFields     bool          // keep the egress IP, protocol, TLS version and warp status of each trace
+	EgressChange    string        // results measured from a non-prevailing egress: "mark", "drop" or "off"
+	CacheFile       string        // result cache file for CacheTTL
+	CacheTTL        time.Duration // reuse measurements younger than this (0 = off)
+	Expand          int           // scan the /24 around the top N results (0 = off)
+	ExpandTest      int           // neighbors to download-test per expansion
+	WebTokensFile   string        // web mode "token namespace" file; enables per-user namespaces
+	Namespace       string        // web namespace of the current request
+	AuditLog        string        // web mode append-only audit log (JSON lines)
+	WebJobs         int           // web jobs allowed to run at once; the rest queue
+	IdleTimeout     time.Duration // web mode: release caches after this long without jobs (0 = off)
+	IdleExit        bool          // web mode: exit instead of staying up once IdleTimeout passes
+	MemTopK         int           // keep only this many lowest-latency scan results in memory (0 = TopN*2)
+	Spill           bool          // write every valid scan result to a JSON-lines temp file
+	LowMem          bool          // clamp concurrency, buffers and optional state for small devices
+	Preset          string        // named settings bundle applied at startup, see presets
+	LatencyOnly     bool          // stop after the ping scan: no colo or download test
+	CPULimit        string        // "50%" or a CPU count: GOMAXPROCS and scan concurrency share ("" = all)
+	LatBuckets      []float64     // latency histogram bucket bounds in ms (nil = defaults)
+	Geo             string        // "lat,lon", country code or "off"; empty = country from the trace
+	TLSPing         bool          // rank by TCP+TLS handshake time instead of TCP connect time
+	PingTimeout     time.Duration // bound on one scan ping (0 = 1.5s); the quick preset tightens it
+	Redirect        string        // redirect policy for pinned requests: "follow" or "error"
+	MaxRedirects    int           // hop limit for Redirect "follow"
+	Resolve         string        // comma list of host:ip or host:port:ip; those hosts skip the tested IP
+	DialKeepAlive   time.Duration // TCP keep-alive of pinned connections
+	MaxIdlePerHost  int           // idle connections kept per tested IP
+	IdleConnTTL     time.Duration // how long an idle pinned connection is kept
+	TLSSessions     int           // shared TLS session cache entries (0 = off)
+	TargetOverride  string        // host:port dialed instead of every tested IP (testing)
+	NAT64           string        // "auto" or the /96 prefix IPv4 addresses are dialed through on IPv6-only networks
+	NoDelay         bool          // TCP_NODELAY on measurement connections (Go's default)
+	TCPUserTimeout  time.Duration // drop a connection whose data stays unacknowledged this long (0 = OS default)
+	FastOpen        bool          // TCP Fast Open on connects where the OS supports it
+	MinSpeed        float64       // MB/s; slower download results are discarded and testing goes on (0 = off)
+	JitterWeight    float64       // ms of latency per ms of jitter when ranking scan results (0 = latency only)
+	Pings           int           // TCP pings per IP in the scan; loss rate and jitter come from these
+	MaxLatency      float64       // ms; slower scan results never reach colo detection or download (0 = off)
+	CFColo          string        // comma list of colos the results are restricted to ("" = any)
+	PinIPs          []string      // always scanned and download-tested, e.g. the IP in production
+	PinFile         string        // file of IPs added to PinIPs at startup
+	NeverSelect     ipMatcher     // IPs/subnets measured but withheld from the final results
+	NeverSelectFile string        // file of IPs/subnets added to NeverSelect at startup
+	Proxy           string        // local proxy the download test goes through, e.g. socks5://127.0.0.1:10808 ("" = direct)
+	ProxySwitch     string        // URL or command pointing the proxy's outbound at {ip}:{port}
+	BestOut         string        // write the best result (IP, or ip:port off 443) to this file
+	Check443        bool          // check 443 on results from another port; port-less outputs keep those that answer
+	BindOut         string        // write the top results as BIND zone records to this file
+	BindName        string        // owner name of those records
+	BindTTL         int           // their TTL in seconds
+	BindTop         int           // number of results written (0 = all usable)
+	DnsmasqOut      string        // write dnsmasq address= lines for RewriteDomains to this file
+	AdGuardOut      string        // write AdGuard Home rewrites (JSON) for RewriteDomains to this file
+	RewriteDomains  string        // comma list of domains pointed at the top results
+	RewriteTop      int           // results each domain is pointed at
+	HostsFile       string        // hosts file HostsDomains are written to
+	HostsDomains    string        // comma list of domains pointed at the best result in HostsFile
+	DDNSZone        string        // Cloudflare zone (name or ID) whose DDNSRecord is pointed at the best result
+	DDNSRecord      string        // comma list of record names in DDNSZone
+	DDNSToken       string        // Cloudflare API token (CFST_DDNS_TOKEN)
+	SingBoxTemplate string        // sing-box config whose outbounds are pointed at the best results
+	SingBoxOut      string        // where the patched sing-box config is written
+	SingBoxTags     string        // comma list of outbound tags patched ("" = every outbound with a server)
+	SingBoxReload   string        // hup:<pid or pid file>, or the Clash API URL, to reload sing-box
+	SingBoxSecret   string        // Clash API secret (CFST_SINGBOX_SECRET)
+	XrayConfig      string        // Xray/V2Ray config whose XrayTag outbounds are pointed at the best result
+	XrayTag         string        // comma list of outbound tags in XrayConfig
+	XrayRestart     string        // systemd unit restarted after XrayConfig changes
+	TGToken         string        // Telegram bot token; with TGChat, each run's top results are sent there
+	TGChat          string        // Telegram chat ID or @channel
+	DiscordWebhook  string        // Discord incoming-webhook URL run reports are posted to
+	SlackWebhook    string        // Slack incoming-webhook URL run reports are posted to
+	ChatEvents      string        // comma list of events posted to them: complete, change, blocked
+	Webhook         string        // URL each run's JSON result document is POSTed to
+	WebhookSecret   string        // HMAC-SHA256 key signing those posts (CFST_WEBHOOK_SECRET)
+	WebhookEveryRun bool          // daemon: post to Webhook after every run, not only when the best IP changes
+	Deadline        time.Duration // give up on whatever stage is running after this long (0 = none)
+	TelemetryURL    string        // opt-in: POST each run's noised aggregate report here
+	TelemetryEps    float64       // differential-privacy ε of that report
+	OfflineSources  bool          // no network traffic besides the probes (no range lists, feeds, lookups, uploads)
+	Daemon          bool          // CLI: keep running, re-test every Interval and publish only best-IP changes
+	Interval        time.Duration // time between daemon runs
+	DaemonState     string        // file the daemon keeps the current best in ("" = memory only)
+	MetricsListen   string        // daemon: address /metrics is served on ("" = off)
+	RulesFile       string        // post-processing rules file
+	Rules           []ruleStmt    // parsed from RulesFile at startup
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Port:           443,
+		MaxScan:        3000,
+		TopN:           100,
+		DLConc:         1,
+		DownloadNum:    20,
+		Duration:       20,
+		StopThreshold:  30.0,
+		Unique:         false,
+		Output:         "result_colo.csv",
+		ScanConcurrent: 200,
+		WebPort:        "9876",
+		WebJobs:        1,
+		Redirect:       RedirectFollow,
+		MaxRedirects:   5,
+		DialKeepAlive:  15 * time.Second,
+		MaxIdlePerHost: 4,
+		IdleConnTTL:    30 * time.Second,
+		TLSSessions:    256,
+		NoDelay:        true,
+		PingTimeout:    defaultPingTimeout,
+		URL:            "https://speed.cloudflare.com/__down?bytes=500000000",
+		Skip429:        true,
+		QuickDuration:  3,
+		FilterMode:     "speed",
+		DLInterval:     500 * time.Millisecond,
+		Streams:        1,
+		ECHDomain:      defaultECHDomain,
+		GRPCHold:       15 * time.Second,
+		LongevityN:     5,
+		CertIssuers:    defaultCertIssuers,
+		EgressChange:   EgressMark,
+		BindName:       "cf",
+		BindTTL:        300,
+		BindTop:        5,
+		RewriteTop:     1,
+		TelemetryEps:   1.0,
+		Pings:          5,
+		AlertDrop:      0.5,
+		GrafanaToken:   os.Getenv("CFST_GRAFANA_TOKEN"),
+		DDNSToken:      os.Getenv("CFST_DDNS_TOKEN"),
+		SingBoxSecret:  os.Getenv("CFST_SINGBOX_SECRET"),
+		WebhookSecret:  os.Getenv("CFST_WEBHOOK_SECRET"),
+		GrafanaEvents:  "complete,change",
+		ChatEvents:     "complete,change,blocked",
+		Strategy:       "uniform",
+		CacheFile:      defaultResultCacheFile,
+		FeedTTL:        6 * time.Hour,
+		FeedCache:      defaultFeedCacheFile,
+		ExpandTest:     5,
+		Interval:       6 * time.Hour,
+		DaemonState:    defaultDaemonStateFile,
+		HostsFile:      defaultHostsFile(),
+	}
+}
+
+// parseInterval parses a pacing spec such as "2s", "2s±1s" or "2s+-1s".
+func parseInterval(spec string) (base, jitter time.Duration, err error) {
+	spec = strings.ReplaceAll(strings.TrimSpace(spec), "+-", "±")
+	basePart, jitterPart, hasJitter := strings.Cut(spec, "±")
+	if base, err = time.ParseDuration(basePart); err != nil {
+		return 0, 0, err
+	}
+	if hasJitter {
+		if jitter, err = time.ParseDuration(jitterPart); err != nil {
+			return 0, 0, err
+		}
+	}
+	if base < 0 || jitter < 0 {
+		return 0, 0, fmt.Errorf("negative interval %q", spec)
+	}
+	return base, jitter, nil
+}
+
+// pacingDelay returns base shifted by a uniform random offset in [-jitter, +jitter].
+func pacingDelay(base, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return base
+	}
+	d := base - jitter + time.Duration(rand.Int63n(int64(2*jitter)+1))
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func isCustomURL(urlStr string) bool {
+	return !strings.Contains(urlStr, "speed.cloudflare.com/__down")
+}
+
+// defaultOwnZonePath is used when -own-zone is given without a path.
+const defaultOwnZonePath = "/cfst-test.bin"
+
+// buildOwnZoneURL turns a zone (and optional path) into a download URL with a random query.
+func buildOwnZoneURL(zone string) (string, error) {
+	if !strings.Contains(zone, "://") {
+		zone = "https://" + zone
+	}
+	u, err := url.Parse(zone)
+	if err != nil {
+		return "", err
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("invalid zone %q", zone)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = defaultOwnZonePath
+	}
+	q := u.Query()
+	q.Set("cfst", strconv.FormatInt(rand.Int63(), 36))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// pingFunc measures one latency sample in ms (0 = failed).
+type pingFunc func(ctx context.Context, ip string, port int, timeout time.Duration) float64
+
+// defaultPings is the number of pings per IP when Config.Pings is unset.
+const defaultPings = 5
+
+// defaultPingTimeout bounds one ping when Config.PingTimeout is unset.
+const defaultPingTimeout = 1500 * time.Millisecond
+
+// pinger is the scan's latency probe with its timeout, pings per IP and jitter weight.
+type pinger struct {
+	ping         pingFunc
+	timeout      time.Duration
+	count        int
+	jitterWeight float64
+}
+
+// maxScanLoss is how many of n pings an IP may lose and still be valid.
+func maxScanLoss(n int) int {
+	return min(max(1, n/4), n-1)
+}
+
+// pingerFor returns the TCP or -tlsping probe of cfg.
+func pingerFor(cfg Config) pinger {
+	p := pinger{ping: TCPPing, timeout: cfg.PingTimeout, count: cfg.Pings, jitterWeight: cfg.JitterWeight}
+	if p.timeout <= 0 {
+		p.timeout = defaultPingTimeout
+	}
+	if cfg.TLSPing {
+		p.ping = func(ctx context.Context, ip string, port int, timeout time.Duration) float64 {
+			return TLSPing(ctx, ip, port, cfg.SNI, 2*timeout) // the handshake adds a round trip or two
+		}
+	}
+	return p
+}
+
+// ScanPing runs defaultPings TCP pings per IP and filters by packet loss.
+func ScanPing(ctx context.Context, ips []string, port int, concurrency int, progressCallback func(done, total, valid int)) []NodeResult {
+	nodes, _ := ScanPingBounded(ctx, ips, port, concurrency, 0, pinger{ping: TCPPing, timeout: defaultPingTimeout}, nil, progressCallback)
+	return nodes
+}
+
+// ScanPingBounded is ScanPing with p, keeping only the keep lowest-latency nodes (all when keep <= 0).
+func ScanPingBounded(ctx context.Context, ips []string, port int, concurrency int, keep int, p pinger, onValid func(NodeResult),
+	progressCallback func(done, total, valid int)) (nodes []NodeResult, valid int) {
+	best := topNodes{k: keep, nodes: latencyHeap{jitterWeight: p.jitterWeight}}
+	var mu sync.Mutex
+	var done, validCount atomic.Int32
+	total := len(ips)
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	throttle := newDialThrottle(concurrency)
+	var inflight atomic.Int32
+
+	for _, ip := range ips {
+		if !throttle.admit(ctx, &inflight) {
+			break
+		}
+		wg.Add(1)
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Done()
+			continue
+		}
+
+		inflight.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer inflight.Add(-1)
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			pingCount := p.count
+			if pingCount <= 0 {
+				pingCount = defaultPings
+			}
+			lats := make([]float64, 0, pingCount)
+			for i := 0; i < pingCount; i++ {
+				if ctx.Err() != nil {
+					return
+				}
+				lat := p.ping(ctx, ip, port, p.timeout)
+				if lat > 0 {
+					lats = append(lats, lat)
+				}
+				if i < pingCount-1 {
+					select {
+					case <-time.After(30 * time.Millisecond):
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+
+			d := done.Add(1)
+			if len(lats) >= pingCount-maxScanLoss(pingCount) {
+				var sum float64
+				for _, l := range lats {
+					sum += l
+				}
+				avgLat := sum / float64(len(lats))
+
+				jitter := 0.0
+				if len(lats) > 1 {
+					var variance float64
+					for _, l := range lats {
+						diff := l - avgLat
+						variance += diff * diff
+					}
+					jitter = math.Sqrt(variance / float64(len(lats)))
+				}
+
+				loss := float64(pingCount-len(lats)) / float64(pingCount)
+				node := NodeResult{
+					IP: ip, Port: port,
+					TCPLatency: avgLat, Jitter: jitter, PacketLoss: loss,
+				}
+				mu.Lock()
+				best.offer(node)
+				if onValid != nil {
+					onValid(node)
+				}
+				mu.Unlock()
+				validCount.Add(1)
+			}
+			if progressCallback != nil && (d%10 == 0 || d == int32(total)) {
+				progressCallback(int(d), total, int(validCount.Load()))
+			}
+		}(ip)
+	}
+	wg.Wait()
+	return best.sorted(), int(validCount.Load())
+}
+
+// meetsMinSpeed reports whether r may be kept under -sl; pinned IPs always are.
+func meetsMinSpeed(cfg Config, r NodeResult) bool {
+	return cfg.MinSpeed <= 0 || r.Pinned || r.DownloadSpeed >= cfg.MinSpeed
+}
+
+// underLatency returns the nodes no slower than maxMs; maxMs <= 0 keeps all.
+func underLatency(nodes []NodeResult, maxMs float64) []NodeResult {
+	if maxMs <= 0 {
+		return nodes
+	}
+	return slices.DeleteFunc(nodes, func(n NodeResult) bool { return n.TCPLatency > maxMs })
+}
+
+// avgLatency returns the average TCPLatency of a node slice.
+func avgLatency(nodes []NodeResult) float64 {
+	if len(nodes) == 0 {
+		return math.MaxFloat64
+	}
+	var sum float64
+	for _, n := range nodes {
+		sum += n.TCPLatency
+	}
+	return sum / float64(len(nodes))
+}
+
+// selectBestColo picks the Colo with the LOWEST average TCP latency.
+// This is the correct criterion — not node count.
+func selectBestColo(coloGroups map[string][]NodeResult) string {
+	const minNodes = 3
+	best := ""
+	bestLat := math.MaxFloat64
+
+	// First pass: colos with enough nodes for statistical confidence
+	for colo, nodes := range coloGroups {
+		if len(nodes) < minNodes {
+			continue
+		}
+		if avg := avgLatency(nodes); avg < bestLat {
+			bestLat = avg
+			best = colo
+		}
+	}
+	// Fallback: any colo
+	if best == "" {
+		for colo, nodes := range coloGroups {
+			if avg := avgLatency(nodes); avg < bestLat {
+				bestLat = avg
+				best = colo
+			}
+		}
+	}
+	return best
+}
+
+// detectColoBatch concurrently queries the Colo for each candidate.
+// Returns the best Colo (by lowest avg latency) and the full coloGroups map.
+func detectColoBatch(ctx context.Context, candidates []NodeResult, port int, concurrency int,
+	progressCallback func(done, total int)) (bestColo string, coloGroups map[string][]NodeResult) {
+
+	var wg sync.WaitGroup
+	var done atomic.Int32
+	total := len(candidates)
+	sem := make(chan struct{}, concurrency)
+
+	for i := range candidates {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Done()
+			continue
+		}
+		go func(idx int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				return
+			}
+			candidates[idx].Colo, _ = TraceProbe(ctx, candidates[idx].IP, port)
+			d := done.Add(1)
+			if progressCallback != nil && (d%20 == 0 || d == int32(total)) {
+				progressCallback(int(d), total)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	coloGroups = make(map[string][]NodeResult)
+	for _, c := range candidates {
+		if knownColo(c.Colo) {
+			coloGroups[c.Colo] = append(coloGroups[c.Colo], c)
+		}
+	}
+
+	bestColo = selectBestColo(coloGroups)
+	return bestColo, coloGroups
+}
+
+// DownloadStats accumulates download counters shared by the quick filter and the full test.
+type DownloadStats struct {
+	Tested       atomic.Int32
+	Blocked      atomic.Int32
+	Bytes        atomic.Int64
+	Interference atomic.Int32 // IPs flagged by the interference probe
+}
+
+// runQuickFilter runs short download tests against cfg.URL to rank candidates by speed.
+// Used as a pre-filter in custom URL mode instead of Colo detection.
+func runQuickFilter(ctx context.Context, candidates []NodeResult, cfg Config, topN int, stats *DownloadStats,
+	progressCallback func(done, total int)) []NodeResult {
+
+	numWorkers := cfg.DLConc
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	type quickResult struct {
+		idx   int
+		speed float64
+	}
+	results := make([]quickResult, len(candidates))
+	var doneCount atomic.Int32
+
+	sem := make(chan struct{}, numWorkers)
+	var wg sync.WaitGroup
+
+	for i, cand := range candidates {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(idx int, ip string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res := SingleStreamTest(ctx, ip, cfg.Port, cfg.QuickDuration, cfg.URL, cfg.SNI, nil)
+			if stats != nil {
+				stats.Bytes.Add(res.Bytes)
+			}
+			results[idx] = quickResult{idx: idx, speed: res.Speed}
+			d := doneCount.Add(1)
+			if progressCallback != nil {
+				progressCallback(int(d), len(candidates))
+			}
+		}(i, cand.IP)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].speed > results[j].speed
+	})
+
+	var filtered []NodeResult
+	for _, r := range results {
+		if r.speed <= 0 {
+			continue
+		}
+		filtered = append(filtered, candidates[r.idx])
+		if len(filtered) >= topN {
+			break
+		}
+	}
+	return filtered
+}
+
+// traceInto records cand's colo and trace fields and reports whether the edge refused it.
+func traceInto(ctx context.Context, cand *NodeResult, cfg Config) (blocked bool) {
+	t := TraceDetails(ctx, cand.IP, cfg.Port)
+	cand.Colo, cand.egress = t.Colo, t.EgressIP
+	if cfg.TraceFields {
+		cand.EgressIP, cand.TraceHTTP, cand.TraceTLS, cand.Warp = t.EgressIP, t.HTTP, t.TLS, t.Warp
+	}
+	return t.Blocked
+}
+
+// runParallelDownloadTest runs the full download test on candidates.
+func runParallelDownloadTest(ctx context.Context, candidates []NodeResult, cfg Config, stats *DownloadStats,
+	progressRow func(res NodeResult),
+	progressStatus func(msg string),
+	progressLive func(LiveProgress),
+	fastExitHost func()) []NodeResult {
+
+	var cached []NodeResult
+	if cfg.CacheTTL > 0 {
+		cached, candidates = splitCachedCandidates(cfg, candidates)
+		cached = slices.DeleteFunc(cached, func(r NodeResult) bool { return !meetsMinSpeed(cfg, r) })
+		for _, res := range cached {
+			if progressRow != nil {
+				progressRow(res)
+			}
+		}
+		if len(cached) > 0 && progressStatus != nil {
+			progressStatus(fmt.Sprintf("Reused %d cached result(s) younger than %s", len(cached), cfg.CacheTTL))
+		}
+		cfg.DownloadNum -= len(cached)
+		if cfg.DownloadNum <= 0 || len(candidates) == 0 {
+			sort.Slice(cached, func(i, j int) bool { return cached[i].Score > cached[j].Score })
+			return cached
+		}
+	}
+
+	numWorkers := cfg.DLConc
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	if numWorkers > len(candidates) {
+		numWorkers = len(candidates)
+	}
+
+	var results []NodeResult
+	var mu sync.Mutex
+	var fastCount atomic.Int32
+	if stats == nil {
+		stats = &DownloadStats{}
+	}
+
+	resultCh := make(chan NodeResult, numWorkers*2)
+	doneCh := make(chan struct{})
+	var doneOnce sync.Once
+	closeDone := func() { doneOnce.Do(func() { close(doneCh) }) }
+
+	go func() {
+		for res := range resultCh {
+			if !meetsMinSpeed(cfg, res) {
+				continue
+			}
+			mu.Lock()
+			results = append(results, res)
+			n := len(results)
+			mu.Unlock()
+			if progressRow != nil {
+				progressRow(res)
+			}
+			if n >= cfg.DownloadNum {
+				closeDone()
+				return
+			}
+		}
+		closeDone()
+	}()
+
+	var wg sync.WaitGroup
+	var nextIdx atomic.Int32
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cooldown := cfg.DLInterval
+			maxCooldown := max(5*time.Second, cfg.DLInterval)
+
+			for {
+				select {
+				case <-doneCh:
+					return
+				case <-ctx.Done():
+					return
+				default:
+				}
+
+				idx := int(nextIdx.Add(1) - 1)
+				if idx >= len(candidates) {
+					return
+				}
+				cand := candidates[idx]
+
+				if idx > 0 {
+					select {
+					case <-time.After(pacingDelay(cooldown, cfg.DLJitter)):
+					case <-ctx.Done():
+						return
+					case <-doneCh:
+						return
+					}
+				}
+
+				if fastCount.Load() >= 5 {
+					return
+				}
+
+				t := stats.Tested.Add(1)
+				if progressStatus != nil {
+					progressStatus(fmt.Sprintf("Testing [%d/%d] %s (Skipped: %d)",
+						t, len(candidates), cand.IP, int(stats.Blocked.Load())))
+				}
+
+				// With -trace-first, one trace yields the colo and the blocking check.
+				blocked := false
+				if cfg.TraceFirst {
+					blocked = traceInto(ctx, &cand, cfg)
+				}
+
+				var res StreamResult
+				if !blocked {
+					if cfg.CachePrime && isCustomURL(cfg.URL) {
+						if progressStatus != nil {
+							progressStatus(fmt.Sprintf("Priming edge cache via %s...", cand.IP))
+						}
+						PrimeCache(ctx, cand.IP, cfg.Port, cfg.URL, cfg.SNI, time.Duration(cfg.Duration)*time.Second)
+					}
+					if cfg.Proxy != "" {
+						var err error
+						if res, err = ProxyStreamTest(ctx, cfg, cand.IP, progressLive); err != nil && progressStatus != nil {
+							progressStatus(err.Error())
+						}
+					} else {
+						res = MultiStreamTest(ctx, cand.IP, cfg.Port, cfg.Duration, cfg.URL, cfg.SNI, cfg.Streams, cfg.HTTP2, progressLive)
+					}
+					stats.Bytes.Add(res.Bytes)
+				}
+				speed := res.Speed
+				cand.TestedAt = time.Now().UTC().Truncate(time.Second)
+				cand.Addr = resultAddr(cand.IP, cfg.Port)
+				if ctx.Err() != nil && (blocked || res.Failed()) {
+					stats.Tested.Add(-1) // cut short by cancellation, not a verdict on the IP
+					return
+				}
+
+				if cfg.ProbeDPI {
+					cand.Interference = InterferenceProbe(ctx, cand.IP, cfg.Port, cfg.SNI, 4*time.Second)
+					if interferenceSuspected(cand.Interference) {
+						stats.Interference.Add(1)
+					}
+				}
+
+				if blocked || res.Failed() {
+					stats.Blocked.Add(1)
+					cooldown = min(max(cooldown*2, 500*time.Millisecond), maxCooldown)
+					if cfg.Skip429 && !cand.Pinned {
+						continue
+					}
+					cand.DownloadSpeed = 0
+					cand.Colo = "429"
+					cand.Score = 0
+					select {
+					case resultCh <- cand:
+					case <-doneCh:
+						return
+					}
+				} else {
+					cooldown = cfg.DLInterval
+					if !cfg.TraceFirst {
+						traceInto(ctx, &cand, cfg)
+					}
+					if !cfg.SkipLoadLatency {
+						cand.LoadLatency = MeasureLoadLatency(ctx, cand.IP, cfg.Port)
+					}
+					if cfg.ProbeECH {
+						cand.ECH = ECHProbe(ctx, cand.IP, cfg.Port, cfg.ECHDomain, cfg.ECHConfigList, 3*time.Second)
+					}
+					if cfg.WSURL != "" {
+						cand.WSStatus, cand.WSRTT = WebSocketProbe(ctx, cand.IP, cfg.Port, cfg.WSURL, cfg.SNI, 5*time.Second)
+					}
+					if cfg.GRPCURL != "" {
+						cand.GRPCStatus, cand.GRPCHeld = GRPCProbe(ctx, cand.IP, cfg.Port, cfg.GRPCURL, cfg.SNI, cfg.GRPCHold)
+					}
+					if cfg.ProbeResume {
+						cand.TLSHandshake, cand.ResumeLatency, cand.Resumed = TLSResumeProbe(ctx, cand.IP, cfg.Port, cfg.SNI, 3*time.Second)
+					}
+					if cfg.ProbeCert {
+						cand.CertStatus, cand.CertSubject, cand.CertIssuer, cand.CertSANs = CertProbe(ctx, cand.IP, cfg.Port, certSNI(cfg), cfg.CertIssuers, 3*time.Second)
+					}
+					cand.DownloadSpeed = speed
+					cand.SingleSpeed = speed
+					if res.Streams > 1 {
+						// Score on the per-stream share so multi-stream runs stay comparable.
+						cand.SingleSpeed = speed / float64(res.Streams)
+					}
+					cand.MinSpeed = res.MinSpeed
+					cand.Bytes = res.Bytes
+					cand.DownloadMicros = res.Elapsed.Microseconds()
+					cand.Stability = res.Stability
+					cand.CacheStatus = res.CacheStatus
+					cand.CalcScore()
+
+					select {
+					case resultCh <- cand:
+					case <-doneCh:
+						return
+					}
+
+					if speed >= cfg.StopThreshold {
+						if fastCount.Add(1) >= 5 {
+							if fastExitHost != nil {
+								fastExitHost()
+							}
+							return
+						}
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(resultCh)
+	<-doneCh
+
+	if cfg.CacheTTL > 0 {
+		if err := storeResultCache(cfg, results); err != nil && progressStatus != nil {
+			progressStatus("Error writing result cache: " + err.Error())
+		}
+		results = append(results, cached...)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
+
+func RunCLI(cfg Config) {
+	fmt.Printf("Cloudflare SpeedTest v1.8.5 (Go Edition)\n\n")
+
+	ctx, stop := interruptContext()
+	defer stop()
+	if cfg.Daemon {
+		runDaemon(ctx, cfg)
+		return
+	}
+	if results, summary, ok := runCLIOnce(ctx, cfg); ok {
+		finishRun(cfg, results, summary, printNotice)
+	}
+}
+
+// interruptContext returns a context the first Ctrl+C or SIGTERM cancels; a second one exits.
+func interruptContext() (context.Context, func()) {
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	stopNote := context.AfterFunc(ctx, func() {
+		stopSignals()
+		fmt.Println("\n⏹ Interrupted: finishing with the results so far (Ctrl+C again to quit now)...")
+	})
+	return ctx, func() {
+		stopNote()
+		stopSignals()
+	}
+}
+
+// runCLIOnce runs one test with terminal output, saves it, and reports whether there are results.
+func runCLIOnce(ctx context.Context, cfg Config) ([]NodeResult, RunSummary, bool) {
+	var (
+		mu          sync.Mutex
+		midLine     bool        // a \r progress line is showing
+		downloading atomic.Bool // statuses go on the progress line
+		cols        []tableColumn
+		live        *liveTable
+	)
+	line := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		if midLine {
+			fmt.Printf("\r%-130s\r", "")
+			midLine = false
+		}
+		fmt.Printf(format+"\n", args...)
+	}
+	progress := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Printf("\r"+format, args...)
+		midLine = true
+	}
+	row := func(r NodeResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		if midLine {
+			fmt.Printf("\r%-130s\r", "")
+			midLine = false
+		}
+		printTableRow(cols, r)
+	}
+
+	if !isCustomURL(cfg.URL) {
+		fmt.Println("💡 speed.cloudflare.com is heavily rate-limited; use -own-zone yourdomain.com for reliable results.")
+	}
+	runner := newFrontendRunner(cfg)
+	runner.OnStatus = func(msg string) {
+		if downloading.Load() {
+			progress("  %-100s", msg)
+			return
+		}
+		line("  %s", msg)
+	}
+	runner.OnScan = func(done, total, valid int) {
+		progress("  Process: %d/%d | Valid: %d", done, total, valid)
+	}
+	runner.OnFilter = func(done, total int) {
+		progress("  Filter: %d/%d", done, total)
+	}
+	runner.OnPhase = func(p PhaseTiming) {
+		if p.Name == "download" {
+			downloading.Store(false)
+		}
+	}
+	runner.beforeDownload = func(runCfg Config, candidates int) {
+		if runCfg.Streams > 1 || runCfg.HTTP2 {
+			mode := "separate connections"
+			if runCfg.HTTP2 {
+				mode = "multiplexed over one HTTP/2 connection"
+			}
+			line("   %d stream(s) per IP, %s", max(runCfg.Streams, 1), mode)
+		}
+		if runCfg.CacheTTL > 0 {
+			line("   reusing results younger than %s from %s", runCfg.CacheTTL, runCfg.CacheFile)
+		}
+		cols = resultColumns(runCfg)
+		live = &liveTable{cols: cols}
+		line("")
+		printTableHeader(cols)
+		downloading.Store(true)
+	}
+	runner.downloadCtx = downloadStopper
+	runner.OnResult = func(res NodeResult) {
+		if res.Colo == "429" && cfg.Skip429 {
+			return
+		}
+		emitJSONL(res)
+		if !cfg.LiveTop || !isTerminal(os.Stdout) {
+			row(res)
+		}
+	}
+	if cfg.LiveTop && isTerminal(os.Stdout) {
+		runner.OnTop = func(top []NodeResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			live.draw(top)
+		}
+	}
+	runner.OnProgress = func(p LiveProgress) {
+		progress("  📥 %-16s %6.1f MB  %6.2f MB/s  %4.0f/%ds    ",
+			p.IP, float64(p.Bytes)/1024/1024, p.Speed, p.Elapsed, int(p.Duration))
+	}
+	runner.OnFastExit = func() {
+		line("\n⚡ Fast-exit triggered.")
+		live.detach()
+	}
+	runner.OnLongevity = func(res NodeResult) {
+		line("  %-16s %-6s survived %5.0fs", res.IP, res.LongevityStatus, res.LongevitySec)
+	}
+	runner.reranked = func(results []NodeResult) {
+		for _, r := range results[:min(len(results), 5)] {
+			row(r)
+		}
+	}
+
+	results, summary, err := runner.Run(ctx)
+	line("")
+	switch {
+	case err == nil && cfg.LatencyOnly, errors.Is(err, ErrCancelled) && len(results) > 0:
+		fmt.Printf("⚡ %d lowest-latency IPs (no colo or download test):\n", len(results))
+		latency := latencyColumns()
+		printTableHeader(latency)
+		for _, r := range results {
+			printTableRow(latency, r)
+			emitJSONL(r)
+		}
+		printSummary(summary)
+		saveResults(cfg, results, &summary)
+		return nil, RunSummary{}, false
+	case errors.Is(err, ErrAllRateLimited):
+		fmt.Println("[!] All tested IPs failed or were rate-limited.")
+		for _, err := range reportBlocked(cfg, summary) {
+			fmt.Println("[!] Chat notification failed:", err)
+		}
+		printSummary(summary)
+		return nil, RunSummary{}, false
+	case err != nil:
+		fmt.Printf("[!] %v\n", err)
+		return nil, RunSummary{}, false
+	}
+
+	printSummary(summary)
+	if isCustomURL(cfg.URL) {
+		var uncached int
+		for _, r := range results {
+			if r.CacheStatus != "" && !cacheStatusReliable(r.CacheStatus) {
+				uncached++
+			}
+		}
+		if uncached > 0 {
+			fmt.Printf("\n⚠ %d result(s) were not served from edge cache (cf-cache-status MISS/BYPASS/...); "+
+				"they measure origin throughput. Use -cache-prime or a cacheable URL.\n", uncached)
+		}
+	}
+	saveResults(cfg, results, &summary)
+	return results, summary, true
+}
+
+// formatTestedAt renders t as RFC 3339, or "" when the result was never tested.
+func formatTestedAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// saveCSV writes results as CSV in the columns of cfg.
+func saveCSV(path string, results []NodeResult, cfg Config) {
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Println("Error saving CSV:", err)
+		return
+	}
+	defer f.Close()
+
+	f.Write([]byte{0xEF, 0xBB, 0xBF}) // UTF-8 BOM
+	w := csv.NewWriter(f)
+	defer w.Flush()
+	num := func(v float64, prec int) string {
+		if cfg.Raw {
+			prec = -1
+		}
+		return strconv.FormatFloat(v, 'f', prec, 64)
+	}
+
+	cols := csvColumns(cfg)
+	row := make([]string, len(cols))
+	for i, c := range cols {
+		row[i] = c.header
+	}
+	w.Write(row)
+	for _, r := range results {
+		for i, c := range cols {
+			row[i] = c.value(r, num)
+		}
+		w.Write(row)
+	}
+}
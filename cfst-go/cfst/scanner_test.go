@@ -0,0 +1,27 @@
+package cfst
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	for _, tc := range []struct {
+		spec         string
+		base, jitter time.Duration
+		ok           bool
+	}{
+		{"2s", 2 * time.Second, 0, true},
+		{"2s±1s", 2 * time.Second, time.Second, true},
+		{" 2s+-500ms ", 2 * time.Second, 500 * time.Millisecond, true},
+		{"0s", 0, 0, true},
+		{"2", 0, 0, false},
+		{"2s±", 0, 0, false},
+		{"-1s", 0, 0, false},
+	} {
+		base, jitter, err := parseInterval(tc.spec)
+		if (err == nil) != tc.ok || base != tc.base || jitter != tc.jitter {
+			t.Errorf("%q: %v ± %v, %v", tc.spec, base, jitter, err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package cfst
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// serve-target serves a self-hosted download target for -url or -own-zone.
+
+const payloadBlockSize = 1 << 20
+
+// writePayload streams n bytes to w by repeating block.
+func writePayload(w http.ResponseWriter, block []byte, n int64) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	for n > 0 {
+		chunk := block[:min(n, int64(len(block)))]
+		if _, err := w.Write(chunk); err != nil {
+			return
+		}
+		n -= int64(len(chunk))
+	}
+}
+
+func newTargetMux(size, maxBytes int64) *http.ServeMux {
+	// Random data keeps compression from inflating the measured speed.
+	block := make([]byte, payloadBlockSize)
+	rand.Read(block)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/__down", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.ParseInt(r.URL.Query().Get("bytes"), 10, 64)
+		if err != nil || n < 0 {
+			n = size
+		}
+		if n > maxBytes {
+			http.Error(w, fmt.Sprintf("bytes exceeds the %d limit", maxBytes), http.StatusBadRequest)
+			return
+		}
+		writePayload(w, block, n)
+	})
+	mux.HandleFunc(defaultOwnZonePath, func(w http.ResponseWriter, r *http.Request) {
+		writePayload(w, block, size)
+	})
+	mux.HandleFunc("/__up", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		start := time.Now()
+		n, err := io.Copy(io.Discard, http.MaxBytesReader(w, r.Body, maxBytes))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"bytes": n, "seconds": time.Since(start).Seconds()})
+	})
+	return mux
+}
+
+// selfSignedCert is enough for Cloudflare's "Full" SSL mode.
+func selfSignedCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "cfst-target"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// runServeTarget implements the serve-target subcommand.
+func runServeTarget(args []string) error {
+	fs := flag.NewFlagSet("serve-target", flag.ExitOnError)
+	listen := fs.String("listen", ":443", "Address to listen on")
+	certFile := fs.String("cert", "", "TLS certificate file (default: self-signed)")
+	keyFile := fs.String("key", "", "TLS key file")
+	plain := fs.Bool("http", false, "Serve plain HTTP (e.g. behind a TLS-terminating proxy)")
+	sizeMB := fs.Int64("size", 100, "Size of "+defaultOwnZonePath+" and of /__down without ?bytes, in MB")
+	maxMB := fs.Int64("max-bytes", 1024, "Largest download or upload accepted, in MB")
+	fs.Parse(args)
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           newTargetMux(*sizeMB<<20, *maxMB<<20),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if !*plain && *certFile == "" {
+		cert, err := selfSignedCert()
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		fmt.Println("Using a self-signed certificate (set the zone's SSL mode to Full)")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	scheme := "https"
+	if *plain {
+		scheme = "http"
+	}
+	fmt.Printf("🎯 Serving test payloads on %s://%s (%s, /__down, /__up)\n", scheme, *listen, defaultOwnZonePath)
+	var err error
+	if *plain {
+		err = srv.ListenAndServe()
+	} else {
+		err = srv.ListenAndServeTLS(*certFile, *keyFile)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package cfst
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// simServer emulates the trace, 429 and download endpoints of an edge on loopback.
+type simServer struct {
+	Colo      string // reported by /cdn-cgi/trace
+	Rate      int64  // download bytes per second (0 = unthrottled)
+	LimitFrom int64  // downloads from this one on get 429 (0 = never)
+
+	downloads atomic.Int64
+	limited   atomic.Int64
+	addr      string
+}
+
+func (s *simServer) handler() http.Handler {
+	block := make([]byte, 32<<10)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cdn-cgi/trace", func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		fmt.Fprintf(w, "fl=sim\nh=%s\nip=%s\nts=%d\nvisit_scheme=https\nuag=%s\ncolo=%s\nhttp=%s\nloc=US\ntls=TLSv1.3\nwarp=off\n",
+			r.Host, host, time.Now().Unix(), r.UserAgent(), s.Colo, r.Proto)
+	})
+	download := func(w http.ResponseWriter, r *http.Request) {
+		if n := s.downloads.Add(1); s.LimitFrom > 0 && n >= s.LimitFrom {
+			s.limited.Add(1)
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		n, err := strconv.ParseInt(r.URL.Query().Get("bytes"), 10, 64)
+		if err != nil || n <= 0 {
+			n = 100 << 20
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		start := time.Now()
+		var sent int64
+		for sent < n {
+			chunk := block[:min(n-sent, int64(len(block)))]
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			sent += int64(len(chunk))
+			if s.Rate > 0 {
+				// Sleep until the bytes sent so far are due at Rate.
+				due := time.Duration(float64(sent) / float64(s.Rate) * float64(time.Second))
+				time.Sleep(due - time.Since(start))
+			}
+		}
+	}
+	mux.HandleFunc("/__down", download)
+	mux.HandleFunc(defaultOwnZonePath, download)
+	return mux
+}
+
+// startSimServer starts s over TLS and returns a config that dials it for every IP.
+func startSimServer(tb testing.TB, s *simServer) Config {
+	srv := httptest.NewUnstartedServer(s.handler())
+	srv.StartTLS()
+	s.addr = srv.Listener.Addr().String()
+
+	cfg := DefaultConfig()
+	cfg.TargetOverride = s.addr
+	cfg.Geo = "off"
+	processSettings.transports.closeAll() // drop transports dialing elsewhere
+	processSettings.configureTransports(cfg)
+	tb.Cleanup(func() {
+		srv.Close()
+		processSettings.transports.closeAll()
+		processSettings.configureTransports(DefaultConfig())
+	})
+	return cfg
+}
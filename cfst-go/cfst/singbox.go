@@ -0,0 +1,192 @@
+package cfst
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// -singbox-template: point sing-box outbounds at the best results and reload it.
+
+const singBoxReloadTimeout = 10 * time.Second
+
+// singBoxTemplate is a parsed -singbox-template.
+type singBoxTemplate struct {
+	config    map[string]interface{}
+	outbounds []map[string]interface{} // the ones patched, in config order
+}
+
+// loadSingBoxTemplate reads path and finds the outbounds to patch.
+func loadSingBoxTemplate(path, tags string) (*singBoxTemplate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber() // ports and IDs come back as written
+	var config map[string]interface{}
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	list, _ := config["outbounds"].([]interface{})
+	want := make(map[string]bool)
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			want[tag] = true
+		}
+	}
+	t := &singBoxTemplate{config: config}
+	for _, o := range list {
+		out, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		tag, _ := out["tag"].(string)
+		if _, hasServer := out["server"]; (len(want) == 0 && hasServer) || want[tag] {
+			t.outbounds = append(t.outbounds, out)
+			delete(want, tag)
+		}
+	}
+	for tag := range want {
+		return nil, fmt.Errorf("%s: no outbound tagged %q", path, tag)
+	}
+	if len(t.outbounds) == 0 {
+		return nil, fmt.Errorf("%s: no outbound with a server to patch", path)
+	}
+	return t, nil
+}
+
+// patch points the outbounds at results, the best first, cycling through them.
+func (t *singBoxTemplate) patch(results []NodeResult) {
+	for i, out := range t.outbounds {
+		r := results[i%len(results)]
+		out["server"] = r.IP
+		if !portless(r) {
+			out["server_port"] = r.Port
+		}
+	}
+}
+
+// writeSingBox writes -singbox-out from the template and the best results, then reloads sing-box.
+func writeSingBox(cfg Config, results []NodeResult) (string, error) {
+	usable := topUsable(forPortless(results, cfg.Check443), 0)
+	if len(usable) == 0 {
+		return "", fmt.Errorf("no usable result to point the outbounds at")
+	}
+	t, err := loadSingBoxTemplate(cfg.SingBoxTemplate, cfg.SingBoxTags)
+	if err != nil {
+		return "", err
+	}
+	t.patch(usable)
+	b, err := json.MarshalIndent(t.config, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(cfg.SingBoxOut, append(b, '\n'), 0644); err != nil {
+		return "", err
+	}
+	msg := fmt.Sprintf("sing-box: %d outbound(s) → %s in %s", len(t.outbounds), usableAt(usable[0]), cfg.SingBoxOut)
+	if cfg.SingBoxReload != "" {
+		if err := reloadSingBox(cfg.SingBoxReload, cfg.SingBoxOut, cfg.SingBoxSecret); err != nil {
+			return "", fmt.Errorf("%s written, reload failed: %v", cfg.SingBoxOut, err)
+		}
+		msg += ", reloaded"
+	}
+	return msg, nil
+}
+
+// checkSingBoxReload validates a -singbox-reload value.
+func checkSingBoxReload(s string) error {
+	if target, ok := strings.CutPrefix(s, "hup:"); ok {
+		if target == "" {
+			return fmt.Errorf("-singbox-reload hup: needs a PID or a PID file")
+		}
+		return nil
+	}
+	if u, err := url.Parse(s); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		return nil
+	}
+	return fmt.Errorf("-singbox-reload must be hup:<pid or pid file> or the Clash API URL, got %q", s)
+}
+
+// reloadSingBox tells sing-box to load path, by signal or through its Clash API.
+func reloadSingBox(how, path, secret string) error {
+	if target, ok := strings.CutPrefix(how, "hup:"); ok {
+		return signalPID(target, syscall.SIGHUP)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(map[string]string{"path": abs})
+	ctx, cancel := context.WithTimeout(context.Background(), singBoxReloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimSuffix(how, "/")+"/configs?force=true", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Clash API: %s", resp.Status)
+	}
+	return nil
+}
+
+// signalPID sends sig to a PID, or the PID in a file.
+func signalPID(target string, sig os.Signal) error {
+	pid, err := strconv.Atoi(target)
+	if err != nil {
+		b, err := os.ReadFile(target)
+		if err != nil {
+			return err
+		}
+		if pid, err = strconv.Atoi(strings.TrimSpace(string(b))); err != nil {
+			return fmt.Errorf("%s: no PID in it", target)
+		}
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
+
+// writeFileAtomic writes data to path through a rename, so readers never see a part.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // a no-op after the rename
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,60 @@
+package cfst
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Socket options for connections to tested IPs; see sockopt_<os>.go.
+
+// socketSettings are the socket options of a run.
+type socketSettings struct {
+	noDelay     bool
+	userTimeout time.Duration
+	fastOpen    bool
+}
+
+// configureSockets installs the socket options and notes those this platform lacks.
+func (rs *runSettings) configureSockets(cfg Config) []string {
+	opts := socketSettings{noDelay: cfg.NoDelay, userTimeout: cfg.TCPUserTimeout, fastOpen: cfg.FastOpen}
+	var notes []string
+	if opts.userTimeout > 0 && !userTimeoutSupported {
+		notes = append(notes, "-tcp-user-timeout is not supported on this platform; ignored")
+		opts.userTimeout = 0
+	}
+	if opts.fastOpen && !fastOpenSupported {
+		notes = append(notes, "-tfo is not supported on this platform; ignored")
+		opts.fastOpen = false
+	}
+	rs.sockets = opts
+	return notes
+}
+
+// dialer returns a dialer applying the socket options.
+func (rs *runSettings) dialer(timeout time.Duration) *net.Dialer {
+	d := &net.Dialer{Timeout: timeout}
+	if opts := rs.sockets; opts.userTimeout > 0 || opts.fastOpen {
+		d.Control = func(_, _ string, c syscall.RawConn) error {
+			var serr error
+			if err := c.Control(func(fd uintptr) { serr = setSockOpts(fd, opts) }); err != nil {
+				return err
+			}
+			return serr
+		}
+	}
+	return d
+}
+
+// closeOnCancel closes conn if ctx ends first; call stop once done with conn.
+func closeOnCancel(ctx context.Context, conn net.Conn) (stop func() bool) {
+	return context.AfterFunc(ctx, func() { conn.Close() })
+}
+
+// tuneConn applies the options that can only be set once connected.
+func (rs *runSettings) tuneConn(c net.Conn) {
+	if tc, ok := c.(*net.TCPConn); ok && !rs.sockets.noDelay {
+		tc.SetNoDelay(false)
+	}
+}
@@ -0,0 +1,20 @@
+package cfst
+
+import "syscall"
+
+// TCP_RXT_CONNDROPTIME, seconds; not defined by package syscall.
+const tcpRxtConnDropTime = 0x80
+
+// Fast Open on macOS needs connectx(2), which net.Dialer doesn't use.
+const (
+	userTimeoutSupported = true
+	fastOpenSupported    = false
+)
+
+func setSockOpts(fd uintptr, opts socketSettings) error {
+	if opts.userTimeout > 0 {
+		secs := max(int(opts.userTimeout.Seconds()), 1)
+		return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpRxtConnDropTime, secs)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package cfst
+
+import "syscall"
+
+// Not defined by package syscall.
+const (
+	tcpUserTimeout     = 0x12 // TCP_USER_TIMEOUT, milliseconds
+	tcpFastOpenConnect = 0x1e // TCP_FASTOPEN_CONNECT, Linux 4.11+
+)
+
+const (
+	userTimeoutSupported = true
+	fastOpenSupported    = true
+)
+
+func setSockOpts(fd uintptr, opts socketSettings) error {
+	if opts.userTimeout > 0 {
+		if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpUserTimeout, int(opts.userTimeout.Milliseconds())); err != nil {
+			return err
+		}
+	}
+	if opts.fastOpen {
+		// Older kernels lack the option; connect normally there.
+		syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpFastOpenConnect, 1)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !windows
+
+package cfst
+
+const (
+	userTimeoutSupported = false
+	fastOpenSupported    = false
+)
+
+func setSockOpts(fd uintptr, opts socketSettings) error {
+	return nil
+}
@@ -0,0 +1,20 @@
+package cfst
+
+import "syscall"
+
+// TCP_MAXRT, seconds; not defined by package syscall.
+const tcpMaxRT = 5
+
+// Fast Open on Windows needs ConnectEx with data, which net.Dialer doesn't use.
+const (
+	userTimeoutSupported = true
+	fastOpenSupported    = false
+)
+
+func setSockOpts(fd uintptr, opts socketSettings) error {
+	if opts.userTimeout > 0 {
+		secs := max(int(opts.userTimeout.Seconds()), 1)
+		return syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_TCP, tcpMaxRT, secs)
+	}
+	return nil
+}
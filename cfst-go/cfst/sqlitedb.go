@@ -0,0 +1,92 @@
+package cfst
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -db appends every run to a SQLite database through the sqlite3 shell.
+
+const sqliteTimeout = 30 * time.Second
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	finished_at TEXT NOT NULL,
+	version TEXT NOT NULL,
+	config TEXT NOT NULL,
+	summary TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS results (
+	run_id INTEGER NOT NULL REFERENCES runs(id),
+	ip TEXT NOT NULL,
+	port INTEGER NOT NULL,
+	colo TEXT NOT NULL,
+	tcp_latency REAL NOT NULL,
+	jitter REAL NOT NULL,
+	packet_loss REAL NOT NULL,
+	download_speed REAL NOT NULL,
+	min_speed REAL NOT NULL,
+	stability REAL NOT NULL,
+	score REAL NOT NULL,
+	tested_at TEXT,
+	data TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS results_ip ON results(ip);
+CREATE INDEX IF NOT EXISTS results_colo ON results(colo);
+`
+
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func sqlReal(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// runSQL builds the statements recording one run.
+func runSQL(cfg Config, results []NodeResult, summary RunSummary, at time.Time) string {
+	var b strings.Builder
+	b.WriteString(sqliteSchema)
+	b.WriteString("BEGIN;\n")
+	conf, _ := json.Marshal(runConfig(cfg))
+	sum, _ := json.Marshal(summary)
+	fmt.Fprintf(&b, "INSERT INTO runs (finished_at, version, config, summary) VALUES (%s, %s, %s, %s);\n",
+		sqlQuote(at.UTC().Format(time.RFC3339)), sqlQuote(version), sqlQuote(string(conf)), sqlQuote(string(sum)))
+	b.WriteString("CREATE TEMP TABLE run AS SELECT last_insert_rowid() AS id;\n")
+	for _, r := range results {
+		data, _ := json.Marshal(r)
+		testedAt := "NULL"
+		if !r.TestedAt.IsZero() {
+			testedAt = sqlQuote(formatTestedAt(r.TestedAt))
+		}
+		fmt.Fprintf(&b, "INSERT INTO results VALUES ((SELECT id FROM run), %s, %d, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s);\n",
+			sqlQuote(r.IP), r.Port, sqlQuote(r.Colo), sqlReal(r.TCPLatency), sqlReal(r.Jitter), sqlReal(r.PacketLoss),
+			sqlReal(r.DownloadSpeed), sqlReal(r.MinSpeed), sqlReal(r.Stability), sqlReal(r.Score), testedAt, sqlQuote(string(data)))
+	}
+	b.WriteString("COMMIT;\n")
+	return b.String()
+}
+
+// appendRunDB records the run in the -db database.
+func appendRunDB(cfg Config, results []NodeResult, summary RunSummary, at time.Time) error {
+	shell, err := exec.LookPath("sqlite3")
+	if err != nil {
+		return fmt.Errorf("-db needs the sqlite3 command: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sqliteTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, shell, "-bail", cfg.DBFile)
+	cmd.Stdin = strings.NewReader(runSQL(cfg, results, summary, at))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sqlite3: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
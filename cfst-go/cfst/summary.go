@@ -0,0 +1,231 @@
+package cfst
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PhaseTiming is the duration of one pipeline phase and the items it processed.
+type PhaseTiming struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+	Items   int     `json:"items"`
+}
+
+// PerItemMs returns the average milliseconds spent per processed item.
+func (p PhaseTiming) PerItemMs() float64 {
+	if p.Items <= 0 {
+		return 0
+	}
+	return p.Seconds * 1000 / float64(p.Items)
+}
+
+// phaseTimer records the durations of consecutive pipeline phases.
+type phaseTimer struct {
+	start  time.Time
+	last   time.Time
+	phases []PhaseTiming
+	ports  int64 // portExhaustion at the start of the run
+}
+
+func newPhaseTimer() *phaseTimer {
+	now := time.Now()
+	return &phaseTimer{start: now, last: now, ports: portExhaustion.Load()}
+}
+
+// portFailures counts dials that failed for lack of a local port since the run started.
+func (t *phaseTimer) portFailures() int {
+	return int(portExhaustion.Load() - t.ports)
+}
+
+// mark closes the phase that started at the previous mark.
+func (t *phaseTimer) mark(name string, items int) PhaseTiming {
+	now := time.Now()
+	p := PhaseTiming{Name: name, Seconds: now.Sub(t.last).Seconds(), Items: items}
+	t.phases = append(t.phases, p)
+	t.last = now
+	return p
+}
+
+// filterPhaseName names the candidate-filter phase after the mode that ran.
+func filterPhaseName(mode string) string {
+	switch mode {
+	case "speed":
+		return "prefilter"
+	case "multi-colo":
+		return "colo"
+	default:
+		return "filter"
+	}
+}
+
+// RunSummary is the end-of-run digest printed by the CLI and sent with the SSE complete event.
+type RunSummary struct {
+	Scanned      int             `json:"scanned"`
+	Valid        int             `json:"valid"`
+	ValidRatio   float64         `json:"valid_ratio"`
+	Tested       int             `json:"tested"`
+	Blocked      int             `json:"blocked"`
+	BlockedRatio float64         `json:"blocked_ratio"`
+	BestSpeed    float64         `json:"best_speed"`
+	MedianSpeed  float64         `json:"median_speed"`
+	TotalMB      float64         `json:"total_mb"`
+	Elapsed      float64         `json:"elapsed"`
+	Phases       []PhaseTiming   `json:"phases"`
+	Latency      []LatencyBucket `json:"latency_histogram,omitempty"` // every valid IP, not only the tested ones
+	Colos        []ColoCount     `json:"colos,omitempty"`             // candidates with a detected colo
+	Detours      []Alert         `json:"detours,omitempty"`           // nearby colos with anomalously high latency
+	PortFailures int             `json:"port_exhaustion,omitempty"`   // dials that failed for lack of a local port
+	CertWarnings int             `json:"cert_warnings,omitempty"`     // results with a suspicious -cert-check verdict
+	BestByPort   []PortBest      `json:"best_by_port,omitempty"`      // only when the results span several ports
+	BestAddr     string          `json:"best_addr,omitempty"`         // best ip:port across them
+	EgressIPs    []string        `json:"egress_ips,omitempty"`        // -trace-fields: our addresses as the edges saw them
+	EgressMoved  int             `json:"egress_changed,omitempty"`    // results measured from a non-prevailing egress
+	Partial      bool            `json:"partial,omitempty"`           // the run was interrupted or hit -timeout
+
+	ranges *rangeTally // per-range scan counts for -telemetry-url
+}
+
+// PortBest is the top-scored usable result on one port.
+type PortBest struct {
+	Port  int     `json:"port"`
+	IP    string  `json:"ip"`
+	Addr  string  `json:"addr"` // ip:port
+	Colo  string  `json:"colo"`
+	Speed float64 `json:"download_speed"`
+	Score float64 `json:"score"`
+}
+
+// bestByPort returns the best result per port, or nil when all are on one port.
+func bestByPort(results []NodeResult) []PortBest {
+	best := make(map[int]NodeResult)
+	for _, r := range results {
+		if r.DownloadSpeed <= 0 {
+			continue
+		}
+		if b, ok := best[r.Port]; !ok || r.Score > b.Score {
+			best[r.Port] = r
+		}
+	}
+	if len(best) < 2 {
+		return nil
+	}
+	out := make([]PortBest, 0, len(best))
+	for port, r := range best {
+		out = append(out, PortBest{Port: port, IP: r.IP, Addr: net.JoinHostPort(r.IP, strconv.Itoa(port)),
+			Colo: r.Colo, Speed: r.DownloadSpeed, Score: r.Score})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Port < out[j].Port })
+	return out
+}
+
+// buildSummary summarizes a run; coloNodes count in the colo distribution with results.
+func buildSummary(scanned, valid int, latency []LatencyBucket, coloNodes []NodeResult, stats *DownloadStats, results []NodeResult, timer *phaseTimer) RunSummary {
+	s := RunSummary{
+		Scanned: scanned,
+		Valid:   valid,
+		Latency: latency,
+		Colos:   coloDistribution(coloNodes, results),
+		Tested:  int(stats.Tested.Load()),
+		Blocked: int(stats.Blocked.Load()),
+		TotalMB: float64(stats.Bytes.Load()) / 1024.0 / 1024.0,
+		Elapsed: time.Since(timer.start).Seconds(),
+		Phases:  timer.phases,
+	}
+	s.PortFailures = timer.portFailures()
+	if scanned > 0 {
+		s.ValidRatio = float64(valid) / float64(scanned)
+	}
+	if s.Tested > 0 {
+		s.BlockedRatio = float64(s.Blocked) / float64(s.Tested)
+	}
+
+	var speeds []float64
+	for _, r := range results {
+		if certSuspicious(r.CertStatus) {
+			s.CertWarnings++
+		}
+		if r.EgressIP != "" && !slices.Contains(s.EgressIPs, r.EgressIP) {
+			s.EgressIPs = append(s.EgressIPs, r.EgressIP)
+		}
+		if r.DownloadSpeed > 0 {
+			speeds = append(speeds, r.DownloadSpeed)
+		}
+	}
+	if len(speeds) > 0 {
+		sort.Float64s(speeds)
+		s.BestSpeed = speeds[len(speeds)-1]
+		s.MedianSpeed = median(speeds)
+	}
+	if s.BestByPort = bestByPort(results); s.BestByPort != nil {
+		top := s.BestByPort[0]
+		for _, b := range s.BestByPort[1:] {
+			if b.Score > top.Score {
+				top = b
+			}
+		}
+		s.BestAddr = top.Addr
+	}
+	return s
+}
+
+// median expects a sorted slice.
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// printSummary prints the summary and a SUMMARY line with it as JSON.
+func printSummary(s RunSummary) {
+	fmt.Println("\n📊 Summary")
+	fmt.Printf("  %-14s %d\n", "Scanned:", s.Scanned)
+	fmt.Printf("  %-14s %d (%.1f%%)\n", "Valid:", s.Valid, s.ValidRatio*100)
+	fmt.Printf("  %-14s %d\n", "Tested:", s.Tested)
+	fmt.Printf("  %-14s %d (%.1f%%)\n", "Blocked:", s.Blocked, s.BlockedRatio*100)
+	fmt.Printf("  %-14s %.2f MB/s\n", "Best speed:", s.BestSpeed)
+	fmt.Printf("  %-14s %.2f MB/s\n", "Median speed:", s.MedianSpeed)
+	fmt.Printf("  %-14s %.1f MB\n", "Total data:", s.TotalMB)
+	fmt.Printf("  %-14s %.1fs\n", "Elapsed:", s.Elapsed)
+	for _, p := range s.Phases {
+		fmt.Printf("  %-14s %6.1fs  %5d items  %7.1f ms/item\n", p.Name+":", p.Seconds, p.Items, p.PerItemMs())
+	}
+	printLatencyHistogram(s.Latency)
+	printColoDistribution(s.Colos)
+	if len(s.BestByPort) > 0 {
+		fmt.Println("  Best per port:")
+		for _, b := range s.BestByPort {
+			fmt.Printf("    %-6d %-40s %-6s %6.2f MB/s  score %5.1f\n", b.Port, b.Addr, b.Colo, b.Speed, b.Score)
+		}
+		fmt.Printf("  %-14s %s\n", "Best overall:", s.BestAddr)
+	}
+	if len(s.EgressIPs) > 0 {
+		fmt.Printf("  %-14s %s\n", "Egress IP:", strings.Join(s.EgressIPs, ", "))
+	}
+	if len(s.EgressIPs) > 1 {
+		fmt.Println("  ⚠ Cloudflare saw several egress IPs: traffic leaves through more than one address (NAT pool, proxy or VPN), so rate limits can follow the egress rather than the tested IP")
+	}
+	if s.EgressMoved > 0 {
+		fmt.Printf("  ⚠ %d result(s) were measured after (or before) a public IP change and aren't comparable with the rest\n", s.EgressMoved)
+	}
+	if s.PortFailures > 0 {
+		fmt.Println("  ⚠ " + portExhaustionWarning(s.PortFailures))
+	}
+	if s.CertWarnings > 0 {
+		fmt.Printf("  ⚠ %d IP(s) presented an unexpected certificate (see CertStatus): possible TLS interception or a non-Cloudflare endpoint\n", s.CertWarnings)
+	}
+
+	b, _ := json.Marshal(s)
+	fmt.Printf("SUMMARY %s\n", b)
+}
@@ -0,0 +1,217 @@
+package cfst
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// tableColumn is one column of the CLI result table.
+type tableColumn struct {
+	header string
+	width  int
+	value  func(r NodeResult) string
+}
+
+// csvColumn is one column of the result CSV; num formats a float, in full under -raw.
+type csvColumn struct {
+	header string
+	value  func(r NodeResult, num func(v float64, prec int) string) string
+}
+
+// resultFeature is an optional probe and the table and CSV columns it adds.
+type resultFeature struct {
+	on    func(cfg Config) bool
+	table []tableColumn
+	csv   []csvColumn
+}
+
+var resultFeatures = []resultFeature{
+	{
+		on:    func(cfg Config) bool { return isCustomURL(cfg.URL) },
+		table: []tableColumn{{"Cache", 7, func(r NodeResult) string { return r.CacheStatus }}},
+		csv:   []csvColumn{{"CacheStatus", func(r NodeResult, _ func(float64, int) string) string { return r.CacheStatus }}},
+	},
+	{
+		on:    func(cfg Config) bool { return cfg.ProbeECH },
+		table: []tableColumn{{"ECH", 9, func(r NodeResult) string { return r.ECH }}},
+		csv:   []csvColumn{{"ECH", func(r NodeResult, _ func(float64, int) string) string { return r.ECH }}},
+	},
+	{
+		on: func(cfg Config) bool { return cfg.WSURL != "" },
+		table: []tableColumn{{"WS", 10, func(r NodeResult) string {
+			if r.WSStatus != "ok" {
+				return r.WSStatus
+			}
+			return fmt.Sprintf("%.1fms", r.WSRTT)
+		}}},
+		csv: []csvColumn{
+			{"WebSocket", func(r NodeResult, _ func(float64, int) string) string { return r.WSStatus }},
+			{"WSRTT", func(r NodeResult, num func(float64, int) string) string { return num(r.WSRTT, 1) }},
+		},
+	},
+	{
+		on: func(cfg Config) bool { return cfg.GRPCURL != "" },
+		table: []tableColumn{{"gRPC", 14, func(r NodeResult) string {
+			return fmt.Sprintf("%s/%.0fs", r.GRPCStatus, r.GRPCHeld)
+		}}},
+		csv: []csvColumn{
+			{"GRPC", func(r NodeResult, _ func(float64, int) string) string { return r.GRPCStatus }},
+			{"GRPCHeld", func(r NodeResult, num func(float64, int) string) string { return num(r.GRPCHeld, 1) }},
+		},
+	},
+	{
+		on: func(cfg Config) bool { return cfg.ProbeResume },
+		table: []tableColumn{{"Resume", 14, func(r NodeResult) string {
+			if !r.Resumed {
+				return "no"
+			}
+			return fmt.Sprintf("%.1f/%.1fms", r.ResumeLatency, r.TLSHandshake)
+		}}},
+		csv: []csvColumn{
+			{"TLSHandshake", func(r NodeResult, num func(float64, int) string) string { return num(r.TLSHandshake, 1) }},
+			{"ResumeLatency", func(r NodeResult, num func(float64, int) string) string { return num(r.ResumeLatency, 1) }},
+			{"Resumed", func(r NodeResult, _ func(float64, int) string) string { return strconv.FormatBool(r.Resumed) }},
+		},
+	},
+	{
+		on:    func(cfg Config) bool { return cfg.ProbeCert },
+		table: []tableColumn{{"Cert", 17, func(r NodeResult) string { return r.CertStatus }}},
+		csv: []csvColumn{
+			{"CertStatus", func(r NodeResult, _ func(float64, int) string) string { return r.CertStatus }},
+			{"CertSubject", func(r NodeResult, _ func(float64, int) string) string { return r.CertSubject }},
+			{"CertIssuer", func(r NodeResult, _ func(float64, int) string) string { return r.CertIssuer }},
+			{"CertSANs", func(r NodeResult, _ func(float64, int) string) string { return strings.Join(r.CertSANs, " ") }},
+		},
+	},
+	{
+		on:    func(cfg Config) bool { return cfg.TraceFields },
+		table: []tableColumn{{"Egress", 16, func(r NodeResult) string { return r.EgressIP }}},
+		csv: []csvColumn{
+			{"EgressIP", func(r NodeResult, _ func(float64, int) string) string { return r.EgressIP }},
+			{"TraceHTTP", func(r NodeResult, _ func(float64, int) string) string { return r.TraceHTTP }},
+			{"TraceTLS", func(r NodeResult, _ func(float64, int) string) string { return r.TraceTLS }},
+			{"Warp", func(r NodeResult, _ func(float64, int) string) string { return r.Warp }},
+		},
+	},
+	{
+		on: func(cfg Config) bool { return len(cfg.PinIPs) > 0 },
+		table: []tableColumn{{"Pin", 4, func(r NodeResult) string {
+			if r.Pinned {
+				return "*"
+			}
+			return ""
+		}}},
+		csv: []csvColumn{{"Pinned", func(r NodeResult, _ func(float64, int) string) string { return strconv.FormatBool(r.Pinned) }}},
+	},
+	{
+		on:    func(cfg Config) bool { return cfg.ProbeDPI },
+		table: []tableColumn{{"Interference", 12, func(r NodeResult) string { return r.Interference }}},
+		csv:   []csvColumn{{"Interference", func(r NodeResult, _ func(float64, int) string) string { return r.Interference }}},
+	},
+	{
+		on: func(cfg Config) bool { return cfg.Longevity > 0 },
+		csv: []csvColumn{
+			{"Longevity", func(r NodeResult, _ func(float64, int) string) string { return r.LongevityStatus }},
+			{"LongevitySec", func(r NodeResult, num func(float64, int) string) string { return num(r.LongevitySec, 0) }},
+		},
+	},
+	{
+		on:  func(cfg Config) bool { return cfg.CacheTTL > 0 || cfg.Raw },
+		csv: []csvColumn{{"TestedAt", func(r NodeResult, _ func(float64, int) string) string { return formatTestedAt(r.TestedAt) }}},
+	},
+	{
+		on:  func(cfg Config) bool { return cfg.Raw || cfg.Pings != defaultPings },
+		csv: []csvColumn{{"PacketLoss", func(r NodeResult, num func(float64, int) string) string { return num(r.PacketLoss, 2) }}},
+	},
+	{
+		on:  func(cfg Config) bool { return cfg.TraceFields && cfg.EgressChange == EgressMark },
+		csv: []csvColumn{{"EgressChanged", func(r NodeResult, _ func(float64, int) string) string { return strconv.FormatBool(r.EgressChanged) }}},
+	},
+	{
+		on:  func(cfg Config) bool { return cfg.Port != 443 },
+		csv: []csvColumn{{"Addr", func(r NodeResult, _ func(float64, int) string) string { return r.Addr }}},
+	},
+	{
+		on:  func(cfg Config) bool { return cfg.Check443 },
+		csv: []csvColumn{{"Port443", func(r NodeResult, _ func(float64, int) string) string { return strconv.FormatBool(r.Port443) }}},
+	},
+	{
+		on: func(cfg Config) bool { return cfg.Raw },
+		csv: []csvColumn{
+			{"Bytes", func(r NodeResult, _ func(float64, int) string) string { return strconv.FormatInt(r.Bytes, 10) }},
+			{"DownloadUs", func(r NodeResult, _ func(float64, int) string) string { return strconv.FormatInt(r.DownloadMicros, 10) }},
+			{"LatencyUs", func(r NodeResult, _ func(float64, int) string) string {
+				return strconv.FormatInt(int64(math.Round(r.TCPLatency*1000)), 10)
+			}},
+		},
+	},
+}
+
+// resultColumns returns the CLI table layout for cfg; optional probes add columns.
+func resultColumns(cfg Config) []tableColumn {
+	cols := []tableColumn{
+		{"IP", 16, func(r NodeResult) string { return r.IP }},
+		{"Colo", 6, func(r NodeResult) string { return r.Colo }},
+		{"Latency", 9, func(r NodeResult) string { return fmt.Sprintf("%6.1fms", r.TCPLatency) }},
+		{"Jitter", 9, func(r NodeResult) string { return fmt.Sprintf("%5.1fms", r.Jitter) }},
+		{"Loss", 5, func(r NodeResult) string { return fmt.Sprintf("%3.0f%%", r.PacketLoss*100) }},
+		{"Speed", 13, func(r NodeResult) string { return fmt.Sprintf("%6.2f MB/s", r.DownloadSpeed) }},
+		{"MinSpd", 12, func(r NodeResult) string { return fmt.Sprintf("%5.2f MB/s", r.MinSpeed) }},
+	}
+	if !cfg.SkipLoadLatency {
+		cols = append(cols, tableColumn{"LoadLat", 9, func(r NodeResult) string { return fmt.Sprintf("%6.1fms", r.LoadLatency) }})
+	}
+	cols = append(cols,
+		tableColumn{"Stable", 8, func(r NodeResult) string { return fmt.Sprintf("%4.0f%%", r.Stability) }},
+		tableColumn{"Score", 6, func(r NodeResult) string { return fmt.Sprintf("%5.1f", r.Score) }},
+	)
+	for _, f := range resultFeatures {
+		if f.on(cfg) {
+			cols = append(cols, f.table...)
+		}
+	}
+	return cols
+}
+
+// csvColumns returns the ten base CSV columns and those of the features that are on.
+func csvColumns(cfg Config) []csvColumn {
+	cols := []csvColumn{
+		{"IP", func(r NodeResult, _ func(float64, int) string) string { return r.IP }},
+		{"Colo", func(r NodeResult, _ func(float64, int) string) string { return r.Colo }},
+		{"Latency", func(r NodeResult, num func(float64, int) string) string { return num(r.TCPLatency, 1) }},
+		{"Jitter", func(r NodeResult, num func(float64, int) string) string { return num(r.Jitter, 1) }},
+		{"SgSpeed_MB", func(r NodeResult, num func(float64, int) string) string { return num(r.SingleSpeed, 2) }},
+		{"Speed_MB", func(r NodeResult, num func(float64, int) string) string { return num(r.DownloadSpeed, 2) }},
+		{"MinSpeed_MB", func(r NodeResult, num func(float64, int) string) string { return num(r.MinSpeed, 2) }},
+		{"LoadLatency", func(r NodeResult, num func(float64, int) string) string { return num(r.LoadLatency, 1) }},
+		{"Stability", func(r NodeResult, num func(float64, int) string) string { return num(r.Stability, 0) }},
+		{"Score", func(r NodeResult, num func(float64, int) string) string { return num(r.Score, 1) }},
+	}
+	for _, f := range resultFeatures {
+		if f.on(cfg) {
+			cols = append(cols, f.csv...)
+		}
+	}
+	return cols
+}
+
+func printTableHeader(cols []tableColumn) {
+	var b strings.Builder
+	width := 0
+	for _, c := range cols {
+		fmt.Fprintf(&b, "%-*s ", c.width, c.header)
+		width += c.width + 1
+	}
+	fmt.Println(strings.TrimRight(b.String(), " "))
+	fmt.Println(strings.Repeat("-", width))
+}
+
+func printTableRow(cols []tableColumn, r NodeResult) {
+	var b strings.Builder
+	for _, c := range cols {
+		fmt.Fprintf(&b, "%-*s ", c.width, c.value(r))
+	}
+	fmt.Println(strings.TrimRight(b.String(), " "))
+}
@@ -0,0 +1,87 @@
+package cfst
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// -tg-token and -tg-chat send the run report through a Telegram bot.
+
+// telegramAPI is the base URL of the Telegram Bot API.
+var telegramAPI = "https://api.telegram.org"
+
+const (
+	telegramTop     = 5 // results listed in a message
+	telegramTimeout = 15 * time.Second
+)
+
+// runReport renders the plain-text run report the chat notifications send.
+func runReport(headline string, results []NodeResult, summary RunSummary) string {
+	return headline + "\n" + reportBody(results, summary)
+}
+
+// reportBody lists the top results and a line of run totals.
+func reportBody(results []NodeResult, summary RunSummary) string {
+	var b strings.Builder
+	top := topUsable(results, telegramTop)
+	if len(top) == 0 {
+		b.WriteString("No usable results.\n")
+	}
+	for i, r := range top {
+		fmt.Fprintf(&b, "%d. %s  %s  %.1f ms  %.2f MB/s\n", i+1, usableAt(r), r.Colo, r.TCPLatency, r.DownloadSpeed)
+	}
+	fmt.Fprintf(&b, "Tested %d, blocked %d, %.0fs", summary.Tested, summary.Blocked, summary.Elapsed)
+	if summary.Partial {
+		b.WriteString(" (partial)")
+	}
+	return b.String()
+}
+
+// sendTelegram sends text to the -tg-chat.
+func sendTelegram(cfg Config, text string) error {
+	if cfg.OfflineSources {
+		return errOffline
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"chat_id":                  cfg.TGChat,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), telegramTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", telegramAPI+"/bot"+cfg.TGToken+"/sendMessage", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err // its URL holds the token
+		}
+		return fmt.Errorf("sendMessage: %v", err)
+	}
+	defer resp.Body.Close()
+	var reply struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("sendMessage: %s", resp.Status)
+	}
+	if !reply.OK {
+		return fmt.Errorf("sendMessage: %s", reply.Description)
+	}
+	return nil
+}
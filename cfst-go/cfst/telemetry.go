@@ -0,0 +1,208 @@
+package cfst
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// -telemetry-url shares one ε-differentially private aggregate report per run.
+
+const (
+	telemetryMaxLatency = 1000.0 // ms, clamp for the mean latency
+	telemetryMaxSpeed   = 100.0  // MB/s, clamp for the mean speed
+	telemetryTimeout    = 10 * time.Second
+	telemetryQueries    = 5 // released values one IP can change; each gets ε/5
+)
+
+// telemetryRanges are the /24s of CloudflareIPv4Ranges, the ranges a report may list.
+var telemetryRanges = sync.OnceValue(func() []string {
+	var ranges []string
+	for _, cidr := range CloudflareIPv4Ranges {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		ones, _ := n.Mask.Size()
+		base := binary.BigEndian.Uint32(n.IP.To4())
+		for i := uint32(0); i < 1<<max(24-ones, 0); i++ {
+			ip := make(net.IP, net.IPv4len)
+			binary.BigEndian.PutUint32(ip, base+i<<8)
+			ranges = append(ranges, ip.String()+"/24")
+		}
+	}
+	sort.Strings(ranges)
+	return ranges
+})
+
+// TelemetryReport is the body POSTed to -telemetry-url.
+type TelemetryReport struct {
+	Version string           `json:"version"`
+	Hour    time.Time        `json:"hour"` // run time, truncated to the hour
+	Port    int              `json:"port"`
+	Epsilon float64          `json:"epsilon"`
+	Ranges  []RangeTelemetry `json:"ranges"`
+	Colos   []ColoTelemetry  `json:"colos"`
+}
+
+// RangeTelemetry is the noised reachability of one scanned range.
+type RangeTelemetry struct {
+	Range     string `json:"range"` // CIDR
+	Scanned   int    `json:"scanned"`
+	Reachable int    `json:"reachable"`
+}
+
+// ColoTelemetry is the noised outcome of the results in one colo.
+type ColoTelemetry struct {
+	Colo      string  `json:"colo"`
+	Results   int     `json:"results"`
+	LatencyMs float64 `json:"latency_ms"`
+	SpeedMB   float64 `json:"speed_mb"`
+}
+
+// rangeTally counts scanned and reachable IPs per range; nil ignores everything.
+type rangeTally struct {
+	mu      sync.Mutex
+	scanned map[string]int
+	valid   map[string]int
+}
+
+func newRangeTally(enabled bool) *rangeTally {
+	if !enabled {
+		return nil
+	}
+	return &rangeTally{scanned: make(map[string]int), valid: make(map[string]int)}
+}
+
+// rangeOf returns the /24 (IPv4) or /48 (IPv6) ip falls in, "" if not an IP.
+func rangeOf(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	bits := 48
+	if v4 := parsed.To4(); v4 != nil {
+		parsed, bits = v4, 24
+	}
+	n := net.IPNet{IP: parsed.Mask(net.CIDRMask(bits, len(parsed)*8)), Mask: net.CIDRMask(bits, len(parsed)*8)}
+	return n.String()
+}
+
+// scan counts ips as probed.
+func (t *rangeTally) scan(ips []string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, ip := range ips {
+		if r := rangeOf(ip); r != "" {
+			t.scanned[r]++
+		}
+	}
+}
+
+// observe counts n as reachable; it has the onValid signature.
+func (t *rangeTally) observe(n NodeResult) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if r := rangeOf(n.IP); r != "" {
+		t.valid[r]++
+	}
+}
+
+// laplace samples Laplace(0, scale) noise.
+func laplace(rng *rand.Rand, scale float64) float64 {
+	u := rng.Float64() - 0.5
+	return -scale * math.Copysign(math.Log(1-2*math.Abs(u)), u)
+}
+
+// noisyCount adds Laplace(1/ε) to a count, rounded and floored at 0.
+func noisyCount(rng *rand.Rand, n int, eps float64) int {
+	return max(int(math.Round(float64(n)+laplace(rng, 1/eps))), 0)
+}
+
+// noisyMean returns the noised clamped sum of values over the noised count n.
+func noisyMean(rng *rand.Rand, values []float64, n int, bound, eps float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += math.Min(math.Max(v, 0), bound)
+	}
+	mean := (sum + laplace(rng, bound/eps)) / float64(n)
+	return math.Round(math.Min(math.Max(mean, 0), bound)*10) / 10
+}
+
+// buildTelemetry assembles the noised report, leaving out entries whose count is zero.
+func buildTelemetry(t *rangeTally, results []NodeResult, port int, eps float64, at time.Time, rng *rand.Rand) TelemetryReport {
+	rep := TelemetryReport{Version: version, Hour: at.UTC().Truncate(time.Hour), Port: port, Epsilon: eps}
+	eps /= telemetryQueries
+	if t != nil {
+		t.mu.Lock()
+		for _, r := range telemetryRanges() {
+			scanned := noisyCount(rng, t.scanned[r], eps)
+			if scanned == 0 {
+				continue
+			}
+			reachable := min(noisyCount(rng, t.valid[r], eps), scanned)
+			rep.Ranges = append(rep.Ranges, RangeTelemetry{Range: r, Scanned: scanned, Reachable: reachable})
+		}
+		t.mu.Unlock()
+	}
+
+	lats := make(map[string][]float64)
+	speeds := make(map[string][]float64)
+	for _, r := range results {
+		if r.DownloadSpeed <= 0 {
+			continue
+		}
+		lats[r.Colo] = append(lats[r.Colo], r.TCPLatency)
+		speeds[r.Colo] = append(speeds[r.Colo], r.DownloadSpeed)
+	}
+	for colo := range coloSites {
+		n := noisyCount(rng, len(lats[colo]), eps)
+		if n == 0 {
+			continue
+		}
+		rep.Colos = append(rep.Colos, ColoTelemetry{
+			Colo:      colo,
+			Results:   n,
+			LatencyMs: noisyMean(rng, lats[colo], n, telemetryMaxLatency, eps),
+			SpeedMB:   noisyMean(rng, speeds[colo], n, telemetryMaxSpeed, eps),
+		})
+	}
+	sort.Slice(rep.Colos, func(i, j int) bool { return rep.Colos[i].Colo < rep.Colos[j].Colo })
+	return rep
+}
+
+// sendTelemetry POSTs the run's report to cfg.TelemetryURL.
+func sendTelemetry(cfg Config, t *rangeTally, results []NodeResult, at time.Time) error {
+	if cfg.OfflineSources {
+		return errOffline
+	}
+	rep := buildTelemetry(t, results, cfg.Port, cfg.TelemetryEps, at, rand.New(rand.NewSource(time.Now().UnixNano())))
+	body, err := json.Marshal(rep)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: telemetryTimeout}
+	resp, err := client.Post(cfg.TelemetryURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("telemetry endpoint returned %s", resp.Status)
+	}
+	return nil
+}
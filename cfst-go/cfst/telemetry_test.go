@@ -0,0 +1,26 @@
+package cfst
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestNoisyMeanHidesCount checks that the noise ignores the real count.
+func TestNoisyMeanHidesCount(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		values []float64
+		sum    float64 // clamped to [0, 500]
+	}{
+		{"one value", []float64{400}, 400},
+		{"ten values", []float64{40, 40, 40, 40, 40, 40, 40, 40, 40, 40}, 400},
+		{"negative", []float64{400, -5, 0}, 400},
+		{"above the bound", []float64{1000, 0}, 500},
+	} {
+		got := noisyMean(rand.New(rand.NewSource(1)), tc.values, 4, 500, 0.2)
+		want := noisyMean(rand.New(rand.NewSource(1)), []float64{tc.sum}, 4, 500, 0.2)
+		if got != want {
+			t.Errorf("%s: %.1f, want %.1f as for any values with the same clamped sum", tc.name, got, want)
+		}
+	}
+}
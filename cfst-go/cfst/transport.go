@@ -0,0 +1,137 @@
+package cfst
+
+import (
+	"container/list"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IP-pinned transports are pooled per IP and shared by every request to it.
+
+// transportPoolSize bounds the pooled transports; the least recently used is closed.
+const transportPoolSize = 64
+
+// transportSettings are the tunables of pinned transports.
+type transportSettings struct {
+	dialTimeout    time.Duration
+	keepAlive      time.Duration
+	maxIdlePerHost int
+	idleTimeout    time.Duration
+}
+
+var defaultTransportSettings = transportSettings{
+	dialTimeout:    3 * time.Second,
+	keepAlive:      15 * time.Second,
+	maxIdlePerHost: 4,
+	idleTimeout:    30 * time.Second,
+}
+
+// dialAddr is the address to dial for ip:port under -target-override and -nat64.
+func (rs *runSettings) dialAddr(ip string, port int) string {
+	if rs.target != "" {
+		return rs.target
+	}
+	return net.JoinHostPort(rs.nat64Addr(ip), strconv.Itoa(port))
+}
+
+// configureTransports installs the transport tunables and a shared TLS session cache.
+func (rs *runSettings) configureTransports(cfg Config) {
+	rs.transport = transportSettings{
+		dialTimeout:    rs.transport.dialTimeout,
+		keepAlive:      cfg.DialKeepAlive,
+		maxIdlePerHost: cfg.MaxIdlePerHost,
+		idleTimeout:    cfg.IdleConnTTL,
+	}
+	rs.target = cfg.TargetOverride
+	if cfg.TLSSessions > 0 {
+		rs.tls.ClientSessionCache = tls.NewLRUClientSessionCache(cfg.TLSSessions)
+	} else {
+		rs.tls.ClientSessionCache = nil
+	}
+}
+
+// pinnedTransport builds a transport that dials ip:port whatever the request URL says.
+func (rs *runSettings) pinnedTransport(ip string, port int, sni string) *http.Transport {
+	addr := rs.dialAddr(ip, port)
+	opts := rs.transport
+	return &http.Transport{
+		TLSClientConfig:     rs.tlsConfig(sni),
+		MaxIdleConnsPerHost: opts.maxIdlePerHost,
+		IdleConnTimeout:     opts.idleTimeout,
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			d := rs.dialer(opts.dialTimeout)
+			d.KeepAlive = opts.keepAlive
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				noteDialError(err)
+				return nil, err
+			}
+			rs.tuneConn(conn)
+			return conn, nil
+		},
+	}
+}
+
+// client returns an HTTP client pinned to ip:port over the pooled transport.
+func (rs *runSettings) client(ip string, port int, sni string) *http.Client {
+	return &http.Client{Transport: rs.withResolve(rs.transports.get(rs, ip, port, sni)), CheckRedirect: rs.checkRedirect}
+}
+
+type transportKey struct {
+	ip   string
+	port int
+	sni  string
+}
+
+type transportEntry struct {
+	key transportKey
+	tr  *http.Transport
+}
+
+// transportPool is a small LRU of the pinned transports of one run.
+type transportPool struct {
+	mu    sync.Mutex
+	order *list.List // front = most recently used
+	byKey map[transportKey]*list.Element
+}
+
+func newTransportPool() *transportPool {
+	return &transportPool{order: list.New(), byKey: make(map[transportKey]*list.Element)}
+}
+
+// get returns the shared transport for ip:port and sni; clone it before modifying.
+func (p *transportPool) get(rs *runSettings, ip string, port int, sni string) *http.Transport {
+	key := transportKey{ip, port, sni}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if el, ok := p.byKey[key]; ok {
+		p.order.MoveToFront(el)
+		return el.Value.(*transportEntry).tr
+	}
+	tr := rs.pinnedTransport(ip, port, sni)
+	p.byKey[key] = p.order.PushFront(&transportEntry{key, tr})
+	if p.order.Len() > transportPoolSize {
+		oldest := p.order.Back()
+		p.order.Remove(oldest)
+		e := oldest.Value.(*transportEntry)
+		delete(p.byKey, e.key)
+		e.tr.CloseIdleConnections()
+	}
+	return tr
+}
+
+// closeAll drops every pooled transport and its idle connections.
+func (p *transportPool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for el := p.order.Front(); el != nil; el = el.Next() {
+		el.Value.(*transportEntry).tr.CloseIdleConnections()
+	}
+	p.order.Init()
+	p.byKey = make(map[transportKey]*list.Element)
+}
@@ -0,0 +1,54 @@
+package cfst
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTransportPool(t *testing.T) {
+	rs := newRunSettings()
+	pool := rs.transports
+	first := pool.get(rs, "1.1.1.1", 443, "a.example")
+	for _, tc := range []struct {
+		ip   string
+		port int
+		sni  string
+		same bool
+	}{
+		{"1.1.1.1", 443, "a.example", true},
+		{"1.1.1.1", 443, "b.example", false},
+		{"1.1.1.1", 8443, "a.example", false},
+		{"1.0.0.1", 443, "a.example", false},
+	} {
+		if got := pool.get(rs, tc.ip, tc.port, tc.sni) == first; got != tc.same {
+			t.Errorf("%s:%d %s: shared %v, want %v", tc.ip, tc.port, tc.sni, got, tc.same)
+		}
+	}
+
+	// The first key is touched halfway, so the least recently used one goes.
+	old := pool.get(rs, "1.0.0.1", 443, "a.example")
+	for i := 0; i < transportPoolSize; i++ {
+		if i == transportPoolSize/2 {
+			pool.get(rs, "1.1.1.1", 443, "a.example")
+		}
+		pool.get(rs, fmt.Sprintf("10.0.%d.%d", i/256, i%256), 443, "")
+	}
+	if pool.order.Len() != transportPoolSize || len(pool.byKey) != transportPoolSize {
+		t.Errorf("pool holds %d/%d transports, want %d", pool.order.Len(), len(pool.byKey), transportPoolSize)
+	}
+	if pool.get(rs, "1.1.1.1", 443, "a.example") != first {
+		t.Error("recently used transport was evicted")
+	}
+	if pool.get(rs, "1.0.0.1", 443, "a.example") == old {
+		t.Error("least recently used transport survived")
+	}
+
+	other := newRunSettings()
+	if other.transports.get(other, "1.1.1.1", 443, "a.example") == first {
+		t.Error("two runs share a transport")
+	}
+	pool.closeAll()
+	if pool.order.Len() != 0 || pool.get(rs, "1.1.1.1", 443, "a.example") == first {
+		t.Error("closeAll kept transports")
+	}
+}
@@ -0,0 +1,92 @@
+package cfst
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+// builtinUserAgents is the embedded rotation pool used by -ua-rotate.
+var builtinUserAgents = []string{
+	defaultUserAgent,
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.0.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:124.0) Gecko/20100101 Firefox/124.0",
+	"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+	"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+}
+
+// userAgentPool hands out User-Agents round-robin, one per request.
+type userAgentPool struct {
+	agents []string
+	next   atomic.Uint32
+}
+
+func (p *userAgentPool) pick() string {
+	if len(p.agents) == 1 {
+		return p.agents[0]
+	}
+	i := p.next.Add(1) - 1
+	return p.agents[int(i)%len(p.agents)]
+}
+
+// configureUserAgents installs the User-Agent pool; a fixed -ua wins over rotation.
+func (rs *runSettings) configureUserAgents(cfg Config) error {
+	switch {
+	case cfg.UserAgent != "":
+		rs.userAgents = &userAgentPool{agents: []string{cfg.UserAgent}}
+	case cfg.UAFile != "":
+		content, err := os.ReadFile(cfg.UAFile)
+		if err != nil {
+			return err
+		}
+		var agents []string
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				agents = append(agents, line)
+			}
+		}
+		if len(agents) == 0 {
+			return fmt.Errorf("no User-Agents found in %s", cfg.UAFile)
+		}
+		rs.userAgents = &userAgentPool{agents: agents}
+	case cfg.UARotate:
+		rs.userAgents = &userAgentPool{agents: builtinUserAgents}
+	}
+	return nil
+}
+
+var chromeVersionRe = regexp.MustCompile(`Chrome/(\d+)`)
+
+// setClientHints sets the Sec-Ch-Ua headers a Chromium ua would send.
+func setClientHints(set func(key, value string), ua string) {
+	m := chromeVersionRe.FindStringSubmatch(ua)
+	if m == nil {
+		return
+	}
+	platform := "Windows"
+	switch {
+	case strings.Contains(ua, "Android"):
+		platform = "Android"
+	case strings.Contains(ua, "Macintosh"):
+		platform = "macOS"
+	case strings.Contains(ua, "Linux"):
+		platform = "Linux"
+	}
+	mobile := "?0"
+	if strings.Contains(ua, "Mobile") {
+		mobile = "?1"
+	}
+	set("Sec-Ch-Ua", fmt.Sprintf(`"Not_A Brand";v="8", "Chromium";v="%s", "Google Chrome";v="%s"`, m[1], m[1]))
+	set("Sec-Ch-Ua-Mobile", mobile)
+	set("Sec-Ch-Ua-Platform", `"`+platform+`"`)
+}
@@ -0,0 +1,75 @@
+package cfst
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// -verify repeats the finalists' download test and keeps their mean and worst figures.
+
+// verifyTop is the number of top results re-tested by -verify.
+const verifyTop = 5
+
+// verifyFinalists re-tests the top verifyTop usable results passes more times.
+func verifyFinalists(ctx context.Context, results []NodeResult, cfg Config, passes int, stats *DownloadStats,
+	progressStatus func(msg string)) []NodeResult {
+
+	var finalists []NodeResult
+	for _, r := range results {
+		if r.DownloadSpeed > 0 && len(finalists) < verifyTop {
+			finalists = append(finalists, r)
+		}
+	}
+	if len(finalists) == 0 || passes <= 0 {
+		return results
+	}
+
+	testCfg := cfg
+	testCfg.DownloadNum = len(finalists)
+	testCfg.Skip429 = false
+	testCfg.MinSpeed = 0
+	testCfg.CacheTTL = 0
+	testCfg.StopThreshold = 9999.0 // disable fast-exit
+
+	sums := make(map[string]float64, len(finalists))
+	worst := make(map[string]NodeResult, len(finalists))
+	for _, f := range finalists {
+		sums[f.IP] = f.DownloadSpeed
+		worst[f.IP] = f
+	}
+	for pass := 1; pass <= passes && ctx.Err() == nil; pass++ {
+		if progressStatus != nil {
+			progressStatus(fmt.Sprintf("Verification pass %d/%d over the top %d IPs...", pass, passes, len(finalists)))
+		}
+		for _, r := range runParallelDownloadTest(ctx, finalists, testCfg, stats, nil, nil, nil, nil) {
+			w, ok := worst[r.IP]
+			if !ok {
+				continue
+			}
+			sums[r.IP] += r.DownloadSpeed
+			w.MinSpeed = min(w.MinSpeed, r.MinSpeed)
+			w.Stability = min(w.Stability, r.Stability)
+			worst[r.IP] = w
+		}
+	}
+	if ctx.Err() != nil {
+		return results // an interrupted pass would count as failures
+	}
+
+	out := append([]NodeResult(nil), results...)
+	for i, r := range out {
+		w, ok := worst[r.IP]
+		if !ok {
+			continue
+		}
+		ratio := r.SingleSpeed / r.DownloadSpeed // keep the per-stream share
+		r.DownloadSpeed = sums[r.IP] / float64(passes+1)
+		r.SingleSpeed = r.DownloadSpeed * ratio
+		r.MinSpeed, r.Stability = w.MinSpeed, w.Stability
+		r.CalcScore()
+		out[i] = r
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	return out
+}
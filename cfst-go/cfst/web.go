@@ -0,0 +1,304 @@
+package cfst
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// webShutdownTimeout bounds how long SIGTERM waits for running scans to wind down.
+const webShutdownTimeout = 30 * time.Second
+
+func RunWeb(cfg Config) {
+	logger := newWebLogger(cfg.Silent)
+
+	// serverCtx is cancelled on shutdown; every running scan derives from it.
+	serverCtx, stopScans := context.WithCancel(context.Background())
+	defer stopScans()
+
+	// A mux of its own, so an embedding program's routes don't collide.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", withCompression(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(indexHTML)
+	}))
+
+	var tokens map[string]string
+	if cfg.WebTokensFile != "" {
+		var err error
+		if tokens, err = loadWebTokens(cfg.WebTokensFile); err != nil {
+			logger.errorf("Error loading web tokens: %v", err)
+			return
+		}
+		logger.infof("🔑 %d API token(s) loaded; each gets its own history and cache namespace", len(tokens))
+	}
+
+	queue := newRunQueue(cfg.WebJobs)
+	jobLogs := &jobLogStore{logger: logger}
+
+	mux.HandleFunc("/api/test", withCompression(withNamespace(cfg, tokens, func(w http.ResponseWriter, r *http.Request, cfg Config) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		reqCfg := cfg
+		if err := applyTestParams(&reqCfg, r.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		stream, ctx, done, ok := startStream(w, r, serverCtx, jobLogs.start(r.URL.Path, jobParams(r), cfg.Namespace))
+		if !ok {
+			return
+		}
+		defer done()
+		sendEvent := stream.send
+
+		job, err := queue.wait(ctx, func(st QueueStatus) {
+			sendEvent("queued", st)
+		})
+		if err != nil {
+			return // client left (or server stopping) while queued
+		}
+		defer job.done()
+
+		ctx, meter := withByteMeter(ctx)
+		stopMeter := meter.report(byteMeterInterval, func(p ByteProgress) {
+			stream.send("progress_bytes", p)
+		})
+		defer stopMeter()
+
+		runner := newFrontendRunner(reqCfg)
+		var resultCount int
+		if reqCfg.AuditLog != "" {
+			endAudit := startAudit(reqCfg, r, stream, serverCtx, runner.stats, runner.timer)
+			defer func() { endAudit(resultCount) }()
+		}
+
+		var downloadNum, candidates int
+		runner.OnStatus = func(msg string) { sendEvent("status", msg) }
+		runner.OnPhase = func(p PhaseTiming) { sendEvent("phase", p) }
+		runner.OnScan = func(done, total, valid int) {
+			if done%10 == 0 || done == total {
+				job.report(0, 0.2, done, total)
+				sendEvent("progress_scan", map[string]int{"done": done, "total": total, "valid": valid})
+			}
+		}
+		runner.OnFilter = func(done, total int) {
+			job.report(0.2, 0.4, done, total)
+			sendEvent("progress_colo", map[string]int{"done": done, "total": total})
+		}
+		runner.beforeDownload = func(cfg Config, n int) {
+			downloadNum, candidates = cfg.DownloadNum, n
+		}
+		runner.OnResult = func(res NodeResult) {
+			job.report(0.4, 1, int(runner.stats.Tested.Load()), min(downloadNum, candidates))
+			if res.Colo != "429" || !reqCfg.Skip429 {
+				sendEvent("progress_download", res)
+			}
+		}
+		runner.OnTop = func(top []NodeResult) { sendEvent("leaderboard", top) }
+		runner.OnProgress = func(p LiveProgress) { sendEvent("progress_live", p) }
+		runner.OnFastExit = func() { sendEvent("fast_exit", "Speed threshold reached, stopping early.") }
+		runner.OnLongevity = func(res NodeResult) { sendEvent("progress_longevity", res) }
+
+		results, summary, err := runner.Run(ctx)
+		switch {
+		case errors.Is(err, ErrAllRateLimited):
+			for _, err := range reportBlocked(reqCfg, summary) {
+				logger.errorf("Chat notification failed: %v", err)
+			}
+			sendEvent("error", "All tested IPs failed or were rate-limited. Please wait and retry.")
+			return
+		case err != nil:
+			sendEvent("error", err.Error())
+			return
+		case serverCtx.Err() != nil:
+			return // interrupted by shutdown; don't record a partial run
+		}
+		resultCount = len(results)
+		stopMeter()
+		if !reqCfg.LatencyOnly {
+			finishRun(reqCfg, results, summary, sendEvent)
+		}
+		sendEvent("status", "Test Complete")
+		sendEvent("complete", map[string]interface{}{
+			"results": results,
+			"summary": summary,
+		})
+	})))
+
+	mux.HandleFunc("/api/retest", withCompression(withNamespace(cfg, tokens, func(w http.ResponseWriter, r *http.Request, cfg Config) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ips, err := parseRetestIPs(r.URL.Query().Get("ips"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reqCfg := cfg
+		if err := applyTestParams(&reqCfg, r.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		stream, ctx, done, ok := startStream(w, r, serverCtx, jobLogs.start(r.URL.Path, jobParams(r), cfg.Namespace))
+		if !ok {
+			return
+		}
+		defer done()
+
+		job, err := queue.wait(ctx, func(st QueueStatus) {
+			stream.send("queued", st)
+		})
+		if err != nil {
+			return
+		}
+		defer job.done()
+
+		ctx, meter := withByteMeter(ctx)
+		stopMeter := meter.report(byteMeterInterval, func(p ByteProgress) {
+			stream.send("progress_bytes", p)
+		})
+		defer stopMeter()
+
+		timer := newPhaseTimer()
+		var dlStats DownloadStats
+		var resultCount int
+		if reqCfg.AuditLog != "" {
+			endAudit := startAudit(reqCfg, r, stream, serverCtx, &dlStats, timer)
+			defer func() { endAudit(resultCount) }()
+		}
+
+		results := retest(ctx, reqCfg, ips, &dlStats, timer, stream.send, func(done, total int) {
+			job.report(0, 1, done, total)
+		})
+		if serverCtx.Err() != nil || ctx.Err() != nil {
+			return
+		}
+		resultCount = len(results)
+		stopMeter()
+		stream.send("status", "Retest Complete")
+		stream.send("complete", map[string]interface{}{
+			"results": results,
+			"summary": buildSummary(len(ips), len(ips), nil, nil, &dlStats, results, timer),
+		})
+	})))
+
+	mux.HandleFunc("/api/report/hours", withCompression(withNamespace(cfg, tokens, func(w http.ResponseWriter, r *http.Request, cfg Config) {
+		if cfg.HistoryFile == "" {
+			http.Error(w, "History not enabled (start with -history <file>)", http.StatusNotFound)
+			return
+		}
+		records, err := loadHistory(cfg.HistoryFile)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSONList(w, r, timeOfDayReport(records, r.URL.Query().Get("by") == "ip"))
+	})))
+
+	mux.HandleFunc("/api/pick", withCompression(withNamespace(cfg, tokens, servePick)))
+
+	srv := &http.Server{Addr: cfg.WebPort, Handler: mux}
+	sigCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	stopCtx, stopServer := context.WithCancel(sigCtx)
+	defer stopServer()
+	if cfg.IdleTimeout > 0 {
+		go watchIdle(stopCtx, queue, cfg.IdleTimeout, cfg.IdleExit, stopServer, logger)
+	}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-stopCtx.Done()
+		logger.infof("Shutting down web server...")
+		stopScans()
+		ctx, cancel := context.WithTimeout(context.Background(), webShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.errorf("Web server shutdown: %v", err)
+			srv.Close()
+		}
+	}()
+
+	mux.HandleFunc("/api/audit", withCompression(withNamespace(cfg, tokens, func(w http.ResponseWriter, r *http.Request, cfg Config) {
+		if cfg.AuditLog == "" {
+			http.Error(w, "Audit log not enabled (start with -audit-log <file>)", http.StatusNotFound)
+			return
+		}
+		limit := 200
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+			limit = l
+		}
+		entries, err := loadAudit(cfg.AuditLog, cfg.Namespace, limit)
+		if err != nil && !os.IsNotExist(err) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSONList(w, r, entries)
+	})))
+
+	mux.HandleFunc("/api/jobs", withCompression(withNamespace(cfg, tokens, func(w http.ResponseWriter, r *http.Request, cfg Config) {
+		writeJSONList(w, r, jobLogs.list(cfg.Namespace))
+	})))
+
+	mux.HandleFunc("/api/jobs/", withCompression(withNamespace(cfg, tokens, func(w http.ResponseWriter, r *http.Request, cfg Config) {
+		rest, isLog := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/log")
+		id, err := strconv.ParseInt(rest, 10, 64)
+		if !isLog || err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		entries, found := jobLogs.log(id, cfg.Namespace)
+		if !found {
+			http.Error(w, fmt.Sprintf("No log for job %d (only the last %d jobs are kept)", id, jobLogKeep), http.StatusNotFound)
+			return
+		}
+		writeJSONList(w, r, entries)
+	})))
+
+	mux.HandleFunc("/api/defaults", withCompression(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(clientDefaults(r))
+	}))
+
+	mux.HandleFunc("/api/openapi.json", withCompression(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openAPISpec())
+	}))
+	mux.HandleFunc("/api/docs", withCompression(serveAPIDocs))
+	mux.HandleFunc("/metrics", withNamespace(cfg, tokens, func(w http.ResponseWriter, r *http.Request, cfg Config) {
+		metricsFor(cfg.Namespace).serve(w, r)
+	}))
+
+	ln, err := webListener(cfg.WebPort)
+	if err != nil {
+		logger.errorf("Web server error: %v", err)
+		return
+	}
+	logger.infof("🚀 Web UI started. Open http://localhost%s in your browser", cfg.WebPort)
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.errorf("Web server error: %v", err)
+		return
+	}
+	<-drained
+}
@@ -0,0 +1,73 @@
+package cfst
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// -webhook POSTs every completed run's JSON result document, signed with CFST_WEBHOOK_SECRET.
+
+const (
+	webhookSignatureHeader = "X-CFST-Signature-256"
+	webhookTimeout         = 15 * time.Second
+)
+
+// signWebhook returns the signature header value of body under secret.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postWebhook sends the run's result document to -webhook.
+func postWebhook(cfg Config, results []NodeResult, summary RunSummary, at time.Time) error {
+	if cfg.OfflineSources {
+		return errOffline
+	}
+	if results == nil {
+		results = []NodeResult{}
+	}
+	body, err := json.Marshal(ResultDoc{
+		Version:   version,
+		Timestamp: at.UTC().Truncate(time.Second),
+		Config:    runConfig(cfg),
+		Summary:   &summary,
+		Results:   results,
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cfst/"+version)
+	if cfg.WebhookSecret != "" {
+		req.Header.Set(webhookSignatureHeader, signWebhook(cfg.WebhookSecret, body))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err // its URL may hold credentials
+		}
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package cfst
+
+import (
+	"log"
+	"os"
+)
+
+// Web mode logs whole lines to stdout through a webLogger; -silent keeps only errors.
+
+// webLogger writes the web server's own messages.
+type webLogger struct {
+	silent bool
+	l      *log.Logger
+}
+
+func newWebLogger(silent bool) *webLogger {
+	return &webLogger{silent: silent, l: log.New(os.Stdout, "", 0)}
+}
+
+// infof logs a routine message that -silent drops; a nil *webLogger logs nothing.
+func (w *webLogger) infof(format string, args ...interface{}) {
+	if w != nil && !w.silent {
+		w.l.Printf(format, args...)
+	}
+}
+
+// errorf logs a problem, with -silent too.
+func (w *webLogger) errorf(format string, args ...interface{}) {
+	if w != nil {
+		w.l.Printf(format, args...)
+	}
+}
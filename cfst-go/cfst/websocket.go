@@ -0,0 +1,140 @@
+package cfst
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocketProbe checks a WebSocket echo at wsURL through ip:port and returns its RTT.
+func WebSocketProbe(ctx context.Context, ip string, port int, wsURL string, customSNI string, timeout time.Duration) (status string, rttMs float64) {
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return "url", 0
+	}
+	host := u.Hostname()
+	rs := settingsOf(ctx)
+
+	conn, err := (&net.Dialer{Timeout: timeout}).DialContext(ctx, "tcp", rs.dialAddr(ip, port))
+	if err != nil {
+		return "dial", 0
+	}
+	defer conn.Close()
+	defer closeOnCancel(ctx, conn)()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if u.Scheme == "wss" || u.Scheme == "https" {
+		sni := host
+		if customSNI != "" {
+			sni = customSNI
+		}
+		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: sni, NextProtos: []string{"http/1.1"}})
+		if err := tlsConn.Handshake(); err != nil {
+			return "dial", 0
+		}
+		conn = tlsConn
+	}
+
+	var nonce [16]byte
+	rand.Read(nonce[:])
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	path := u.RequestURI()
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUser-Agent: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", path, u.Host, rs.userAgents.pick(), key)
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		return "upgrade", 0
+	}
+	sum := sha1.Sum([]byte(key + wsGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return "upgrade", 0
+	}
+
+	payload := []byte("cfst-" + strconv.FormatInt(time.Now().UnixNano(), 36))
+	start := time.Now()
+	if _, err := conn.Write(wsTextFrame(payload)); err != nil {
+		return "no-echo", 0
+	}
+	// Some echo servers greet first; allow a couple of unrelated frames.
+	for i := 0; i < 3; i++ {
+		msg, err := wsReadFrame(br)
+		if err != nil {
+			return "no-echo", 0
+		}
+		if bytes.Equal(msg, payload) {
+			return "ok", float64(time.Since(start).Microseconds()) / 1000.0
+		}
+	}
+	return "no-echo", 0
+}
+
+// wsTextFrame builds a masked client text frame (payload < 126 bytes).
+func wsTextFrame(payload []byte) []byte {
+	var mask [4]byte
+	rand.Read(mask[:])
+	frame := []byte{0x81, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// wsReadFrame reads one unfragmented server frame and returns its payload.
+func wsReadFrame(r *bufio.Reader) ([]byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := uint64(hdr[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > 1<<20 {
+		return nil, fmt.Errorf("websocket frame too large: %d", n)
+	}
+	var mask []byte
+	if hdr[1]&0x80 != 0 {
+		mask = make([]byte, 4)
+		if _, err := io.ReadFull(r, mask); err != nil {
+			return nil, err
+		}
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	if mask != nil {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return payload, nil
+}
@@ -0,0 +1,105 @@
+package cfst
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// -xray-config points the -xray-tag outbounds of an Xray config at the best result.
+
+const xrayRestartTimeout = 30 * time.Second
+
+// xrayConfig is a parsed -xray-config.
+type xrayConfig struct {
+	config  map[string]interface{}
+	servers []map[string]interface{} // the server entries of the tagged outbounds
+}
+
+// loadXrayConfig reads path and finds the servers of the outbounds tagged tags.
+func loadXrayConfig(path, tags string) (*xrayConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var config map[string]interface{}
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%s: %v (comments aren't supported)", path, err)
+	}
+	want := make(map[string]bool)
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			want[tag] = true
+		}
+	}
+	x := &xrayConfig{config: config}
+	list, _ := config["outbounds"].([]interface{})
+	for _, o := range list {
+		out, _ := o.(map[string]interface{})
+		tag, _ := out["tag"].(string)
+		if out == nil || !want[tag] {
+			continue
+		}
+		settings, _ := out["settings"].(map[string]interface{})
+		found := false
+		for _, key := range []string{"vnext", "servers"} {
+			servers, _ := settings[key].([]interface{})
+			for _, s := range servers {
+				if server, ok := s.(map[string]interface{}); ok {
+					x.servers = append(x.servers, server)
+					found = true
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s: outbound %q has no settings.vnext or settings.servers", path, tag)
+		}
+		delete(want, tag)
+	}
+	for tag := range want {
+		return nil, fmt.Errorf("%s: no outbound tagged %q", path, tag)
+	}
+	return x, nil
+}
+
+// writeXray updates -xray-config with the best result and restarts -xray-restart.
+func writeXray(cfg Config, results []NodeResult) (string, error) {
+	best := bestResult(forPortless(results, cfg.Check443))
+	if best == nil {
+		return "", fmt.Errorf("no usable result to point the outbounds at")
+	}
+	x, err := loadXrayConfig(cfg.XrayConfig, cfg.XrayTag)
+	if err != nil {
+		return "", err
+	}
+	for _, server := range x.servers {
+		server["address"] = best.IP
+		if !portless(*best) {
+			server["port"] = best.Port
+		}
+	}
+	b, err := json.MarshalIndent(x.config, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(cfg.XrayConfig, append(b, '\n'), 0644); err != nil {
+		return "", err
+	}
+	msg := fmt.Sprintf("Xray: %s → %s in %s", cfg.XrayTag, usableAt(*best), cfg.XrayConfig)
+	if cfg.XrayRestart != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), xrayRestartTimeout)
+		defer cancel()
+		if out, err := exec.CommandContext(ctx, "systemctl", "restart", cfg.XrayRestart).CombinedOutput(); err != nil {
+			return "", fmt.Errorf("%s written, restarting %s failed: %v %s", cfg.XrayConfig, cfg.XrayRestart, err, strings.TrimSpace(string(out)))
+		}
+		msg += ", restarted " + cfg.XrayRestart
+	}
+	return msg, nil
+}
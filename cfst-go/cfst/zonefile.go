@@ -0,0 +1,42 @@
+package cfst
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// -bind-out writes the top results as BIND zone-file records.
+
+// formatZone returns the records of the top usable results, best first.
+func formatZone(results []NodeResult, name string, ttl, top int, only443 bool, now time.Time) string {
+	var lines []string
+	usable := topUsable(results, top)
+	for _, r := range usable {
+		ip := net.ParseIP(r.IP)
+		if ip == nil {
+			continue
+		}
+		rtype, hint := "AAAA", "ipv6hint"
+		if ip.To4() != nil {
+			rtype, hint = "A", "ipv4hint"
+		}
+		note := fmt.Sprintf("; %s %.2f MB/s %.1f ms", r.Colo, r.DownloadSpeed, r.TCPLatency)
+		if altPort(r) {
+			lines = append(lines, fmt.Sprintf("%s\t%d\tIN\tHTTPS\t1 . port=%d %s=%s\t%s on %s",
+				name, ttl, r.Port, hint, r.IP, note, resultAddr(r.IP, r.Port)))
+		}
+		if !only443 || portless(r) {
+			lines = append(lines, fmt.Sprintf("%s\t%d\tIN\t%s\t%s\t%s", name, ttl, rtype, r.IP, note))
+		}
+	}
+	header := fmt.Sprintf("; CFST %s: top %d of %d results", now.UTC().Format(time.RFC3339), len(usable), len(results))
+	return strings.Join(append([]string{header}, lines...), "\n") + "\n"
+}
+
+// writeZone writes the -bind-out file.
+func writeZone(cfg Config, results []NodeResult, now time.Time) error {
+	return os.WriteFile(cfg.BindOut, []byte(formatZone(results, cfg.BindName, cfg.BindTTL, cfg.BindTop, cfg.Check443, now)), 0644)
+}
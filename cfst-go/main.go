@@ -1,61 +1,8 @@
+// Command cfst finds the fastest Cloudflare IPs for this network.
 package main
 
-import (
-	"flag"
-	"os"
-	"strings"
-)
+import "cfst-go/cfst"
 
 func main() {
-	cfg := DefaultConfig()
-
-	flag.IntVar(&cfg.Port, "p", cfg.Port, "Target port")
-	flag.IntVar(&cfg.MaxScan, "max", cfg.MaxScan, "Max IPs to scan")
-	flag.IntVar(&cfg.TopN, "topn", cfg.TopN, "Top N candidates by latency for speed test")
-	flag.IntVar(&cfg.DLConc, "dlc", cfg.DLConc, "Parallel download test concurrency")
-	flag.IntVar(&cfg.DownloadNum, "dn", cfg.DownloadNum, "Download test count")
-	flag.IntVar(&cfg.Duration, "dt", cfg.Duration, "Download duration (seconds)")
-	flag.Float64Var(&cfg.StopThreshold, "st", cfg.StopThreshold, "Stop threshold MB/s (CF URL mode only)")
-	flag.BoolVar(&cfg.Unique, "u", cfg.Unique, "Unique C-subnet")
-	flag.StringVar(&cfg.IPFile, "f", cfg.IPFile, "Custom IP file")
-	flag.StringVar(&cfg.Output, "o", cfg.Output, "Output file")
-	flag.IntVar(&cfg.ScanConcurrent, "sc", cfg.ScanConcurrent, "Scan concurrency")
-	flag.BoolVar(&cfg.Skip429, "skip429", cfg.Skip429, "Discard 429 rate-limited IPs silently")
-	flag.StringVar(&cfg.URL, "url", cfg.URL, "Custom download test URL")
-	flag.IntVar(&cfg.QuickDuration, "qd", cfg.QuickDuration, "Quick pre-filter duration in seconds (custom URL mode)")
-	flag.StringVar(&cfg.FilterMode, "filter", cfg.FilterMode, "Candidate filter mode (speed, multi-colo, none)")
-	flag.StringVar(&cfg.SNI, "sni", cfg.SNI, "Custom TLS SNI (ServerName)")
-
-	webMode := false
-	webPort := "9876"
-	if len(os.Args) > 0 {
-		var newArgs []string
-		newArgs = append(newArgs, os.Args[0])
-		for i := 1; i < len(os.Args); i++ {
-			if os.Args[i] == "-web" {
-				webMode = true
-				if i+1 < len(os.Args) && !strings.HasPrefix(os.Args[i+1], "-") {
-					webPort = os.Args[i+1]
-					i++
-				}
-			} else {
-				newArgs = append(newArgs, os.Args[i])
-			}
-		}
-		os.Args = newArgs
-	}
-
-	flag.Bool("web", false, "Start Web UI server (-web <port>)")
-	flag.Parse()
-
-	if webMode {
-		cfg.WebMode = true
-		cfg.WebPort = webPort
-		if !strings.Contains(cfg.WebPort, ":") {
-			cfg.WebPort = ":" + cfg.WebPort
-		}
-		RunWeb(cfg)
-	} else {
-		RunCLI(cfg)
-	}
+	cfst.Main()
 }